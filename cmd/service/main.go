@@ -4,18 +4,35 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 	"xm/config"
+	"xm/internal/auth"
+	"xm/internal/events"
 	"xm/internal/handlers"
+	"xm/internal/health"
+	"xm/internal/idempotency"
+	"xm/internal/logging"
+	"xm/internal/metrics"
 	"xm/internal/repositories"
+	"xm/internal/repositories/cache"
+	"xm/internal/rpc"
+	"xm/internal/stream"
+	"xm/internal/tracing"
+	"xm/internal/webhooks"
+	"xm/internal/workers"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/jwtauth"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
 )
 
 var logger zerolog.Logger
@@ -24,37 +41,225 @@ var cfg config.Configuration
 func init() {
 	logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
 	cfg = config.Load(logger)
+
+	configured, err := logging.New(cfg.Log, os.Stderr)
+	if err != nil {
+		logger.Error().Timestamp().Msg(err.Error())
+		os.Exit(1)
+	}
+	logger = configured.Hook(tracing.LogHook{})
 }
 
 func main() {
 	var err error
-	var db *sqlx.DB
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrate(os.Args[2:])
+	} else {
+		err = run()
+	}
+	if err != nil {
+		logger.Error().Timestamp().Msg(err.Error())
+		os.Exit(1)
+	}
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// run serves until SIGINT or SIGTERM and then shuts down in order: readiness
+// flips to not ready, the server stops accepting and drains in-flight requests
+// within HTTP_SHUTDOWN_TIMEOUT, background workers stop and the connections
+// are closed.
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	db, err = sqlx.Connect(cfg.Postgres.SqlDriver, cfg.Postgres.SqlDSN)
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
 	if err != nil {
-		logger.Info().Timestamp().Msg(err.Error())
-		os.Exit(1)
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTPShutdownTimeout)
+		defer cancel()
+
+		err := shutdownTracing(ctx)
+		if err != nil {
+			logger.Warn().Timestamp().Msg(err.Error())
+		}
+	}()
+
+	if cfg.Migrate.OnStart {
+		err = migrateOnStart()
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := sqlx.Connect(cfg.Postgres.SqlDriver, cfg.Postgres.SqlDSN)
+	if err != nil {
+		return err
 	}
 	defer db.Close()
 
-	companyRepository := repositories.NewCompanyRepository(ctx, db)
-	companyHandler := handlers.NewCompanyHandler(ctx, companyRepository, logger)
+	var redisClient *redis.Client
+	if cfg.Redis.Host != "" {
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+		defer redisClient.Close()
+	}
+
+	var idempotencyStore idempotency.Store
+	switch cfg.Idempotency.Store {
+	case "redis":
+		if redisClient == nil {
+			return errors.New("IDEMPOTENCY_STORE=redis requires REDIS_HOST")
+		}
+		idempotencyStore = idempotency.NewRedisStore(redisClient)
+	default:
+		idempotencyStore = idempotency.NewPostgresStore(db)
+	}
+
+	sink, err := events.New(cfg.Outbox)
+	if err != nil {
+		return err
+	}
+	if sink != nil {
+		defer sink.Close()
+	}
+
+	err = metrics.RegisterDB(db.DB)
+	if err != nil {
+		return err
+	}
+
+	repository := tracing.NewCompanyRepository(metrics.NewCompanyRepository(repositories.NewCompanyRepository(db, cfg.Postgres, sink != nil)))
+	companyRepository := cache.NewCompanyRepository(repository, redisClient, cfg.Redis, cfg.Postgres.ReadTimeout, logger)
+
+	companyHandler := handlers.NewCompanyHandler(companyRepository, logger, cfg)
+
+	graphqlHandler, err := handlers.NewGraphQLHandler(companyRepository, logger, cfg)
+	if err != nil {
+		return err
+	}
+
+	webhookRepository := repositories.NewWebhookRepository(db, cfg.Postgres)
+	webhookAddresses, err := webhooks.NewAddressPolicy(cfg.Webhooks.AllowedNetworks)
+	if err != nil {
+		return err
+	}
+	webhookHandler := handlers.NewWebhookHandler(webhookRepository, webhookAddresses, logger)
+
+	broker := stream.NewBroker(cfg.Stream.ReplaySize, cfg.Stream.SubscriberBuffer)
+	streamHandler := handlers.NewStreamHandler(broker, logger, cfg.Stream)
+
+	authenticator, err := auth.NewAuthenticator(ctx, cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	checks := []health.Check{
+		{Name: "postgres", Critical: true, Run: db.PingContext},
+		{Name: "migrations", Critical: true, Run: func(ctx context.Context) error {
+			return repositories.CheckSchema(ctx, db)
+		}},
+	}
+	if redisClient != nil {
+		// Redis is only required when it stores idempotency keys, the cache
+		// bypasses it while it is down.
+		checks = append(checks, health.Check{Name: "redis", Critical: cfg.Idempotency.Store == "redis", Run: func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		}})
+	}
+	healthHandler := health.New(cfg.Health, logger, checks...)
 
 	router := chi.NewRouter()
+	router.Use(tracing.Middleware)
+	router.Use(logging.RequestID)
+	router.Use(logging.AccessLog(logger))
+	router.Use(metrics.Middleware)
+
+	router.Get("/healthz", healthHandler.Live)
+	router.Get("/readyz", healthHandler.Ready)
+	router.Get("/health", healthHandler.Health)
+
+	// With METRICS_PORT set /metrics is only served on that port, which can be
+	// kept off the public network.
+	var metricsServer *http.Server
+	if cfg.MetricsPort == 0 {
+		router.Handle("/metrics", metrics.Handler())
+	} else {
+		metricsRouter := chi.NewRouter()
+		metricsRouter.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.MetricsPort),
+			ReadHeaderTimeout: cfg.HTTPServerTimeout,
+			Handler:           metricsRouter,
+		}
+	}
+
+	readAuth := []func(http.Handler) http.Handler{authenticator.Authenticate, auth.RequireScope(auth.ScopeRead, logger)}
+	if cfg.Auth.AnonymousRead {
+		readAuth = []func(http.Handler) http.Handler{authenticator.Optional}
+	}
 
 	router.Group(func(router chi.Router) {
+		router.Use(readAuth...)
+
+		router.Get("/v1/company", companyHandler.ListCompanies)
+		router.Get("/v1/company/export", companyHandler.ExportCompanies)
+		router.Get("/v1/company/stream", streamHandler.StreamCompanies)
 		router.Get("/v1/company/{id}", companyHandler.GetCompany)
+		// Mutations check the write and delete scopes themselves.
+		router.Post("/graphql", graphqlHandler.GraphQL)
 	})
 
 	router.Group(func(router chi.Router) {
-		router.Use(validateToken)
+		router.Use(authenticator.Authenticate)
+
+		// The history names the subject and request of every change, it is
+		// not readable anonymously.
+		router.Group(func(router chi.Router) {
+			router.Use(auth.RequireScope(auth.ScopeRead, logger))
 
-		router.Post("/v1/company", companyHandler.CreateCompany)
-		router.Delete("/v1/company/{id}", companyHandler.DeleteCompany)
-		router.Patch("/v1/company/{id}", companyHandler.UpdateCompany)
+			router.Get("/v1/company/{id}/history", companyHandler.ListCompanyHistory)
+			router.Get("/v1/company/{id}/history/{version}", companyHandler.GetCompanyHistory)
+		})
+
+		router.Group(func(router chi.Router) {
+			router.Use(auth.RequireScope(auth.ScopeWrite, logger))
+
+			router.With(companyHandler.LimitCompanyBody, idempotency.Middleware(idempotencyStore, cfg.Idempotency, logger)).
+				Post("/v1/company", companyHandler.CreateCompany)
+			router.With(companyHandler.LimitBatchBody, idempotency.Middleware(idempotencyStore, cfg.Idempotency, logger)).
+				Post("/v1/company/batch", companyHandler.BatchCompanies)
+			router.With(companyHandler.LimitImportBody).
+				Post("/v1/company/import", companyHandler.ImportCompanies)
+			router.With(companyHandler.LimitCompanyBody).
+				Put("/v1/company/{id}", companyHandler.UpdateCompany)
+			router.With(companyHandler.LimitCompanyBody).
+				Patch("/v1/company/{id}", companyHandler.PatchCompany)
+		})
+
+		router.With(auth.RequireScope(auth.ScopeDelete, logger)).
+			Delete("/v1/company/{id}", companyHandler.DeleteCompany)
+
+		router.Group(func(router chi.Router) {
+			router.Use(auth.RequireRole(auth.RoleAdmin, logger))
+
+			router.Post("/v1/company/{id}/restore", companyHandler.RestoreCompany)
+			router.Delete("/v1/company/{id}/purge", companyHandler.PurgeCompany)
+		})
+
+		router.Group(func(router chi.Router) {
+			router.Use(auth.RequireScope(auth.ScopeWebhooks, logger))
+
+			router.Post("/v1/webhooks", webhookHandler.CreateWebhook)
+			router.Get("/v1/webhooks", webhookHandler.ListWebhooks)
+			router.Get("/v1/webhooks/{id}", webhookHandler.GetWebhook)
+			router.Patch("/v1/webhooks/{id}", webhookHandler.UpdateWebhook)
+			router.Delete("/v1/webhooks/{id}", webhookHandler.DeleteWebhook)
+			router.Get("/v1/webhooks/{id}/deliveries", webhookHandler.ListDeliveries)
+		})
 	})
 
 	server := http.Server{
@@ -62,33 +267,131 @@ func main() {
 		WriteTimeout:      cfg.HTTPServerTimeout,
 		ReadTimeout:       cfg.HTTPServerTimeout,
 		IdleTimeout:       time.Second,
-		ReadHeaderTimeout: 0,
+		ReadHeaderTimeout: cfg.HTTPServerTimeout,
 		Handler:           router,
+		// Streams move the write deadline of their connection themselves.
+		ConnContext: stream.ConnContext,
 	}
+	// Streams would hold the drain until HTTP_SHUTDOWN_TIMEOUT, their clients
+	// reconnect to another instance and resume.
+	server.RegisterOnShutdown(broker.Close)
 
-	err = http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), router)
+	listener, err := net.Listen("tcp", server.Addr)
 	if err != nil {
-		err := server.Shutdown(ctx)
+		return err
+	}
+
+	// With GRPC_PORT set the company service is also served over gRPC.
+	var grpcServer *grpc.Server
+	var grpcListener net.Listener
+	if cfg.GRPCPort != 0 {
+		grpcListener, err = net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
 		if err != nil {
-			logger.Info().Timestamp().Msg(err.Error())
-			os.Exit(1)
+			_ = listener.Close()
+			return err
 		}
+		grpcServer = rpc.NewServer(rpc.NewCompanyServer(companyRepository, broker, logger, cfg), authenticator, logger, cfg)
+		defer grpcServer.Stop()
 	}
-}
 
-func validateToken(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := jwtauth.TokenFromHeader(r)
+	var metricsListener net.Listener
+	if metricsServer != nil {
+		metricsListener, err = net.Listen("tcp", metricsServer.Addr)
+		if err != nil {
+			_ = listener.Close()
+			return err
+		}
+		defer metricsServer.Close()
+	}
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		workers.NewPurger(repository, idempotencyStore, cfg.Purge.Retention, cfg.Purge.Interval, logger).Run(workersCtx)
+	}()
+	if sink != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workers.NewDispatcher(repository, sink, cfg.Outbox, logger).Run(workersCtx)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		stream.NewListener(cfg.Postgres.SqlDSN, repository, broker, cfg.Stream, logger).Run(workersCtx)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		workers.NewDeliverer(webhookRepository, webhookAddresses, cfg.Webhooks, logger).Run(workersCtx)
+	}()
+
+	serverErr := make(chan error, 3)
+	go func() {
+		serverErr <- server.Serve(listener)
+	}()
+	if metricsServer != nil {
+		go func() {
+			serverErr <- metricsServer.Serve(metricsListener)
+		}()
+	}
+	if grpcServer != nil {
+		go func() {
+			serverErr <- grpcServer.Serve(grpcListener)
+		}()
+	}
+
+	healthHandler.SetReady(true)
+	logger.Info().Timestamp().Str("addr", server.Addr).Msg("server started")
+	if grpcListener != nil {
+		logger.Info().Timestamp().Str("addr", grpcListener.Addr().String()).Msg("gRPC server started")
+	}
 
-		if token != cfg.Token {
-			w.WriteHeader(http.StatusUnauthorized)
-			_, err := w.Write([]byte(errors.New("invalid token").Error()))
-			if err != nil {
-				logger.Info().Timestamp().Msg(err.Error())
+	select {
+	case err = <-serverErr:
+		// The server failed, there is nothing to drain.
+	case <-ctx.Done():
+		// A second signal terminates the process without waiting for the drain.
+		stop()
+		logger.Info().Timestamp().Msg("shutting down")
+		healthHandler.SetReady(false)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HTTPShutdownTimeout)
+		defer cancel()
+
+		err = server.Shutdown(shutdownCtx)
+		if err != nil {
+			logger.Warn().Timestamp().Msg("drain timed out, closing remaining connections")
+			err = server.Close()
+		}
+
+		// Watch calls ended with the broker when the server shut down.
+		if grpcServer != nil {
+			stopped := make(chan struct{})
+			go func() {
+				grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-shutdownCtx.Done():
+				logger.Warn().Timestamp().Msg("gRPC drain timed out, closing remaining connections")
+				grpcServer.Stop()
 			}
-			return
 		}
+	}
 
-		next.ServeHTTP(w, r)
-	})
+	stopWorkers()
+	wg.Wait()
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"xm/internal/repositories"
+)
+
+const migrateUsage = "usage: service migrate up | down [N] | goto VERSION | force VERSION | status"
+
+// runMigrate applies the migrations embedded in the binary:
+//
+//	up              apply every pending migration
+//	down [N]        revert the last N migrations (default 1)
+//	goto VERSION    migrate up or down to VERSION
+//	force VERSION   mark VERSION as applied without running it, to recover a dirty schema
+//	status          print the applied, expected and pending versions
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := repositories.NewMigrator(cfg.Postgres.SqlDriver, cfg.Postgres.SqlDSN, cfg.Migrate.LockTimeout, logger)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		return migrator.Up()
+
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		return migrator.Down(steps)
+
+	case (args[0] == "goto" || args[0] == "force") && len(args) == 2:
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		if args[0] == "force" {
+			return migrator.Force(version)
+		}
+		return migrator.Goto(version)
+
+	case args[0] == "status" && len(args) == 1:
+		status, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version %d\ndirty %t\nexpected %d\npending %d\n", status.Version, status.Dirty, status.Expected, status.Pending)
+		return nil
+	}
+
+	return errors.New(migrateUsage)
+}
+
+// migrateOnStart applies pending migrations before the service starts. The
+// advisory lock makes replicas starting at once wait for the first one.
+func migrateOnStart() error {
+	migrator, err := repositories.NewMigrator(cfg.Postgres.SqlDriver, cfg.Postgres.SqlDSN, cfg.Migrate.LockTimeout, logger)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	err = migrator.Up()
+	if err != nil {
+		return fmt.Errorf("migrate on start: %w", err)
+	}
+
+	return nil
+}
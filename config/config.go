@@ -12,25 +12,148 @@ type Configuration struct {
 	Port                int           `env:"HTTP_PORT"`
 	HTTPShutdownTimeout time.Duration `env:"HTTP_SHUTDOWN_TIMEOUT,default=5s"`
 	HTTPServerTimeout   time.Duration `env:"HTTP_SERVER_TIMEOUT,default=5s"`
+	MetricsPort         int           `env:"METRICS_PORT"`
+	GRPCPort            int           `env:"GRPC_PORT"`
 	Token               string        `env:"API_TOKEN"`
+	AdminToken          string        `env:"ADMIN_API_TOKEN"`
+	RequireIfMatch      bool          `env:"REQUIRE_IF_MATCH,default=false"`
+	CompanyMaxBodyBytes int64         `env:"COMPANY_MAX_BODY_BYTES,default=65536"`
+	Auth                Auth
 	Postgres            Postgres
 	Redis               Redis
+	Idempotency         Idempotency
+	Purge               Purge
+	Health              Health
+	Tracing             Tracing
+	Log                 Log
+	Migrate             Migrate
+	Batch               Batch
+	Import              Import
+	Outbox              Outbox
+	Webhooks            Webhooks
+	Stream              Stream
+	GraphQL             GraphQL
+}
+
+type Auth struct {
+	Mode                string        `env:"AUTH_MODE,default=jwt"`
+	AnonymousRead       bool          `env:"AUTH_ANONYMOUS_READ,default=false"`
+	Algorithm           string        `env:"JWT_ALGORITHM,default=HS256"`
+	Secret              string        `env:"JWT_SECRET"`
+	PublicKeyFile       string        `env:"JWT_PUBLIC_KEY_FILE"`
+	JWKSURL             string        `env:"JWKS_URL"`
+	JWKSFile            string        `env:"JWKS_FILE"`
+	JWKSRefreshInterval time.Duration `env:"JWKS_REFRESH_INTERVAL,default=15m"`
+	Issuer              string        `env:"JWT_ISSUER"`
+	Audience            string        `env:"JWT_AUDIENCE"`
+	ClockSkew           time.Duration `env:"JWT_CLOCK_SKEW,default=30s"`
+}
+
+type Health struct {
+	CacheTTL time.Duration `env:"HEALTH_CACHE_TTL,default=2s"`
+	Timeout  time.Duration `env:"HEALTH_CHECK_TIMEOUT,default=1s"`
+}
+
+type Tracing struct {
+	Exporter    string  `env:"TRACING_EXPORTER,default=none"`
+	File        string  `env:"TRACING_FILE,default=traces.json"`
+	SampleRatio float64 `env:"TRACING_SAMPLE_RATIO,default=1"`
+}
+
+type Log struct {
+	Level  string `env:"LOG_LEVEL,default=info"`
+	Format string `env:"LOG_FORMAT,default=json"`
+}
+
+type Batch struct {
+	MaxOperations int   `env:"BATCH_MAX_OPERATIONS,default=5000"`
+	MaxBodyBytes  int64 `env:"BATCH_MAX_BODY_BYTES,default=10485760"`
+}
+
+type Import struct {
+	MaxRows      int   `env:"IMPORT_MAX_ROWS,default=50000"`
+	MaxBodyBytes int64 `env:"IMPORT_MAX_BODY_BYTES,default=52428800"`
+}
+
+type Outbox struct {
+	Sink           string        `env:"OUTBOX_SINK,default=none"`
+	File           string        `env:"OUTBOX_FILE,default=events.ndjson"`
+	KafkaBrokers   string        `env:"KAFKA_BROKERS"`
+	KafkaTopic     string        `env:"KAFKA_TOPIC,default=companies"`
+	NATSURL        string        `env:"NATS_URL"`
+	NATSSubject    string        `env:"NATS_SUBJECT,default=companies"`
+	Interval       time.Duration `env:"OUTBOX_POLL_INTERVAL,default=1s"`
+	BatchSize      int           `env:"OUTBOX_BATCH_SIZE,default=100"`
+	Lease          time.Duration `env:"OUTBOX_LEASE,default=30s"`
+	RetryMin       time.Duration `env:"OUTBOX_RETRY_MIN,default=1s"`
+	RetryMax       time.Duration `env:"OUTBOX_RETRY_MAX,default=5m"`
+	PublishTimeout time.Duration `env:"OUTBOX_PUBLISH_TIMEOUT,default=10s"`
+}
+
+type Webhooks struct {
+	Interval        time.Duration `env:"WEBHOOK_POLL_INTERVAL,default=1s"`
+	BatchSize       int           `env:"WEBHOOK_BATCH_SIZE,default=50"`
+	Timeout         time.Duration `env:"WEBHOOK_TIMEOUT,default=10s"`
+	Lease           time.Duration `env:"WEBHOOK_LEASE,default=1m"`
+	RetryMin        time.Duration `env:"WEBHOOK_RETRY_MIN,default=5s"`
+	RetryMax        time.Duration `env:"WEBHOOK_RETRY_MAX,default=1h"`
+	MaxFailures     int           `env:"WEBHOOK_MAX_FAILURES,default=20"`
+	Retention       time.Duration `env:"WEBHOOK_RETENTION,default=168h"`
+	AllowedNetworks string        `env:"WEBHOOK_ALLOWED_NETWORKS"`
+}
+
+type Stream struct {
+	ReplaySize       int           `env:"STREAM_REPLAY_SIZE,default=1000"`
+	SubscriberBuffer int           `env:"STREAM_SUBSCRIBER_BUFFER,default=256"`
+	Heartbeat        time.Duration `env:"STREAM_HEARTBEAT,default=15s"`
+	WriteTimeout     time.Duration `env:"STREAM_WRITE_TIMEOUT,default=10s"`
+	MinReconnect     time.Duration `env:"STREAM_MIN_RECONNECT,default=1s"`
+	MaxReconnect     time.Duration `env:"STREAM_MAX_RECONNECT,default=1m"`
+}
+
+type GraphQL struct {
+	MaxDepth      int   `env:"GRAPHQL_MAX_DEPTH,default=8"`
+	MaxComplexity int   `env:"GRAPHQL_MAX_COMPLEXITY,default=1000"`
+	MaxBodyBytes  int64 `env:"GRAPHQL_MAX_BODY_BYTES,default=1048576"`
+}
+
+type Migrate struct {
+	OnStart     bool          `env:"MIGRATE_ON_START,default=false"`
+	LockTimeout time.Duration `env:"MIGRATE_LOCK_TIMEOUT,default=1m"`
 }
 
 type Postgres struct {
-	SqlDriver string `env:"SQL_DRIVER"`
-	SqlDSN    string `env:"POSTGRESQL_DSN"`
+	SqlDriver    string        `env:"SQL_DRIVER"`
+	SqlDSN       string        `env:"POSTGRESQL_DSN"`
+	ReadTimeout  time.Duration `env:"SQL_READ_TIMEOUT,default=5s"`
+	WriteTimeout time.Duration `env:"SQL_WRITE_TIMEOUT,default=10s"`
+	PurgeTimeout time.Duration `env:"SQL_PURGE_TIMEOUT,default=1m"`
+	BatchTimeout time.Duration `env:"SQL_BATCH_TIMEOUT,default=1m"`
 }
 
 type Redis struct {
 	Host                string        `env:"REDIS_HOST"`
 	Port                int           `env:"REDIS_PORT"`
+	Password            string        `env:"REDIS_PASSWORD"`
 	DB                  int           `env:"REDIS_DB"`
 	CacheExpirationTime int           `env:"CACHE_EXPIRATION_TIME"`
 	DefaultCacheTTL     time.Duration `env:"DEFAULT_CACHE_TTL"`
+	NegativeCacheTTL    time.Duration `env:"NEGATIVE_CACHE_TTL,default=30s"`
+	RetryAfter          time.Duration `env:"CACHE_RETRY_AFTER,default=10s"`
 	UseCache            bool          `env:"USE_CACHE"`
 }
 
+type Idempotency struct {
+	Store string        `env:"IDEMPOTENCY_STORE,default=postgres"`
+	TTL   time.Duration `env:"IDEMPOTENCY_TTL,default=24h"`
+	Lease time.Duration `env:"IDEMPOTENCY_LEASE,default=1m"`
+}
+
+type Purge struct {
+	Retention time.Duration `env:"PURGE_RETENTION,default=720h"`
+	Interval  time.Duration `env:"PURGE_INTERVAL,default=1h"`
+}
+
 func Load(logger zerolog.Logger) Configuration {
 	var c Configuration
 	if err := envdecode.Decode(&c); err != nil {
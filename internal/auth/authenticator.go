@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"xm/config"
+	"xm/internal/logging"
+	"xm/internal/tracing"
+
+	"github.com/go-chi/jwtauth/v5"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/rs/zerolog"
+)
+
+const (
+	ModeJWT    = "jwt"
+	ModeStatic = "static"
+
+	// StaticSubject is the subject of requests authenticated with API_TOKEN.
+	StaticSubject = "api_token"
+	// AdminSubject is the subject of requests authenticated with
+	// ADMIN_API_TOKEN.
+	AdminSubject = "admin_token"
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrNoSubject    = errors.New("token has no subject")
+)
+
+type authenticator struct {
+	mode        string
+	staticToken string
+	adminToken  string
+	options     []jwt.ParseOption
+	logger      zerolog.Logger
+}
+
+// NewAuthenticator verifies bearer tokens. In jwt mode the signature, exp,
+// nbf, iss and aud claims are checked and scopes and roles are read from the
+// scope, scp and roles claims; static mode compares the token with API_TOKEN
+// and ADMIN_API_TOKEN and is meant for local development only.
+func NewAuthenticator(ctx context.Context, configuration config.Configuration, logger zerolog.Logger) (authenticator, error) {
+	cfg := configuration.Auth
+	a := authenticator{
+		mode:        cfg.Mode,
+		staticToken: configuration.Token,
+		adminToken:  configuration.AdminToken,
+		logger:      logger,
+	}
+
+	switch cfg.Mode {
+	case ModeStatic:
+		if a.staticToken == "" {
+			return authenticator{}, errors.New("AUTH_MODE=static requires API_TOKEN")
+		}
+		return a, nil
+	case ModeJWT:
+	default:
+		return authenticator{}, fmt.Errorf("unknown AUTH_MODE %q", cfg.Mode)
+	}
+
+	keyOption, err := keyParseOption(ctx, cfg)
+	if err != nil {
+		return authenticator{}, err
+	}
+
+	a.options = []jwt.ParseOption{
+		keyOption,
+		jwt.WithValidate(true),
+		// exp is only validated when present, a token without it would
+		// never expire.
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithAcceptableSkew(cfg.ClockSkew),
+	}
+	if cfg.Issuer != "" {
+		a.options = append(a.options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		a.options = append(a.options, jwt.WithAudience(cfg.Audience))
+	}
+
+	return a, nil
+}
+
+func keyParseOption(ctx context.Context, cfg config.Auth) (jwt.ParseOption, error) {
+	var alg jwa.SignatureAlgorithm
+	err := alg.Accept(cfg.Algorithm)
+	if err != nil || alg == jwa.NoSignature {
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", cfg.Algorithm)
+	}
+
+	switch {
+	case strings.HasPrefix(alg.String(), "HS"):
+		if cfg.Secret == "" {
+			return nil, fmt.Errorf("JWT_ALGORITHM=%s requires JWT_SECRET", alg)
+		}
+		return jwt.WithKey(alg, []byte(cfg.Secret)), nil
+
+	case cfg.JWKSURL != "":
+		cache := jwk.NewCache(ctx)
+		client := &http.Client{Transport: tracing.Transport(http.DefaultTransport)}
+		err = cache.Register(cfg.JWKSURL, jwk.WithMinRefreshInterval(cfg.JWKSRefreshInterval), jwk.WithHTTPClient(client))
+		if err != nil {
+			return nil, err
+		}
+		_, err = cache.Refresh(ctx, cfg.JWKSURL)
+		if err != nil {
+			return nil, fmt.Errorf("fetch JWKS: %w", err)
+		}
+		return jwt.WithKeySet(jwk.NewCachedSet(cache, cfg.JWKSURL), jws.WithInferAlgorithmFromKey(true)), nil
+
+	case cfg.JWKSFile != "":
+		set, err := jwk.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("read JWKS file: %w", err)
+		}
+		return jwt.WithKeySet(set, jws.WithInferAlgorithmFromKey(true)), nil
+
+	case cfg.PublicKeyFile != "":
+		data, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read public key: %w", err)
+		}
+		key, err := jwk.ParseKey(data, jwk.WithPEM(true))
+		if err != nil {
+			return nil, fmt.Errorf("parse public key: %w", err)
+		}
+		return jwt.WithKey(alg, key), nil
+	}
+
+	return nil, fmt.Errorf("JWT_ALGORITHM=%s requires JWKS_URL, JWKS_FILE or JWT_PUBLIC_KEY_FILE", alg)
+}
+
+// Authenticate rejects requests without a valid bearer token and stores the
+// principal in the request context.
+func (a authenticator) Authenticate(next http.Handler) http.Handler {
+	return a.authenticate(next, false)
+}
+
+// Optional lets requests without a bearer token through anonymously, a token
+// that is present must still be valid.
+func (a authenticator) Optional(next http.Handler) http.Handler {
+	return a.authenticate(next, true)
+}
+
+func (a authenticator) authenticate(next http.Handler, optional bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := jwtauth.TokenFromHeader(r)
+		if token == "" && optional {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, err := a.Verify(token)
+		if err != nil {
+			logging.FromContext(r.Context(), a.logger).Warn().Timestamp().Msg(err.Error())
+			unauthorized(w, r, a.logger)
+			return
+		}
+
+		logging.FromContext(r.Context(), a.logger).UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("subject", principal.Subject)
+		})
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// Verify checks the token and returns the principal it was issued to.
+func (a authenticator) Verify(token string) (Principal, error) {
+	if token == "" {
+		return Principal{}, ErrMissingToken
+	}
+
+	if a.mode == ModeStatic {
+		switch {
+		case equalTokens(token, a.staticToken):
+			return Principal{Subject: StaticSubject, Scopes: []string{ScopeRead, ScopeWrite, ScopeDelete, ScopeWebhooks}}, nil
+		case a.adminToken != "" && equalTokens(token, a.adminToken):
+			return Principal{Subject: AdminSubject, Roles: []string{RoleAdmin}}, nil
+		}
+		return Principal{}, ErrInvalidToken
+	}
+
+	parsed, err := jwt.ParseString(token, a.options...)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if parsed.Subject() == "" {
+		return Principal{}, ErrNoSubject
+	}
+
+	return Principal{
+		Subject: parsed.Subject(),
+		Scopes:  append(claimValues(parsed, "scope"), claimValues(parsed, "scp")...),
+		Roles:   claimValues(parsed, "roles"),
+	}, nil
+}
+
+// equalTokens compares in constant time so the comparison does not reveal how
+// much of a guessed token matched.
+func equalTokens(token string, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// claimValues reads a claim that is either a space separated string, as the
+// OAuth 2.0 scope claim, or an array of strings.
+func claimValues(token jwt.Token, name string) []string {
+	claim, ok := token.Get(name)
+	if !ok {
+		return nil
+	}
+
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
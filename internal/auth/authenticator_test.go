@@ -0,0 +1,385 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/auth"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "test-secret"
+
+func hsConfig() config.Auth {
+	return config.Auth{
+		Mode:      auth.ModeJWT,
+		Algorithm: "HS256",
+		Secret:    secret,
+		Issuer:    "https://issuer.example.com",
+		Audience:  "xm",
+		ClockSkew: time.Second,
+	}
+}
+
+func signHS(t *testing.T, build func(*jwt.Builder) *jwt.Builder) string {
+	token, err := build(jwt.NewBuilder()).Build()
+	require.NoError(t, err)
+
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte(secret)))
+	require.NoError(t, err)
+
+	return string(signed)
+}
+
+func validClaims(b *jwt.Builder) *jwt.Builder {
+	return b.Subject("user-1").
+		Issuer("https://issuer.example.com").
+		Audience([]string{"xm"}).
+		Expiration(time.Now().Add(time.Minute))
+}
+
+func TestVerify(t *testing.T) {
+	cases := map[string]struct {
+		Token         func(t *testing.T) string
+		WantPrincipal auth.Principal
+		WantErr       bool
+	}{
+		"Valid": {
+			Token:         func(t *testing.T) string { return signHS(t, validClaims) },
+			WantPrincipal: auth.Principal{Subject: "user-1"},
+		},
+		"ScopeString": {
+			Token: func(t *testing.T) string {
+				return signHS(t, func(b *jwt.Builder) *jwt.Builder {
+					return validClaims(b).Claim("scope", "company:read company:write")
+				})
+			},
+			WantPrincipal: auth.Principal{Subject: "user-1", Scopes: []string{auth.ScopeRead, auth.ScopeWrite}},
+		},
+		"ScopeArrayAndRoles": {
+			Token: func(t *testing.T) string {
+				return signHS(t, func(b *jwt.Builder) *jwt.Builder {
+					return validClaims(b).
+						Claim("scp", []string{auth.ScopeDelete}).
+						Claim("roles", []string{auth.RoleAdmin})
+				})
+			},
+			WantPrincipal: auth.Principal{Subject: "user-1", Scopes: []string{auth.ScopeDelete}, Roles: []string{auth.RoleAdmin}},
+		},
+		"Missing": {
+			Token:   func(t *testing.T) string { return "" },
+			WantErr: true,
+		},
+		"Expired": {
+			Token: func(t *testing.T) string {
+				return signHS(t, func(b *jwt.Builder) *jwt.Builder {
+					return validClaims(b).Expiration(time.Now().Add(-time.Minute))
+				})
+			},
+			WantErr: true,
+		},
+		"NoExpiration": {
+			Token: func(t *testing.T) string {
+				return signHS(t, func(b *jwt.Builder) *jwt.Builder {
+					return b.Subject("user-1").
+						Issuer("https://issuer.example.com").
+						Audience([]string{"xm"})
+				})
+			},
+			WantErr: true,
+		},
+		"NotYetValid": {
+			Token: func(t *testing.T) string {
+				return signHS(t, func(b *jwt.Builder) *jwt.Builder {
+					return validClaims(b).NotBefore(time.Now().Add(time.Minute))
+				})
+			},
+			WantErr: true,
+		},
+		"WrongIssuer": {
+			Token: func(t *testing.T) string {
+				return signHS(t, func(b *jwt.Builder) *jwt.Builder {
+					return validClaims(b).Issuer("https://other.example.com")
+				})
+			},
+			WantErr: true,
+		},
+		"WrongAudience": {
+			Token: func(t *testing.T) string {
+				return signHS(t, func(b *jwt.Builder) *jwt.Builder {
+					return validClaims(b).Audience([]string{"other"})
+				})
+			},
+			WantErr: true,
+		},
+		"NoSubject": {
+			Token: func(t *testing.T) string {
+				return signHS(t, func(b *jwt.Builder) *jwt.Builder {
+					return validClaims(b).Subject("")
+				})
+			},
+			WantErr: true,
+		},
+		"WrongSignature": {
+			Token: func(t *testing.T) string {
+				token, err := validClaims(jwt.NewBuilder()).Build()
+				require.NoError(t, err)
+				signed, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte("other-secret")))
+				require.NoError(t, err)
+				return string(signed)
+			},
+			WantErr: true,
+		},
+		"Unsigned": {
+			Token: func(t *testing.T) string {
+				token, err := validClaims(jwt.NewBuilder()).Build()
+				require.NoError(t, err)
+				signed, err := jwt.NewSerializer().Serialize(token)
+				require.NoError(t, err)
+				return string(signed)
+			},
+			WantErr: true,
+		},
+	}
+
+	authenticator, err := auth.NewAuthenticator(context.Background(), config.Configuration{Auth: hsConfig()}, zerolog.Nop())
+	require.NoError(t, err)
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			principal, err := authenticator.Verify(tc.Token(t))
+			if tc.WantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.WantPrincipal, principal)
+		})
+	}
+}
+
+func TestVerifyRS256(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	pemFile := filepath.Join(dir, "public.pem")
+	require.NoError(t, os.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0o600))
+
+	signingKey, err := jwk.FromRaw(privateKey)
+	require.NoError(t, err)
+	require.NoError(t, signingKey.Set(jwk.KeyIDKey, "key-1"))
+	require.NoError(t, signingKey.Set(jwk.AlgorithmKey, jwa.RS256))
+
+	verificationKey, err := signingKey.PublicKey()
+	require.NoError(t, err)
+	set := jwk.NewSet()
+	require.NoError(t, set.AddKey(verificationKey))
+	jwks, err := json.Marshal(set)
+	require.NoError(t, err)
+
+	jwksFile := filepath.Join(dir, "jwks.json")
+	require.NoError(t, os.WriteFile(jwksFile, jwks, 0o600))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	token, err := validClaims(jwt.NewBuilder()).Build()
+	require.NoError(t, err)
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, signingKey))
+	require.NoError(t, err)
+
+	// An HS256 token signed with the public key must not be accepted.
+	confused, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, publicKey))
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		Config config.Auth
+	}{
+		"PublicKeyFile": {
+			Config: config.Auth{PublicKeyFile: pemFile},
+		},
+		"JWKSFile": {
+			Config: config.Auth{JWKSFile: jwksFile},
+		},
+		"JWKSURL": {
+			Config: config.Auth{JWKSURL: server.URL, JWKSRefreshInterval: time.Minute},
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			cfg := tc.Config
+			cfg.Mode = auth.ModeJWT
+			cfg.Algorithm = "RS256"
+			cfg.Issuer = "https://issuer.example.com"
+			cfg.Audience = "xm"
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			authenticator, err := auth.NewAuthenticator(ctx, config.Configuration{Auth: cfg}, zerolog.Nop())
+			require.NoError(t, err)
+
+			principal, err := authenticator.Verify(string(signed))
+			require.NoError(t, err)
+			require.Equal(t, "user-1", principal.Subject)
+
+			_, err = authenticator.Verify(string(confused))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	cases := map[string]struct {
+		Config      config.Auth
+		StaticToken string
+		WantErr     bool
+	}{
+		"HS256WithoutSecret": {
+			Config:  config.Auth{Mode: auth.ModeJWT, Algorithm: "HS256"},
+			WantErr: true,
+		},
+		"RS256WithoutKey": {
+			Config:  config.Auth{Mode: auth.ModeJWT, Algorithm: "RS256"},
+			WantErr: true,
+		},
+		"None": {
+			Config:  config.Auth{Mode: auth.ModeJWT, Algorithm: "none", Secret: secret},
+			WantErr: true,
+		},
+		"UnknownMode": {
+			Config:  config.Auth{Mode: "basic"},
+			WantErr: true,
+		},
+		"StaticWithoutToken": {
+			Config:  config.Auth{Mode: auth.ModeStatic},
+			WantErr: true,
+		},
+		"Static": {
+			Config:      config.Auth{Mode: auth.ModeStatic},
+			StaticToken: "token",
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			_, err := auth.NewAuthenticator(context.Background(), config.Configuration{Auth: tc.Config, Token: tc.StaticToken}, zerolog.Nop())
+			if tc.WantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	cases := map[string]struct {
+		Mode        string
+		Optional    bool
+		Header      string
+		WantCode    int
+		WantSubject string
+	}{
+		"JWT": {
+			Mode:        auth.ModeJWT,
+			Header:      "Bearer " + signHS(t, validClaims),
+			WantCode:    http.StatusOK,
+			WantSubject: "user-1",
+		},
+		"JWTInvalid": {
+			Mode:     auth.ModeJWT,
+			Header:   "Bearer token",
+			WantCode: http.StatusUnauthorized,
+		},
+		"JWTMissing": {
+			Mode:     auth.ModeJWT,
+			WantCode: http.StatusUnauthorized,
+		},
+		"OptionalMissing": {
+			Mode:     auth.ModeJWT,
+			Optional: true,
+			WantCode: http.StatusOK,
+		},
+		"OptionalInvalid": {
+			Mode:     auth.ModeJWT,
+			Optional: true,
+			Header:   "Bearer token",
+			WantCode: http.StatusUnauthorized,
+		},
+		"Static": {
+			Mode:        auth.ModeStatic,
+			Header:      "Bearer token",
+			WantCode:    http.StatusOK,
+			WantSubject: auth.StaticSubject,
+		},
+		"StaticAdmin": {
+			Mode:        auth.ModeStatic,
+			Header:      "Bearer admin",
+			WantCode:    http.StatusOK,
+			WantSubject: auth.AdminSubject,
+		},
+		"StaticInvalid": {
+			Mode:     auth.ModeStatic,
+			Header:   "Bearer other",
+			WantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			cfg := config.Configuration{Auth: hsConfig(), Token: "token", AdminToken: "admin"}
+			cfg.Auth.Mode = tc.Mode
+
+			authenticator, err := auth.NewAuthenticator(context.Background(), cfg, zerolog.Nop())
+			require.NoError(t, err)
+
+			var subject string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				subject = auth.Subject(r.Context())
+			})
+
+			handler := authenticator.Authenticate(next)
+			if tc.Optional {
+				handler = authenticator.Optional(next)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/company", nil)
+			if tc.Header != "" {
+				r.Header.Set("Authorization", tc.Header)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			require.Equal(t, tc.WantCode, w.Code)
+			require.Equal(t, tc.WantSubject, subject)
+			if tc.WantCode == http.StatusUnauthorized {
+				require.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package auth
+
+import "context"
+
+type contextKey struct{}
+
+var principalKey = contextKey{}
+
+const (
+	ScopeRead   = "company:read"
+	ScopeWrite  = "company:write"
+	ScopeDelete = "company:delete"
+
+	// ScopeWebhooks manages the webhook subscriptions of the principal.
+	ScopeWebhooks = "webhook:manage"
+
+	RoleAdmin = "admin"
+)
+
+// Principal is the authenticated caller and what it is allowed to do.
+type Principal struct {
+	Subject string
+	Scopes  []string
+	Roles   []string
+}
+
+// HasScope reports whether the principal was granted scope. Admins hold every
+// scope.
+func (p Principal) HasScope(scope string) bool {
+	return p.HasRole(RoleAdmin) || contains(p.Scopes, scope)
+}
+
+func (p Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFrom returns the authenticated caller, ok is false for anonymous
+// requests and background jobs.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(Principal)
+
+	return principal, ok
+}
+
+// Subject returns the authenticated caller, or an empty string for anonymous
+// requests and background jobs.
+func Subject(ctx context.Context) string {
+	principal, _ := PrincipalFrom(ctx)
+
+	return principal.Subject
+}
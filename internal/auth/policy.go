@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"xm/internal/handlers/problem"
+	"xm/internal/logging"
+
+	"github.com/rs/zerolog"
+)
+
+// RequireScope rejects requests whose principal lacks scope with 403.
+func RequireScope(scope string, logger zerolog.Logger) func(http.Handler) http.Handler {
+	return require(func(p Principal) bool { return p.HasScope(scope) },
+		fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope),
+		fmt.Sprintf("missing scope %s", scope),
+		logger)
+}
+
+// RequireRole rejects requests whose principal lacks role with 403.
+func RequireRole(role string, logger zerolog.Logger) func(http.Handler) http.Handler {
+	return require(func(p Principal) bool { return p.HasRole(role) },
+		`Bearer error="insufficient_scope"`,
+		fmt.Sprintf("missing role %s", role),
+		logger)
+}
+
+func require(allowed func(Principal) bool, challenge string, detail string, logger zerolog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := PrincipalFrom(r.Context())
+			if !ok {
+				unauthorized(w, r, logger)
+				return
+			}
+
+			if !allowed(principal) {
+				logging.FromContext(r.Context(), logger).Warn().Timestamp().Msg(detail)
+				w.Header().Set("WWW-Authenticate", challenge)
+				err := problem.Write(w, problem.New(r, http.StatusForbidden, problem.TypeForbidden, detail))
+				if err != nil {
+					logging.FromContext(r.Context(), logger).Warn().Timestamp().Msg(err.Error())
+				}
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, logger zerolog.Logger) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	err := problem.Write(w, problem.New(r, http.StatusUnauthorized, problem.TypeUnauthorized, "invalid token"))
+	if err != nil {
+		logging.FromContext(r.Context(), logger).Warn().Timestamp().Msg(err.Error())
+	}
+}
@@ -0,0 +1,72 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"xm/internal/auth"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequire(t *testing.T) {
+	cases := map[string]struct {
+		Middleware func(http.Handler) http.Handler
+		Principal  *auth.Principal
+		WantCode   int
+		WantDetail string
+	}{
+		"ScopeGranted": {
+			Middleware: auth.RequireScope(auth.ScopeWrite, zerolog.Nop()),
+			Principal:  &auth.Principal{Subject: "user-1", Scopes: []string{auth.ScopeRead, auth.ScopeWrite}},
+			WantCode:   http.StatusOK,
+		},
+		"ScopeMissing": {
+			Middleware: auth.RequireScope(auth.ScopeDelete, zerolog.Nop()),
+			Principal:  &auth.Principal{Subject: "user-1", Scopes: []string{auth.ScopeRead, auth.ScopeWrite}},
+			WantCode:   http.StatusForbidden,
+			WantDetail: "missing scope company:delete",
+		},
+		"AdminHasEveryScope": {
+			Middleware: auth.RequireScope(auth.ScopeDelete, zerolog.Nop()),
+			Principal:  &auth.Principal{Subject: "admin", Roles: []string{auth.RoleAdmin}},
+			WantCode:   http.StatusOK,
+		},
+		"RoleGranted": {
+			Middleware: auth.RequireRole(auth.RoleAdmin, zerolog.Nop()),
+			Principal:  &auth.Principal{Subject: "admin", Roles: []string{auth.RoleAdmin}},
+			WantCode:   http.StatusOK,
+		},
+		"RoleMissing": {
+			Middleware: auth.RequireRole(auth.RoleAdmin, zerolog.Nop()),
+			Principal:  &auth.Principal{Subject: "user-1", Scopes: []string{auth.ScopeRead, auth.ScopeWrite, auth.ScopeDelete}},
+			WantCode:   http.StatusForbidden,
+			WantDetail: "missing role admin",
+		},
+		"Anonymous": {
+			Middleware: auth.RequireScope(auth.ScopeRead, zerolog.Nop()),
+			WantCode:   http.StatusUnauthorized,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			handler := tc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(http.MethodDelete, "/v1/company/1", nil)
+			if tc.Principal != nil {
+				r = r.WithContext(auth.WithPrincipal(r.Context(), *tc.Principal))
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			require.Equal(t, tc.WantCode, w.Code)
+			if tc.WantDetail != "" {
+				require.Contains(t, w.Body.String(), tc.WantDetail)
+				require.Contains(t, w.Header().Get("WWW-Authenticate"), "insufficient_scope")
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+	"xm/internal/repositories/entities"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaSink keys messages by company ID, so the events of a company land on
+// one partition and keep their order.
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaSink(brokers []string, topic string) Sink {
+	return kafkaSink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// Events are written one at a time, waiting for a fuller batch would
+		// only delay them. The dispatcher retries failed events itself.
+		BatchTimeout: 10 * time.Millisecond,
+		MaxAttempts:  1,
+	}}
+}
+
+func (s kafkaSink) Publish(ctx context.Context, event entities.CompanyEvent) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(strconv.Itoa(event.CompanyId)),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "type", Value: []byte(event.Type)},
+			{Key: "schema_version", Value: []byte(strconv.Itoa(event.SchemaVersion))},
+		},
+	})
+}
+
+func (s kafkaSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"xm/internal/repositories/entities"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsSink publishes to JetStream on <subject>.<company ID>. The event ID is
+// the message ID, so JetStream drops redeliveries within its duplicate
+// window.
+type natsSink struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+}
+
+// NewNATSSink connects to url. A stream must capture <subject>.>, otherwise
+// publishing fails and the events stay in the outbox.
+func NewNATSSink(url string, subject string) (Sink, error) {
+	conn, err := nats.Connect(url, nats.Name("xm"))
+	if err != nil {
+		return nil, fmt.Errorf("connect to nats: %w", err)
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return natsSink{conn: conn, js: js, subject: subject}, nil
+}
+
+func (s natsSink) Publish(ctx context.Context, event entities.CompanyEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(fmt.Sprintf("%s.%d", s.subject, event.CompanyId))
+	msg.Data = data
+	msg.Header.Set(nats.MsgIdHdr, strconv.FormatInt(event.Id, 10))
+	msg.Header.Set("Event-Type", event.Type)
+	msg.Header.Set("Schema-Version", strconv.Itoa(event.SchemaVersion))
+
+	_, err = s.js.PublishMsg(msg, nats.Context(ctx))
+	return err
+}
+
+func (s natsSink) Close() error {
+	return s.conn.Drain()
+}
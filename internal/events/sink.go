@@ -0,0 +1,54 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"xm/config"
+	"xm/internal/repositories/entities"
+)
+
+const (
+	SinkNone   = "none"
+	SinkStdout = "stdout"
+	SinkFile   = "file"
+	SinkKafka  = "kafka"
+	SinkNATS   = "nats"
+)
+
+// Sink publishes company events. Publish returns once the destination has
+// accepted the event, the outbox entry is only removed after that.
+type Sink interface {
+	Publish(ctx context.Context, event entities.CompanyEvent) error
+	Close() error
+}
+
+// New returns the sink selected by OUTBOX_SINK, or nil when events are not
+// published.
+func New(cfg config.Outbox) (Sink, error) {
+	switch cfg.Sink {
+	case SinkNone, "":
+		return nil, nil
+	case SinkStdout:
+		return NewWriterSink(os.Stdout, nil), nil
+	case SinkFile:
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open event file: %w", err)
+		}
+		return NewWriterSink(file, file), nil
+	case SinkKafka:
+		if cfg.KafkaBrokers == "" {
+			return nil, fmt.Errorf("OUTBOX_SINK=%s requires KAFKA_BROKERS", SinkKafka)
+		}
+		return NewKafkaSink(strings.Split(cfg.KafkaBrokers, ","), cfg.KafkaTopic), nil
+	case SinkNATS:
+		if cfg.NATSURL == "" {
+			return nil, fmt.Errorf("OUTBOX_SINK=%s requires NATS_URL", SinkNATS)
+		}
+		return NewNATSSink(cfg.NATSURL, cfg.NATSSubject)
+	default:
+		return nil, fmt.Errorf("unknown OUTBOX_SINK %q", cfg.Sink)
+	}
+}
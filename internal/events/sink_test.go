@@ -0,0 +1,88 @@
+package events_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/events"
+	"xm/internal/repositories/entities"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "events.ndjson")
+
+	cases := map[string]struct {
+		cfg      config.Outbox
+		WantSink bool
+		WantErr  bool
+	}{
+		"none":                  {cfg: config.Outbox{Sink: events.SinkNone}},
+		"stdout":                {cfg: config.Outbox{Sink: events.SinkStdout}, WantSink: true},
+		"file":                  {cfg: config.Outbox{Sink: events.SinkFile, File: file}, WantSink: true},
+		"kafka without brokers": {cfg: config.Outbox{Sink: events.SinkKafka}, WantErr: true},
+		"nats without url":      {cfg: config.Outbox{Sink: events.SinkNATS}, WantErr: true},
+		"unknown":               {cfg: config.Outbox{Sink: "carrier-pigeon"}, WantErr: true},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			sink, err := events.New(tc.cfg)
+			if tc.WantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.WantSink, sink != nil)
+			if sink != nil {
+				assert.NoError(t, sink.Close())
+			}
+		})
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := events.NewWriterSink(&buf, nil)
+
+	occurredAt := time.Date(2023, 2, 16, 10, 12, 0, 0, time.UTC)
+	err := sink.Publish(context.Background(), entities.CompanyEvent{
+		Id:            7,
+		Type:          entities.EventCompanyCreated,
+		SchemaVersion: entities.EventSchemaVersion,
+		CompanyId:     1,
+		Version:       1,
+		Actor:         "sync",
+		RequestId:     "req-1",
+		OccurredAt:    occurredAt,
+		Company:       entities.Company{Id: 1, Name: "Acme", EmployeesAmount: 10, Registered: true, Type: "corporations", Version: 1},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, `{"id":7,"type":"CompanyCreated","schema_version":1,"company_id":1,"version":1,"actor":"sync","request_id":"req-1",`+
+		`"occurred_at":"2023-02-16T10:12:00Z","company":{"Id":1,"Name":"Acme","Description":"","EmployeesAmount":10,"Registered":true,"Type":"corporations","Version":1}}`+"\n",
+		buf.String())
+}
+
+func TestFileSinkAppends(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "events.ndjson")
+	cfg := config.Outbox{Sink: events.SinkFile, File: file}
+
+	for id := int64(1); id <= 2; id++ {
+		sink, err := events.New(cfg)
+		require.NoError(t, err)
+		require.NoError(t, sink.Publish(context.Background(), entities.CompanyEvent{Id: id}))
+		require.NoError(t, sink.Close())
+	}
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, 2, bytes.Count(data, []byte("\n")))
+}
@@ -0,0 +1,43 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"xm/internal/repositories/entities"
+)
+
+// writerSink writes one JSON event per line, for local runs and tests.
+type writerSink struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewWriterSink writes events to w. The closer, when not nil, is closed with
+// the sink.
+func NewWriterSink(w io.Writer, closer io.Closer) Sink {
+	return writerSink{mu: &sync.Mutex{}, w: w, closer: closer}
+}
+
+func (s writerSink) Publish(ctx context.Context, event entities.CompanyEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+func (s writerSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+
+	return s.closer.Close()
+}
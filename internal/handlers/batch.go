@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"xm/internal/auth"
+	"xm/internal/handlers/dto"
+	"xm/internal/handlers/problem"
+	"xm/internal/repositories"
+)
+
+var batchStatus = map[string]int{
+	dto.BatchCreate: http.StatusCreated,
+	dto.BatchUpdate: http.StatusOK,
+	dto.BatchDelete: http.StatusOK,
+}
+
+// LimitBatchBody caps the batch request body at BATCH_MAX_BODY_BYTES. It runs
+// before the idempotency middleware, which reads the whole body.
+func (h companyHandler) LimitBatchBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, h.batchMaxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BatchCompanies applies a batch of create, update and delete operations. An
+// atomic batch either applies every operation or fails with the problem of the
+// first failing one; a best effort batch applies what it can and reports the
+// status and error of every operation.
+func (h companyHandler) BatchCompanies(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var batch dto.Batch
+
+	err = json.NewDecoder(r.Body).Decode(&batch)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		h.errBatchTooLarge(w, r, fmt.Sprintf("batch body is larger than %d bytes", maxBytesErr.Limit))
+		return
+	}
+	if err != nil {
+		h.errValidateBatch(w, r, err)
+		return
+	}
+
+	if len(batch.Operations) > h.batchMaxOperations {
+		h.errBatchTooLarge(w, r, fmt.Sprintf("batch has %d operations, at most %d are allowed", len(batch.Operations), h.batchMaxOperations))
+		return
+	}
+
+	err = dto.Validator.Struct(batch)
+	if err != nil {
+		h.errValidateBatch(w, r, err)
+		return
+	}
+
+	p, ok := batchTargets(r, batch.Operations)
+	if !ok {
+		h.log(r).Warn().Timestamp().Msg(p.Detail)
+		h.writeProblem(w, r, p)
+		return
+	}
+
+	// The route requires the write scope, deleting needs its own.
+	principal, _ := auth.PrincipalFrom(r.Context())
+	if !principal.HasScope(auth.ScopeDelete) {
+		for i, op := range batch.Operations {
+			if op.Op == dto.BatchDelete {
+				h.errBatchForbidden(w, r, i)
+				return
+			}
+		}
+	}
+
+	results, err := h.companyRepository.BatchCompanies(r.Context(), batch.Operations, batch.Mode != dto.BatchBestEffort)
+
+	var batchErr *repositories.BatchError
+	if errors.As(err, &batchErr) {
+		p := repositoryProblem(r, batchErr.Err)
+		p.Detail = fmt.Sprintf("operation %d: %s", batchErr.Index, p.Detail)
+		h.log(r).Warn().Timestamp().Msg(err.Error())
+		h.writeProblem(w, r, p)
+		return
+	}
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	response := dto.BatchResponse{Results: make([]dto.BatchResult, 0, len(results))}
+	for i, result := range results {
+		op := batch.Operations[i]
+		item := dto.BatchResult{Index: i, Op: op.Op, Status: batchStatus[op.Op]}
+
+		switch {
+		case result.Err != nil:
+			p := repositoryProblem(r, result.Err)
+			item.Status = p.Status
+			item.Error = &dto.BatchError{Type: p.Type, Title: p.Title, Detail: p.Detail}
+		case op.Op != dto.BatchDelete:
+			company := result.Company
+			item.Company = &company
+		}
+
+		response.Results = append(response.Results, item)
+	}
+
+	h.writeJSON(w, r, http.StatusOK, response)
+}
+
+// batchTargets rejects batches that change the same company twice, the
+// operations of a batch are not applied in order.
+func batchTargets(r *http.Request, operations []dto.BatchOperation) (problem.Problem, bool) {
+	seen := map[int]bool{}
+	for i, op := range operations {
+		if op.Op == dto.BatchCreate {
+			continue
+		}
+
+		if seen[op.Id] {
+			p := problem.Validation(r, fmt.Sprintf("company %d is changed by more than one operation", op.Id), nil)
+			p.Errors = append(p.Errors, problem.FieldError{Field: fmt.Sprintf("operations[%d].id", i), Rule: "unique"})
+			return p, false
+		}
+		seen[op.Id] = true
+	}
+
+	return problem.Problem{}, true
+}
+
+func (h companyHandler) errValidateBatch(w http.ResponseWriter, r *http.Request, err error) {
+	h.log(r).Warn().Timestamp().Msg(err.Error())
+	h.writeProblem(w, r, problem.Validation(r, "invalid batch request body", err))
+}
+
+func (h companyHandler) errBatchTooLarge(w http.ResponseWriter, r *http.Request, detail string) {
+	h.log(r).Warn().Timestamp().Msg(detail)
+	h.writeProblem(w, r, problem.New(r, http.StatusRequestEntityTooLarge, problem.TypeTooLarge, detail))
+}
+
+func (h companyHandler) errBatchForbidden(w http.ResponseWriter, r *http.Request, index int) {
+	detail := fmt.Sprintf("operation %d: missing scope %s", index, auth.ScopeDelete)
+	h.log(r).Warn().Timestamp().Msg(detail)
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, auth.ScopeDelete))
+	h.writeProblem(w, r, problem.New(r, http.StatusForbidden, problem.TypeForbidden, detail))
+}
@@ -0,0 +1,184 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"xm/config"
+	"xm/internal/auth"
+	"xm/internal/handlers"
+	"xm/internal/handlers/dto"
+	"xm/internal/handlers/problem"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const batchCompany = `{"name":"Acme","description":"","employees_amount":10,"registered":true,"type":"corporations"}`
+
+func TestBatchCompanies(t *testing.T) {
+	writer := auth.Principal{Subject: "sync", Scopes: []string{auth.ScopeWrite}}
+	deleter := auth.Principal{Subject: "sync", Scopes: []string{auth.ScopeWrite, auth.ScopeDelete}}
+
+	cases := map[string]struct {
+		body        string
+		principal   auth.Principal
+		mocks       func(*MockcompanyRepository)
+		WantCode    int
+		WantDetail  string
+		WantField   string
+		WantResults []dto.BatchResult
+	}{
+		"atomic": {
+			body:      `{"operations":[{"op":"create","company":` + batchCompany + `},{"op":"delete","id":2,"version":3}]}`,
+			principal: deleter,
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().BatchCompanies(gomock.Any(), gomock.Len(2), true).Return([]entities.BatchResult{
+					{Company: entities.Company{Id: 1, Name: "Acme", Version: 1}},
+					{Company: entities.Company{Id: 2, Version: 4}},
+				}, nil)
+			},
+			WantCode: http.StatusOK,
+			WantResults: []dto.BatchResult{
+				{Index: 0, Op: dto.BatchCreate, Status: http.StatusCreated, Company: &entities.Company{Id: 1, Name: "Acme", Version: 1}},
+				{Index: 1, Op: dto.BatchDelete, Status: http.StatusOK},
+			},
+		},
+		"atomic failure": {
+			body:      `{"mode":"atomic","operations":[{"op":"create","company":` + batchCompany + `},{"op":"update","id":2,"company":` + batchCompany + `}]}`,
+			principal: writer,
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().BatchCompanies(gomock.Any(), gomock.Len(2), true).
+					Return(nil, &repositories.BatchError{Index: 1, Err: repositories.ErrCompanyNotFound})
+			},
+			WantCode:   http.StatusNotFound,
+			WantDetail: "operation 1: company not found",
+		},
+		"best effort": {
+			body:      `{"mode":"best_effort","operations":[{"op":"create","company":` + batchCompany + `},{"op":"update","id":2,"version":1,"company":` + batchCompany + `}]}`,
+			principal: writer,
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().BatchCompanies(gomock.Any(), gomock.Len(2), false).Return([]entities.BatchResult{
+					{Err: repositories.ErrDuplicateName},
+					{Err: repositories.ErrVersionMismatch},
+				}, nil)
+			},
+			WantCode: http.StatusOK,
+			WantResults: []dto.BatchResult{
+				{Index: 0, Op: dto.BatchCreate, Status: http.StatusConflict, Error: &dto.BatchError{
+					Type: problem.TypeConflict, Title: "Conflict", Detail: "company with this name already exists"}},
+				{Index: 1, Op: dto.BatchUpdate, Status: http.StatusPreconditionFailed, Error: &dto.BatchError{
+					Type: problem.TypePreconditionFailed, Title: "Precondition Failed", Detail: "company was modified, fetch it again to get the current ETag"}},
+			},
+		},
+		"storage unavailable": {
+			body:      `{"operations":[{"op":"create","company":` + batchCompany + `}]}`,
+			principal: writer,
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().BatchCompanies(gomock.Any(), gomock.Len(1), true).Return(nil, repositories.ErrUnavailable)
+			},
+			WantCode: http.StatusServiceUnavailable,
+		},
+		"delete without delete scope": {
+			body:       `{"operations":[{"op":"create","company":` + batchCompany + `},{"op":"delete","id":2}]}`,
+			principal:  writer,
+			WantCode:   http.StatusForbidden,
+			WantDetail: "operation 1: missing scope company:delete",
+		},
+		"too many operations": {
+			body:      `{"operations":[` + strings.Repeat(`{"op":"delete","id":1},`, 3) + `{"op":"delete","id":1}]}`,
+			principal: deleter,
+			WantCode:  http.StatusRequestEntityTooLarge,
+		},
+		"body too large": {
+			body:      `{"operations":[{"op":"create","company":{"name":"Acme","description":"` + strings.Repeat("a", 1024) + `"}}]}`,
+			principal: writer,
+			WantCode:  http.StatusRequestEntityTooLarge,
+		},
+		"same company twice": {
+			body:      `{"operations":[{"op":"update","id":2,"company":` + batchCompany + `},{"op":"delete","id":2}]}`,
+			principal: deleter,
+			WantCode:  http.StatusBadRequest,
+			WantField: "operations[1].id",
+		},
+		"update without company": {
+			body:      `{"operations":[{"op":"update","id":2}]}`,
+			principal: writer,
+			WantCode:  http.StatusBadRequest,
+			WantField: "operations[0].company",
+		},
+		"invalid company": {
+			body:      `{"operations":[{"op":"create","company":{"name":"Acme"}}]}`,
+			principal: writer,
+			WantCode:  http.StatusBadRequest,
+			WantField: "operations[0].company.employees_amount",
+		},
+		"unknown operation": {
+			body:      `{"operations":[{"op":"upsert","id":2}]}`,
+			principal: writer,
+			WantCode:  http.StatusBadRequest,
+			WantField: "operations[0].op",
+		},
+		"unknown mode": {
+			body:      `{"mode":"eventual","operations":[{"op":"delete","id":2}]}`,
+			principal: deleter,
+			WantCode:  http.StatusBadRequest,
+			WantField: "mode",
+		},
+		"empty": {
+			body:      `{"operations":[]}`,
+			principal: writer,
+			WantCode:  http.StatusBadRequest,
+			WantField: "operations",
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			companyRepository := NewMockcompanyRepository(ctrl)
+			if tc.mocks != nil {
+				tc.mocks(companyRepository)
+			}
+
+			cfg := config.Configuration{Batch: config.Batch{MaxOperations: 3, MaxBodyBytes: 1024}}
+			h := handlers.NewCompanyHandler(companyRepository, logger, cfg)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/company/batch", strings.NewReader(tc.body))
+			r = r.WithContext(auth.WithPrincipal(context.Background(), tc.principal))
+
+			h.LimitBatchBody(http.HandlerFunc(h.BatchCompanies)).ServeHTTP(w, r)
+
+			require.Equal(t, tc.WantCode, w.Code, w.Body.String())
+
+			if tc.WantResults != nil {
+				var response dto.BatchResponse
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+				assert.Equal(t, tc.WantResults, response.Results)
+				return
+			}
+
+			var p problem.Problem
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+			if tc.WantDetail != "" {
+				assert.Equal(t, tc.WantDetail, p.Detail)
+			}
+			if tc.WantField != "" {
+				require.NotEmpty(t, p.Errors)
+				assert.Equal(t, tc.WantField, p.Errors[0].Field)
+			}
+		})
+	}
+}
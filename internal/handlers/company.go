@@ -1,36 +1,77 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"xm/config"
 	"xm/internal/handlers/dto"
+	"xm/internal/handlers/problem"
+	"xm/internal/repositories"
 	"xm/internal/repositories/entities"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type companyRepository interface {
 	GetCompany(ctx context.Context, id int) (entities.Company, error)
+	GetCompanies(ctx context.Context, ids []int) ([]entities.Company, error)
 	CreateCompany(ctx context.Context, company dto.Company) (entities.Company, error)
-	DeleteCompany(ctx context.Context, id int) error
-	UpdateCompany(ctx context.Context, id int, company dto.Company) (entities.Company, error)
+	DeleteCompany(ctx context.Context, id int, version int) error
+	UpdateCompany(ctx context.Context, id int, version int, company dto.Company) (entities.Company, error)
+	ListCompanies(ctx context.Context, filter dto.CompanyFilter) ([]entities.Company, string, error)
+	PatchCompany(ctx context.Context, id int, version int, patch dto.CompanyPatch) (entities.Company, error)
+	RestoreCompany(ctx context.Context, id int) (entities.Company, error)
+	PurgeCompany(ctx context.Context, id int) error
+	BatchCompanies(ctx context.Context, operations []dto.BatchOperation, atomic bool) ([]entities.BatchResult, error)
+	ImportCompanies(ctx context.Context, rows []dto.CompanyImport, dryRun bool) ([]entities.BatchResult, error)
+	ListCompanyHistory(ctx context.Context, id int, limit int, cursor string) ([]entities.CompanyHistory, string, error)
+	GetCompanyHistory(ctx context.Context, id int, version int) (entities.CompanyHistory, error)
 }
 
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+const (
+	mediaTypeJSON       = "application/json"
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeJSONPatch  = "application/json-patch+json"
+)
+
 type companyHandler struct {
-	companyRepository companyRepository
-	logger            zerolog.Logger
-	ctx               context.Context
+	responder
+	companyRepository  companyRepository
+	requireIfMatch     bool
+	maxBodyBytes       int64
+	batchMaxOperations int
+	batchMaxBodyBytes  int64
+	importMaxRows      int
+	importMaxBodyBytes int64
 }
 
-func NewCompanyHandler(ctx context.Context, companyRepository companyRepository, logger zerolog.Logger) companyHandler {
+func NewCompanyHandler(companyRepository companyRepository, logger zerolog.Logger, cfg config.Configuration) companyHandler {
 	return companyHandler{
-		companyRepository: companyRepository,
-		logger:            logger,
-		ctx:               ctx,
+		responder:          responder{logger: logger},
+		companyRepository:  companyRepository,
+		requireIfMatch:     cfg.RequireIfMatch,
+		maxBodyBytes:       cfg.CompanyMaxBodyBytes,
+		batchMaxOperations: cfg.Batch.MaxOperations,
+		batchMaxBodyBytes:  cfg.Batch.MaxBodyBytes,
+		importMaxRows:      cfg.Import.MaxRows,
+		importMaxBodyBytes: cfg.Import.MaxBodyBytes,
 	}
 }
 
@@ -40,98 +81,93 @@ func (h companyHandler) GetCompany(w http.ResponseWriter, r *http.Request) {
 
 	id, err = strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.errCompanyId(w, err)
+		h.errCompanyId(w, r, err)
+		return
 	}
 
-	company, err := h.companyRepository.GetCompany(h.ctx, id)
-
+	company, err := h.companyRepository.GetCompany(r.Context(), id)
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
-		w.Header().Set("Content-Type", "application/json;charset=utf-8")
-		w.WriteHeader(http.StatusBadRequest)
-		_, err := w.Write([]byte(errors.New("error was occurred while fetching the company").Error()))
-		if err != nil {
-			h.logger.Info().Timestamp().Msg(err.Error())
-		}
+		h.errRepository(w, r, err)
 		return
 	}
 
-	if company.Id == 0 {
-		w.Header().Set("Content-Type", "application/json;charset=utf-8")
-		w.WriteHeader(http.StatusNoContent)
-		_, err := w.Write([]byte{})
-		if err != nil {
-			h.logger.Info().Timestamp().Msg(err.Error())
-		}
+	setETag(w, company)
+	if notModified(r, company) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	response, err := json.Marshal(company)
+	h.writeJSON(w, r, http.StatusOK, company)
+}
+
+func (h companyHandler) ListCompanies(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var filter dto.CompanyFilter
+
+	filter, err = parseCompanyFilter(r.URL.Query())
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
-		w.Header().Set("Content-Type", "application/json;charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		_, err := w.Write([]byte(errors.New("response marshal error").Error()))
-		if err != nil {
-			h.logger.Info().Timestamp().Msg(err.Error())
-		}
+		h.errCompanyFilter(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json;charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(response)
+	err = dto.Validator.Struct(filter)
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
+		h.errCompanyFilter(w, r, err)
+		return
+	}
+
+	companies, next, err := h.companyRepository.ListCompanies(r.Context(), filter)
+	if errors.Is(err, repositories.ErrInvalidCursor) {
+		h.errCompanyFilter(w, r, err)
+		return
 	}
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, dto.CompanyList{Companies: companies, NextCursor: next})
+}
+
+// LimitCompanyBody caps the body of a single company at
+// COMPANY_MAX_BODY_BYTES. It runs before the idempotency middleware, which
+// reads the whole body.
+func (h companyHandler) LimitCompanyBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (h companyHandler) CreateCompany(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var companyBody dto.Company
 	var company entities.Company
-	var response []byte
 
 	err = json.NewDecoder(r.Body).Decode(&companyBody)
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
+		h.errReadCompanyBody(w, r, err)
+		return
 	}
 
-	err = dto.Validator.Struct(companyBody)
-	if err != nil {
-		h.errValidateCompanyStruct(w, err)
-	}
+	trace.SpanFromContext(r.Context()).AddEvent("body decoded")
 
-	company, err = h.companyRepository.CreateCompany(h.ctx, companyBody)
+	err = dto.Validator.Struct(companyBody)
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
-		w.Header().Set("Content-Type", "application/json;charset=utf-8")
-		w.WriteHeader(http.StatusBadRequest)
-		_, err := w.Write([]byte(errors.New("response marshal error").Error()))
-		if err != nil {
-			h.logger.Info().Timestamp().Msg(err.Error())
-		}
+		h.errValidateCompanyStruct(w, r, err)
 		return
 	}
 
-	response, err = json.Marshal(company)
+	trace.SpanFromContext(r.Context()).AddEvent("body validated")
+
+	company, err = h.companyRepository.CreateCompany(r.Context(), companyBody)
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
-		w.Header().Set("Content-Type", "application/json;charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		_, err := w.Write([]byte(errors.New("response marshal error").Error()))
-		if err != nil {
-			h.logger.Info().Timestamp().Msg(err.Error())
-		}
+		h.errRepository(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json;charset=utf-8")
-	w.WriteHeader(http.StatusCreated)
-	_, err = w.Write(response)
-	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
-	}
+	setETag(w, company)
+	h.writeJSON(w, r, http.StatusCreated, company)
 }
 
 func (h companyHandler) DeleteCompany(w http.ResponseWriter, r *http.Request) {
@@ -140,25 +176,25 @@ func (h companyHandler) DeleteCompany(w http.ResponseWriter, r *http.Request) {
 
 	id, err = strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.errCompanyId(w, err)
+		h.errCompanyId(w, r, err)
+		return
 	}
 
-	err = h.companyRepository.DeleteCompany(h.ctx, id)
+	version, ok := h.ifMatchVersion(w, r, id)
+	if !ok {
+		return
+	}
+
+	err = h.companyRepository.DeleteCompany(r.Context(), id, version)
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
-		w.Header().Set("Content-Type", "application/json;charset=utf-8")
-		w.WriteHeader(http.StatusBadRequest)
-		_, err := w.Write([]byte(errors.New("can not delete the company").Error()))
-		if err != nil {
-			h.logger.Info().Timestamp().Msg(err.Error())
-		}
+		h.errRepository(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write([]byte{})
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
+		h.log(r).Warn().Timestamp().Msg(err.Error())
 	}
 }
 
@@ -170,67 +206,344 @@ func (h companyHandler) UpdateCompany(w http.ResponseWriter, r *http.Request) {
 
 	id, err = strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.errCompanyId(w, err)
+		h.errCompanyId(w, r, err)
+		return
+	}
+
+	version, ok := h.ifMatchVersion(w, r, id)
+	if !ok {
+		return
 	}
 
 	err = json.NewDecoder(r.Body).Decode(&companyBody)
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
+		h.errReadCompanyBody(w, r, err)
+		return
 	}
 
+	trace.SpanFromContext(r.Context()).AddEvent("body decoded")
+
 	err = dto.Validator.Struct(companyBody)
 	if err != nil {
-		h.errValidateCompanyStruct(w, err)
+		h.errValidateCompanyStruct(w, r, err)
+		return
 	}
 
-	company, err = h.companyRepository.UpdateCompany(h.ctx, id, companyBody)
+	trace.SpanFromContext(r.Context()).AddEvent("body validated")
+
+	company, err = h.companyRepository.UpdateCompany(r.Context(), id, version, companyBody)
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
-		w.Header().Set("Content-Type", "application/json;charset=utf-8")
-		w.WriteHeader(http.StatusBadRequest)
-		_, err := w.Write([]byte(errors.New("error was occurred while updating the company").Error()))
-		if err != nil {
-			h.logger.Info().Timestamp().Msg(err.Error())
-		}
+		h.errRepository(w, r, err)
 		return
 	}
 
-	response, err := json.Marshal(company)
+	setETag(w, company)
+	h.writeJSON(w, r, http.StatusOK, company)
+}
+
+func (h companyHandler) PatchCompany(w http.ResponseWriter, r *http.Request) {
+	var id int
+	var err error
+	var companyBody dto.Company
+	var company entities.Company
+
+	id, err = strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
-		w.Header().Set("Content-Type", "application/json;charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		_, err := w.Write([]byte(errors.New("response marshal error").Error()))
-		if err != nil {
-			h.logger.Info().Timestamp().Msg(err.Error())
+		h.errCompanyId(w, r, err)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != mediaTypeMergePatch && mediaType != mediaTypeJSONPatch && mediaType != mediaTypeJSON) {
+		h.writeProblem(w, r, problem.New(r, http.StatusUnsupportedMediaType, problem.TypeUnsupportedMedia,
+			fmt.Sprintf("use %s or %s", mediaTypeMergePatch, mediaTypeJSONPatch)))
+		return
+	}
+
+	version, ok := h.ifMatchVersion(w, r, id)
+	if !ok {
+		return
+	}
+
+	patchBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.errReadCompanyBody(w, r, err)
+		return
+	}
+
+	company, err = h.companyRepository.GetCompany(r.Context(), id)
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	if version != 0 && version != company.Version {
+		h.errPreconditionFailed(w, r)
+		return
+	}
+
+	original, err := json.Marshal(companyToDTO(company))
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	var merged []byte
+	if mediaType == mediaTypeJSONPatch {
+		var patch jsonpatch.Patch
+		patch, err = jsonpatch.DecodePatch(patchBody)
+		if err == nil {
+			merged, err = patch.Apply(original)
 		}
+	} else {
+		merged, err = jsonpatch.MergePatch(original, patchBody)
+	}
+	if err != nil {
+		h.log(r).Warn().Timestamp().Msg(err.Error())
+		h.writeProblem(w, r, problem.New(r, http.StatusUnprocessableEntity, problem.TypeInvalidPatch, "patch can not be applied to the company"))
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&companyBody)
+	if err != nil {
+		h.errValidateCompanyStruct(w, r, err)
+		return
+	}
+
+	trace.SpanFromContext(r.Context()).AddEvent("body decoded")
+
+	err = dto.Validator.Struct(companyBody)
+	if err != nil {
+		h.errValidateCompanyStruct(w, r, err)
+		return
+	}
+
+	trace.SpanFromContext(r.Context()).AddEvent("body validated")
+
+	company, err = h.companyRepository.PatchCompany(r.Context(), id, company.Version, diffCompany(company, companyBody))
+	if errors.Is(err, repositories.ErrVersionMismatch) && version == 0 {
+		h.writeProblem(w, r, problem.New(r, http.StatusConflict, problem.TypeConflict, "company was modified concurrently, retry the request"))
+		return
+	}
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	setETag(w, company)
+	h.writeJSON(w, r, http.StatusOK, company)
+}
+
+func (h companyHandler) RestoreCompany(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var id int
+
+	id, err = strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.errCompanyId(w, r, err)
+		return
+	}
+
+	company, err := h.companyRepository.RestoreCompany(r.Context(), id)
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	setETag(w, company)
+	h.writeJSON(w, r, http.StatusOK, company)
+}
+
+func (h companyHandler) PurgeCompany(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var id int
+
+	id, err = strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.errCompanyId(w, r, err)
+		return
+	}
+
+	err = h.companyRepository.PurgeCompany(r.Context(), id)
+	if err != nil {
+		h.errRepository(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json;charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(response)
+	_, err = w.Write([]byte{})
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
+		h.log(r).Warn().Timestamp().Msg(err.Error())
 	}
 }
 
-func (h companyHandler) errCompanyId(w http.ResponseWriter, err error) {
-	h.logger.Info().Timestamp().Msg(err.Error())
-	w.Header().Set("Content-Type", "application/json;charset=utf-8")
-	w.WriteHeader(http.StatusBadRequest)
-	_, err = w.Write([]byte(errors.New("invalid company ID").Error()))
+func (h companyHandler) ListCompanyHistory(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var id int
+
+	id, err = strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		h.errCompanyId(w, r, err)
+		return
+	}
+
+	limit := defaultListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			h.writeProblem(w, r, problem.New(r, http.StatusBadRequest, problem.TypeValidation,
+				fmt.Sprintf("limit must be between 1 and %d", maxListLimit)))
+			return
+		}
+	}
+
+	history, next, err := h.companyRepository.ListCompanyHistory(r.Context(), id, limit, r.URL.Query().Get("cursor"))
+	if errors.Is(err, repositories.ErrInvalidCursor) {
+		h.errCompanyFilter(w, r, err)
+		return
+	}
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
+		h.errRepository(w, r, err)
+		return
 	}
+
+	h.writeJSON(w, r, http.StatusOK, dto.CompanyHistoryList{History: history, NextCursor: next})
 }
 
-func (h companyHandler) errValidateCompanyStruct(w http.ResponseWriter, err error) {
-	h.logger.Info().Timestamp().Msg(err.Error())
-	w.Header().Set("Content-Type", "application/json;charset=utf-8")
-	w.WriteHeader(http.StatusBadRequest)
-	_, err = w.Write([]byte(errors.New("invalid company request body").Error()))
+func (h companyHandler) GetCompanyHistory(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var id int
+	var version int
+
+	id, err = strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		h.logger.Info().Timestamp().Msg(err.Error())
+		h.errCompanyId(w, r, err)
+		return
 	}
+
+	version, err = strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		h.writeProblem(w, r, problem.New(r, http.StatusBadRequest, problem.TypeValidation, "invalid company version"))
+		return
+	}
+
+	entry, err := h.companyRepository.GetCompanyHistory(r.Context(), id, version)
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, entry)
+}
+
+func (h companyHandler) errCompanyId(w http.ResponseWriter, r *http.Request, err error) {
+	h.log(r).Warn().Timestamp().Msg(err.Error())
+	h.writeProblem(w, r, problem.New(r, http.StatusBadRequest, problem.TypeValidation, "invalid company ID"))
+}
+
+func (h companyHandler) errCompanyFilter(w http.ResponseWriter, r *http.Request, err error) {
+	h.log(r).Warn().Timestamp().Msg(err.Error())
+	h.writeProblem(w, r, problem.Validation(r, "invalid company list parameters", err))
+}
+
+func (h companyHandler) errValidateCompanyStruct(w http.ResponseWriter, r *http.Request, err error) {
+	h.log(r).Warn().Timestamp().Msg(err.Error())
+	h.writeProblem(w, r, problem.Validation(r, "invalid company request body", err))
+}
+
+// errReadCompanyBody reports a body that could not be read, 413 when it is
+// larger than COMPANY_MAX_BODY_BYTES.
+func (h companyHandler) errReadCompanyBody(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		detail := fmt.Sprintf("company body is larger than %d bytes", maxBytesErr.Limit)
+		h.log(r).Warn().Timestamp().Msg(detail)
+		h.writeProblem(w, r, problem.New(r, http.StatusRequestEntityTooLarge, problem.TypeTooLarge, detail))
+		return
+	}
+
+	h.errValidateCompanyStruct(w, r, err)
+}
+
+func parseCompanyFilter(q url.Values) (dto.CompanyFilter, error) {
+	filter := dto.CompanyFilter{
+		Type:       q.Get("type"),
+		NamePrefix: q.Get("name_prefix"),
+		Sort:       "id",
+		Limit:      defaultListLimit,
+		Cursor:     q.Get("cursor"),
+	}
+
+	if v := q.Get("registered"); v != "" {
+		registered, err := strconv.ParseBool(v)
+		if err != nil {
+			return dto.CompanyFilter{}, fmt.Errorf("registered: %w", err)
+		}
+		filter.Registered = &registered
+	}
+
+	if v := q.Get("employees_amount_min"); v != "" {
+		min, err := strconv.Atoi(v)
+		if err != nil {
+			return dto.CompanyFilter{}, fmt.Errorf("employees_amount_min: %w", err)
+		}
+		filter.EmployeesAmountMin = &min
+	}
+
+	if v := q.Get("employees_amount_max"); v != "" {
+		max, err := strconv.Atoi(v)
+		if err != nil {
+			return dto.CompanyFilter{}, fmt.Errorf("employees_amount_max: %w", err)
+		}
+		filter.EmployeesAmountMax = &max
+	}
+
+	if v := q.Get("sort"); v != "" {
+		filter.Desc = strings.HasPrefix(v, "-")
+		filter.Sort = strings.TrimPrefix(v, "-")
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return dto.CompanyFilter{}, fmt.Errorf("limit: %w", err)
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
+}
+
+func companyToDTO(c entities.Company) dto.Company {
+	return dto.Company{
+		Name:            c.Name,
+		Description:     c.Description,
+		EmployeesAmount: c.EmployeesAmount,
+		Registered:      c.Registered,
+		Type:            c.Type,
+	}
+}
+
+func diffCompany(current entities.Company, updated dto.Company) dto.CompanyPatch {
+	var patch dto.CompanyPatch
+
+	if updated.Name != current.Name {
+		patch.Name = &updated.Name
+	}
+	if updated.Description != current.Description {
+		patch.Description = &updated.Description
+	}
+	if updated.EmployeesAmount != current.EmployeesAmount {
+		patch.EmployeesAmount = &updated.EmployeesAmount
+	}
+	if updated.Registered != current.Registered {
+		patch.Registered = &updated.Registered
+	}
+	if updated.Type != current.Type {
+		patch.Type = &updated.Type
+	}
+
+	return patch
 }
@@ -36,6 +36,21 @@ func (m *MockcompanyRepository) EXPECT() *MockcompanyRepositoryMockRecorder {
 	return m.recorder
 }
 
+// BatchCompanies mocks base method.
+func (m *MockcompanyRepository) BatchCompanies(ctx context.Context, operations []dto.BatchOperation, atomic bool) ([]entities.BatchResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BatchCompanies", ctx, operations, atomic)
+	ret0, _ := ret[0].([]entities.BatchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BatchCompanies indicates an expected call of BatchCompanies.
+func (mr *MockcompanyRepositoryMockRecorder) BatchCompanies(ctx, operations, atomic interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BatchCompanies", reflect.TypeOf((*MockcompanyRepository)(nil).BatchCompanies), ctx, operations, atomic)
+}
+
 // CreateCompany mocks base method.
 func (m *MockcompanyRepository) CreateCompany(ctx context.Context, company dto.Company) (entities.Company, error) {
 	m.ctrl.T.Helper()
@@ -52,17 +67,32 @@ func (mr *MockcompanyRepositoryMockRecorder) CreateCompany(ctx, company interfac
 }
 
 // DeleteCompany mocks base method.
-func (m *MockcompanyRepository) DeleteCompany(ctx context.Context, id int) error {
+func (m *MockcompanyRepository) DeleteCompany(ctx context.Context, id, version int) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteCompany", ctx, id)
+	ret := m.ctrl.Call(m, "DeleteCompany", ctx, id, version)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteCompany indicates an expected call of DeleteCompany.
-func (mr *MockcompanyRepositoryMockRecorder) DeleteCompany(ctx, id interface{}) *gomock.Call {
+func (mr *MockcompanyRepositoryMockRecorder) DeleteCompany(ctx, id, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCompany", reflect.TypeOf((*MockcompanyRepository)(nil).DeleteCompany), ctx, id, version)
+}
+
+// GetCompanies mocks base method.
+func (m *MockcompanyRepository) GetCompanies(ctx context.Context, ids []int) ([]entities.Company, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCompanies", ctx, ids)
+	ret0, _ := ret[0].([]entities.Company)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCompanies indicates an expected call of GetCompanies.
+func (mr *MockcompanyRepositoryMockRecorder) GetCompanies(ctx, ids interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCompany", reflect.TypeOf((*MockcompanyRepository)(nil).DeleteCompany), ctx, id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCompanies", reflect.TypeOf((*MockcompanyRepository)(nil).GetCompanies), ctx, ids)
 }
 
 // GetCompany mocks base method.
@@ -80,17 +110,123 @@ func (mr *MockcompanyRepositoryMockRecorder) GetCompany(ctx, id interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCompany", reflect.TypeOf((*MockcompanyRepository)(nil).GetCompany), ctx, id)
 }
 
+// GetCompanyHistory mocks base method.
+func (m *MockcompanyRepository) GetCompanyHistory(ctx context.Context, id, version int) (entities.CompanyHistory, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCompanyHistory", ctx, id, version)
+	ret0, _ := ret[0].(entities.CompanyHistory)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCompanyHistory indicates an expected call of GetCompanyHistory.
+func (mr *MockcompanyRepositoryMockRecorder) GetCompanyHistory(ctx, id, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCompanyHistory", reflect.TypeOf((*MockcompanyRepository)(nil).GetCompanyHistory), ctx, id, version)
+}
+
+// ImportCompanies mocks base method.
+func (m *MockcompanyRepository) ImportCompanies(ctx context.Context, rows []dto.CompanyImport, dryRun bool) ([]entities.BatchResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImportCompanies", ctx, rows, dryRun)
+	ret0, _ := ret[0].([]entities.BatchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImportCompanies indicates an expected call of ImportCompanies.
+func (mr *MockcompanyRepositoryMockRecorder) ImportCompanies(ctx, rows, dryRun interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImportCompanies", reflect.TypeOf((*MockcompanyRepository)(nil).ImportCompanies), ctx, rows, dryRun)
+}
+
+// ListCompanies mocks base method.
+func (m *MockcompanyRepository) ListCompanies(ctx context.Context, filter dto.CompanyFilter) ([]entities.Company, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCompanies", ctx, filter)
+	ret0, _ := ret[0].([]entities.Company)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListCompanies indicates an expected call of ListCompanies.
+func (mr *MockcompanyRepositoryMockRecorder) ListCompanies(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCompanies", reflect.TypeOf((*MockcompanyRepository)(nil).ListCompanies), ctx, filter)
+}
+
+// ListCompanyHistory mocks base method.
+func (m *MockcompanyRepository) ListCompanyHistory(ctx context.Context, id, limit int, cursor string) ([]entities.CompanyHistory, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCompanyHistory", ctx, id, limit, cursor)
+	ret0, _ := ret[0].([]entities.CompanyHistory)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListCompanyHistory indicates an expected call of ListCompanyHistory.
+func (mr *MockcompanyRepositoryMockRecorder) ListCompanyHistory(ctx, id, limit, cursor interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCompanyHistory", reflect.TypeOf((*MockcompanyRepository)(nil).ListCompanyHistory), ctx, id, limit, cursor)
+}
+
+// PatchCompany mocks base method.
+func (m *MockcompanyRepository) PatchCompany(ctx context.Context, id, version int, patch dto.CompanyPatch) (entities.Company, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PatchCompany", ctx, id, version, patch)
+	ret0, _ := ret[0].(entities.Company)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PatchCompany indicates an expected call of PatchCompany.
+func (mr *MockcompanyRepositoryMockRecorder) PatchCompany(ctx, id, version, patch interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchCompany", reflect.TypeOf((*MockcompanyRepository)(nil).PatchCompany), ctx, id, version, patch)
+}
+
+// PurgeCompany mocks base method.
+func (m *MockcompanyRepository) PurgeCompany(ctx context.Context, id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeCompany", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PurgeCompany indicates an expected call of PurgeCompany.
+func (mr *MockcompanyRepositoryMockRecorder) PurgeCompany(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeCompany", reflect.TypeOf((*MockcompanyRepository)(nil).PurgeCompany), ctx, id)
+}
+
+// RestoreCompany mocks base method.
+func (m *MockcompanyRepository) RestoreCompany(ctx context.Context, id int) (entities.Company, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreCompany", ctx, id)
+	ret0, _ := ret[0].(entities.Company)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreCompany indicates an expected call of RestoreCompany.
+func (mr *MockcompanyRepositoryMockRecorder) RestoreCompany(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreCompany", reflect.TypeOf((*MockcompanyRepository)(nil).RestoreCompany), ctx, id)
+}
+
 // UpdateCompany mocks base method.
-func (m *MockcompanyRepository) UpdateCompany(ctx context.Context, id int, company dto.Company) (entities.Company, error) {
+func (m *MockcompanyRepository) UpdateCompany(ctx context.Context, id, version int, company dto.Company) (entities.Company, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateCompany", ctx, id, company)
+	ret := m.ctrl.Call(m, "UpdateCompany", ctx, id, version, company)
 	ret0, _ := ret[0].(entities.Company)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UpdateCompany indicates an expected call of UpdateCompany.
-func (mr *MockcompanyRepositoryMockRecorder) UpdateCompany(ctx, id, company interface{}) *gomock.Call {
+func (mr *MockcompanyRepositoryMockRecorder) UpdateCompany(ctx, id, version, company interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCompany", reflect.TypeOf((*MockcompanyRepository)(nil).UpdateCompany), ctx, id, company)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCompany", reflect.TypeOf((*MockcompanyRepository)(nil).UpdateCompany), ctx, id, version, company)
 }
@@ -6,21 +6,24 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"xm/config"
 	"xm/internal/handlers"
 	"xm/internal/handlers/dto"
+	"xm/internal/handlers/problem"
+	"xm/internal/idempotency"
+	"xm/internal/repositories"
 	"xm/internal/repositories/entities"
 
 	"github.com/go-chi/chi/v5"
 	gomock "github.com/golang/mock/gomock"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetCompany(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	cases := map[string]struct {
 		mocks     func(*MockcompanyRepository)
 		WantCode  int
@@ -28,7 +31,7 @@ func TestGetCompany(t *testing.T) {
 	}{
 		"success": {
 			mocks: func(mr *MockcompanyRepository) {
-				mr.EXPECT().GetCompany(ctx, 1).Return(entities.Company{
+				mr.EXPECT().GetCompany(gomock.Any(), 1).Return(entities.Company{
 					Id:              1,
 					Name:            "Test Company",
 					Description:     "Test",
@@ -40,6 +43,45 @@ func TestGetCompany(t *testing.T) {
 			WantCode:  200,
 			CompanyID: "1",
 		},
+		"not found": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 2).Return(entities.Company{}, repositories.ErrCompanyNotFound)
+			},
+			WantCode:  404,
+			CompanyID: "2",
+		},
+		"database unavailable": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 3).Return(entities.Company{}, repositories.ErrUnavailable)
+			},
+			WantCode:  503,
+			CompanyID: "3",
+		},
+		"deleted": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 4).Return(entities.Company{}, repositories.ErrCompanyDeleted)
+			},
+			WantCode:  410,
+			CompanyID: "4",
+		},
+		"query timeout": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 5).Return(entities.Company{}, repositories.ErrTimeout)
+			},
+			WantCode:  503,
+			CompanyID: "5",
+		},
+		"client gone": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 6).Return(entities.Company{}, repositories.ErrCanceled)
+			},
+			WantCode:  499,
+			CompanyID: "6",
+		},
+		"invalid id": {
+			WantCode:  400,
+			CompanyID: "abc",
+		},
 	}
 
 	for testName, tc := range cases {
@@ -67,25 +109,26 @@ func TestGetCompany(t *testing.T) {
 
 			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
 
-			handlers := handlers.NewCompanyHandler(ctx, companyRepository, logger)
+			handlers := handlers.NewCompanyHandler(companyRepository, logger, config.Configuration{})
 			handler := http.HandlerFunc(handlers.GetCompany)
 			handler.ServeHTTP(w, r)
 
-			res := w.Result()
-			err := json.NewDecoder(res.Body).Decode(&companyBody)
-			if err != nil {
-				t.Error("error decode response body")
-			}
-
 			assert.Equal(t, tc.WantCode, w.Code)
-			assert.Equal(t, companyBody.Name, "Test Company")
+
+			if tc.WantCode == http.StatusOK {
+				res := w.Result()
+				err := json.NewDecoder(res.Body).Decode(&companyBody)
+				if err != nil {
+					t.Error("error decode response body")
+				}
+
+				assert.Equal(t, companyBody.Name, "Test Company")
+			}
 		})
 	}
 }
 
 func TestDeleteCompany(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
 
 	cases := map[string]struct {
 		mocks     func(*MockcompanyRepository)
@@ -94,11 +137,18 @@ func TestDeleteCompany(t *testing.T) {
 	}{
 		"success": {
 			mocks: func(mr *MockcompanyRepository) {
-				mr.EXPECT().DeleteCompany(ctx, 1).Return(nil)
+				mr.EXPECT().DeleteCompany(gomock.Any(), 1, 0).Return(nil)
 			},
 			WantCode:  200,
 			CompanyID: "1",
 		},
+		"not found": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().DeleteCompany(gomock.Any(), 2, 0).Return(repositories.ErrCompanyNotFound)
+			},
+			WantCode:  404,
+			CompanyID: "2",
+		},
 	}
 
 	for testName, tc := range cases {
@@ -125,7 +175,7 @@ func TestDeleteCompany(t *testing.T) {
 
 			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
 
-			handlers := handlers.NewCompanyHandler(ctx, companyRepository, logger)
+			handlers := handlers.NewCompanyHandler(companyRepository, logger, config.Configuration{})
 			handler := http.HandlerFunc(handlers.DeleteCompany)
 			handler.ServeHTTP(w, r)
 
@@ -135,8 +185,6 @@ func TestDeleteCompany(t *testing.T) {
 }
 
 func TestUpdateCompany(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
 	dtoCompany := dto.Company{
 		Name:            "Test Company2",
 		Description:     "Test",
@@ -152,7 +200,7 @@ func TestUpdateCompany(t *testing.T) {
 	}{
 		"success": {
 			mocks: func(mr *MockcompanyRepository) {
-				mr.EXPECT().UpdateCompany(ctx, 1, dtoCompany).Return(entities.Company{
+				mr.EXPECT().UpdateCompany(gomock.Any(), 1, 0, dtoCompany).Return(entities.Company{
 					Id:              1,
 					Name:            "Test Company2",
 					Description:     "Test",
@@ -204,7 +252,7 @@ func TestUpdateCompany(t *testing.T) {
 
 			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
 
-			handlers := handlers.NewCompanyHandler(ctx, companyRepository, logger)
+			handlers := handlers.NewCompanyHandler(companyRepository, logger, config.Configuration{})
 			handler := http.HandlerFunc(handlers.UpdateCompany)
 			handler.ServeHTTP(w, r)
 
@@ -221,8 +269,6 @@ func TestUpdateCompany(t *testing.T) {
 }
 
 func TestCreateCompany(t *testing.T) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
 	dtoCompany := dto.Company{
 		Name:            "Test Company3",
 		Description:     "Test",
@@ -237,7 +283,7 @@ func TestCreateCompany(t *testing.T) {
 	}{
 		"success": {
 			mocks: func(mr *MockcompanyRepository) {
-				mr.EXPECT().CreateCompany(ctx, dtoCompany).Return(entities.Company{
+				mr.EXPECT().CreateCompany(gomock.Any(), dtoCompany).Return(entities.Company{
 					Id:              1,
 					Name:            "Test Company3",
 					Description:     "Test",
@@ -287,7 +333,7 @@ func TestCreateCompany(t *testing.T) {
 
 			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
 
-			handlers := handlers.NewCompanyHandler(ctx, companyRepository, logger)
+			handlers := handlers.NewCompanyHandler(companyRepository, logger, config.Configuration{})
 			handler := http.HandlerFunc(handlers.CreateCompany)
 			handler.ServeHTTP(w, r)
 
@@ -302,3 +348,559 @@ func TestCreateCompany(t *testing.T) {
 		})
 	}
 }
+
+func TestListCompanies(t *testing.T) {
+	registered := true
+	min := 5
+
+	cases := map[string]struct {
+		mocks    func(*MockcompanyRepository)
+		WantCode int
+		Query    string
+		WantNext string
+	}{
+		"success": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().ListCompanies(gomock.Any(), dto.CompanyFilter{
+					Type:               "corporations",
+					Registered:         &registered,
+					NamePrefix:         "Test",
+					EmployeesAmountMin: &min,
+					Sort:               "name",
+					Desc:               true,
+					Limit:              1,
+				}).Return([]entities.Company{{
+					Id:              1,
+					Name:            "Test Company",
+					Description:     "Test",
+					EmployeesAmount: 10,
+					Registered:      true,
+					Type:            "corporations",
+				}}, "next", nil)
+			},
+			WantCode: 200,
+			Query:    "?type=corporations&registered=true&name_prefix=Test&employees_amount_min=5&sort=-name&limit=1",
+			WantNext: "next",
+		},
+		"invalid sort": {
+			WantCode: 400,
+			Query:    "?sort=unknown",
+		},
+		"invalid limit": {
+			WantCode: 400,
+			Query:    "?limit=1000",
+		},
+		"invalid cursor": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().ListCompanies(gomock.Any(), gomock.Any()).Return(nil, "", repositories.ErrInvalidCursor)
+			},
+			WantCode: 400,
+			Query:    "?cursor=broken",
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			companyRepository := NewMockcompanyRepository(ctrl)
+
+			if tc.mocks != nil {
+				tc.mocks(companyRepository)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/company"+tc.Query, nil).WithContext(ctx)
+
+			handlers := handlers.NewCompanyHandler(companyRepository, logger, config.Configuration{})
+			handler := http.HandlerFunc(handlers.ListCompanies)
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.WantCode, w.Code)
+
+			if tc.WantCode == http.StatusOK {
+				var list dto.CompanyList
+				err := json.NewDecoder(w.Result().Body).Decode(&list)
+				if err != nil {
+					t.Error("error decode response body")
+				}
+
+				assert.Len(t, list.Companies, 1)
+				assert.Equal(t, tc.WantNext, list.NextCursor)
+			}
+		})
+	}
+}
+
+func TestCreateCompanyValidation(t *testing.T) {
+	var logger zerolog.Logger
+	var body problem.Problem
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	companyRepository := NewMockcompanyRepository(ctrl)
+
+	bodySend, err := json.Marshal(map[string]interface{}{
+		"name":             "Too Long Company Name",
+		"employees_amount": 10,
+		"registered":       true,
+	})
+	if err != nil {
+		t.Error("error marshal request body")
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/company", bytes.NewReader(bodySend)).WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json;charset=utf-8")
+
+	handlers := handlers.NewCompanyHandler(companyRepository, logger, config.Configuration{})
+	handler := http.HandlerFunc(handlers.CreateCompany)
+	handler.ServeHTTP(w, r)
+
+	err = json.NewDecoder(w.Result().Body).Decode(&body)
+	if err != nil {
+		t.Error("error decode response body")
+	}
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusBadRequest, body.Status)
+	assert.Equal(t, "/v1/company", body.Instance)
+	assert.ElementsMatch(t, []problem.FieldError{
+		{Field: "name", Rule: "max", Param: "15"},
+		{Field: "type", Rule: "required"},
+	}, body.Errors)
+}
+
+func TestCreateCompanyBodyTooLarge(t *testing.T) {
+	cases := map[string]struct {
+		IdempotencyKey string
+	}{
+		"without idempotency key": {},
+		// The idempotency middleware reads the body before the handler.
+		"with idempotency key": {IdempotencyKey: "key-1"},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+			var body problem.Problem
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			companyRepository := NewMockcompanyRepository(ctrl)
+			h := handlers.NewCompanyHandler(companyRepository, logger, config.Configuration{CompanyMaxBodyBytes: 64})
+
+			bodySend := `{"name":"Acme","description":"` + strings.Repeat("a", 128) + `"}`
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/company", strings.NewReader(bodySend))
+			r.Header.Set("Content-Type", "application/json;charset=utf-8")
+			if tc.IdempotencyKey != "" {
+				r.Header.Set(idempotency.HeaderKey, tc.IdempotencyKey)
+			}
+
+			// No store is needed, the key must not be reserved.
+			idempotent := idempotency.Middleware(nil, config.Idempotency{}, logger)
+			h.LimitCompanyBody(idempotent(http.HandlerFunc(h.CreateCompany))).ServeHTTP(w, r)
+
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+			assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+			assert.Equal(t, problem.TypeTooLarge, body.Type)
+		})
+	}
+}
+
+func TestPatchCompany(t *testing.T) {
+	description := "Patched"
+	current := entities.Company{
+		Id:              1,
+		Name:            "Test Company",
+		Description:     "Test",
+		EmployeesAmount: 10,
+		Registered:      true,
+		Type:            "corporations",
+		Version:         3,
+	}
+	patched := current
+	patched.Description = description
+
+	cases := map[string]struct {
+		mocks       func(*MockcompanyRepository)
+		WantCode    int
+		ContentType string
+		Body        string
+	}{
+		"merge patch": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 1).Return(current, nil)
+				mr.EXPECT().PatchCompany(gomock.Any(), 1, 3, dto.CompanyPatch{Description: &description}).Return(patched, nil)
+			},
+			WantCode:    200,
+			ContentType: "application/merge-patch+json",
+			Body:        `{"description": "Patched"}`,
+		},
+		"json patch": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 1).Return(current, nil)
+				mr.EXPECT().PatchCompany(gomock.Any(), 1, 3, dto.CompanyPatch{Description: &description}).Return(patched, nil)
+			},
+			WantCode:    200,
+			ContentType: "application/json-patch+json",
+			Body:        `[{"op": "replace", "path": "/description", "value": "Patched"}]`,
+		},
+		"merged result is invalid": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 1).Return(current, nil)
+			},
+			WantCode:    400,
+			ContentType: "application/merge-patch+json",
+			Body:        `{"name": null}`,
+		},
+		"failed json patch test": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 1).Return(current, nil)
+			},
+			WantCode:    422,
+			ContentType: "application/json-patch+json",
+			Body:        `[{"op": "test", "path": "/name", "value": "Other"}]`,
+		},
+		"unsupported media type": {
+			WantCode:    415,
+			ContentType: "text/plain",
+			Body:        `description=Patched`,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			companyRepository := NewMockcompanyRepository(ctrl)
+
+			if tc.mocks != nil {
+				tc.mocks(companyRepository)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPatch, "/v1/company/{id}", bytes.NewReader([]byte(tc.Body))).WithContext(ctx)
+			r.Header.Set("Content-Type", tc.ContentType)
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "1")
+
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			handlers := handlers.NewCompanyHandler(companyRepository, logger, config.Configuration{})
+			handler := http.HandlerFunc(handlers.PatchCompany)
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.WantCode, w.Code)
+
+			if tc.WantCode == http.StatusOK {
+				var companyBody dto.Company
+				err := json.NewDecoder(w.Result().Body).Decode(&companyBody)
+				if err != nil {
+					t.Error("error decode response body")
+				}
+
+				assert.Equal(t, description, companyBody.Description)
+			}
+		})
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	company := entities.Company{
+		Id:              1,
+		Name:            "Test Company",
+		Description:     "Test",
+		EmployeesAmount: 10,
+		Registered:      true,
+		Type:            "corporations",
+		Version:         2,
+	}
+
+	cases := map[string]struct {
+		mocks    func(*MockcompanyRepository)
+		Method   string
+		Header   string
+		Value    string
+		Config   config.Configuration
+		WantCode int
+		WantETag string
+	}{
+		"get returns etag": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 1).Return(company, nil)
+			},
+			Method:   http.MethodGet,
+			WantCode: 200,
+			WantETag: `"2"`,
+		},
+		"get not modified": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 1).Return(company, nil)
+			},
+			Method:   http.MethodGet,
+			Header:   "If-None-Match",
+			Value:    `"2"`,
+			WantCode: 304,
+			WantETag: `"2"`,
+		},
+		"delete matching version": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().DeleteCompany(gomock.Any(), 1, 2).Return(nil)
+			},
+			Method:   http.MethodDelete,
+			Header:   "If-Match",
+			Value:    `"2"`,
+			WantCode: 200,
+		},
+		"delete stale version": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().DeleteCompany(gomock.Any(), 1, 1).Return(repositories.ErrVersionMismatch)
+			},
+			Method:   http.MethodDelete,
+			Header:   "If-Match",
+			Value:    `"1"`,
+			WantCode: 412,
+		},
+		"delete weak etag": {
+			Method:   http.MethodDelete,
+			Header:   "If-Match",
+			Value:    `W/"2"`,
+			WantCode: 412,
+		},
+		"delete without required if-match": {
+			Method:   http.MethodDelete,
+			Config:   config.Configuration{RequireIfMatch: true},
+			WantCode: 428,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			companyRepository := NewMockcompanyRepository(ctrl)
+
+			if tc.mocks != nil {
+				tc.mocks(companyRepository)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tc.Method, "/v1/company/{id}", nil).WithContext(ctx)
+			if tc.Header != "" {
+				r.Header.Set(tc.Header, tc.Value)
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "1")
+
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			handlers := handlers.NewCompanyHandler(companyRepository, logger, tc.Config)
+			handler := http.HandlerFunc(handlers.DeleteCompany)
+			if tc.Method == http.MethodGet {
+				handler = handlers.GetCompany
+			}
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.WantCode, w.Code)
+			assert.Equal(t, tc.WantETag, w.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestRestoreCompany(t *testing.T) {
+	cases := map[string]struct {
+		mocks     func(*MockcompanyRepository)
+		WantCode  int
+		CompanyID string
+	}{
+		"success": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().RestoreCompany(gomock.Any(), 1).Return(entities.Company{
+					Id:              1,
+					Name:            "Test Company",
+					Description:     "Test",
+					EmployeesAmount: 10,
+					Registered:      true,
+					Type:            "corporations",
+					Version:         3,
+				}, nil)
+			},
+			WantCode:  200,
+			CompanyID: "1",
+		},
+		"not deleted": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().RestoreCompany(gomock.Any(), 2).Return(entities.Company{}, repositories.ErrCompanyNotDeleted)
+			},
+			WantCode:  409,
+			CompanyID: "2",
+		},
+		"name taken": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().RestoreCompany(gomock.Any(), 3).Return(entities.Company{}, repositories.ErrDuplicateName)
+			},
+			WantCode:  409,
+			CompanyID: "3",
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			companyRepository := NewMockcompanyRepository(ctrl)
+
+			if tc.mocks != nil {
+				tc.mocks(companyRepository)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/company/{id}/restore", nil).WithContext(ctx)
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tc.CompanyID)
+
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			handlers := handlers.NewCompanyHandler(companyRepository, logger, config.Configuration{})
+			handler := http.HandlerFunc(handlers.RestoreCompany)
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.WantCode, w.Code)
+		})
+	}
+}
+
+func TestCompanyHistory(t *testing.T) {
+	before := entities.Company{Id: 1, Name: "Test Company", Type: "corporations", Version: 1}
+	after := before
+	after.Name = "Renamed"
+	after.Version = 2
+
+	entry := entities.CompanyHistory{
+		Id:            2,
+		CompanyId:     1,
+		Version:       2,
+		Action:        entities.ActionUpdate,
+		Actor:         "api_token",
+		Before:        &before,
+		After:         &after,
+		ChangedFields: []string{"name"},
+	}
+
+	cases := map[string]struct {
+		mocks    func(*MockcompanyRepository)
+		Version  string
+		Query    string
+		WantCode int
+	}{
+		"list": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().ListCompanyHistory(gomock.Any(), 1, 10, "").Return([]entities.CompanyHistory{entry}, "", nil)
+			},
+			Query:    "?limit=10",
+			WantCode: 200,
+		},
+		"list invalid limit": {
+			Query:    "?limit=0",
+			WantCode: 400,
+		},
+		"version": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompanyHistory(gomock.Any(), 1, 2).Return(entry, nil)
+			},
+			Version:  "2",
+			WantCode: 200,
+		},
+		"unknown version": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompanyHistory(gomock.Any(), 1, 9).Return(entities.CompanyHistory{}, repositories.ErrHistoryNotFound)
+			},
+			Version:  "9",
+			WantCode: 404,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			companyRepository := NewMockcompanyRepository(ctrl)
+
+			if tc.mocks != nil {
+				tc.mocks(companyRepository)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/company/{id}/history"+tc.Query, nil).WithContext(ctx)
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "1")
+			if tc.Version != "" {
+				rctx.URLParams.Add("version", tc.Version)
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			handlers := handlers.NewCompanyHandler(companyRepository, logger, config.Configuration{})
+			handler := http.HandlerFunc(handlers.ListCompanyHistory)
+			if tc.Version != "" {
+				handler = handlers.GetCompanyHistory
+			}
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.WantCode, w.Code)
+
+			if tc.WantCode == http.StatusOK && tc.Version != "" {
+				var got entities.CompanyHistory
+				err := json.NewDecoder(w.Result().Body).Decode(&got)
+				if err != nil {
+					t.Error("error decode response body")
+				}
+
+				assert.Equal(t, "Renamed", got.After.Name)
+				assert.Equal(t, []string{"name"}, got.ChangedFields)
+			}
+		})
+	}
+}
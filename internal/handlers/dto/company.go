@@ -1,8 +1,42 @@
 package dto
 
-import "github.com/go-playground/validator/v10"
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"xm/internal/repositories/entities"
 
-var Validator = validator.New()
+	"github.com/go-playground/validator/v10"
+)
+
+var Validator = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	_ = v.RegisterValidation("http_url", isHTTPURL)
+
+	return v
+}
+
+// isHTTPURL accepts absolute http and https URLs with a host.
+func isHTTPURL(fl validator.FieldLevel) bool {
+	u, err := url.Parse(fl.Field().String())
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	return u.Scheme == "http" || u.Scheme == "https"
+}
 
 type Company struct {
 	Name            string `json:"name" validate:"required,max=15"`
@@ -11,3 +45,137 @@ type Company struct {
 	Registered      bool   `json:"registered" validate:"required"`
 	Type            string `json:"type" validate:"required"`
 }
+
+type CompanyFilter struct {
+	Type               string `json:"type" validate:"omitempty,oneof=corporations non_profit cooperative sole_proprietorship"`
+	Registered         *bool  `json:"registered"`
+	NamePrefix         string `json:"name_prefix" validate:"max=15"`
+	EmployeesAmountMin *int   `json:"employees_amount_min" validate:"omitempty,min=0"`
+	EmployeesAmountMax *int   `json:"employees_amount_max" validate:"omitempty,min=0"`
+	Sort               string `json:"sort" validate:"oneof=id name description employees_amount registered type"`
+	Desc               bool   `json:"-"`
+	Limit              int    `json:"limit" validate:"min=1,max=100"`
+	Cursor             string `json:"cursor"`
+}
+
+type CompanyList struct {
+	Companies  []entities.Company `json:"companies"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+type CompanyPatch struct {
+	Name            *string
+	Description     *string
+	EmployeesAmount *int
+	Registered      *bool
+	Type            *string
+}
+
+type CompanyHistoryList struct {
+	History    []entities.CompanyHistory `json:"history"`
+	NextCursor string                    `json:"next_cursor,omitempty"`
+}
+
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+// BatchOperation creates a company, or replaces or deletes the company Id.
+// A non-zero Version makes an update or delete conditional like If-Match.
+type BatchOperation struct {
+	Op      string   `json:"op" validate:"oneof=create update delete"`
+	Id      int      `json:"id" validate:"required_unless=Op create"`
+	Version int      `json:"version" validate:"min=0"`
+	Company *Company `json:"company" validate:"required_unless=Op delete"`
+}
+
+// Batch applies up to BATCH_MAX_OPERATIONS operations, atomically unless Mode
+// is best_effort.
+type Batch struct {
+	Mode       string           `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+	Operations []BatchOperation `json:"operations" validate:"required,min=1,dive"`
+}
+
+type BatchResult struct {
+	Index   int               `json:"index"`
+	Op      string            `json:"op"`
+	Status  int               `json:"status"`
+	Company *entities.Company `json:"company,omitempty"`
+	Error   *BatchError       `json:"error,omitempty"`
+}
+
+type BatchError struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// CompanyRecord is a company in an export or import file. Version is
+// exported for reference and ignored on import.
+type CompanyRecord struct {
+	Id              int    `json:"id"`
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	EmployeesAmount int    `json:"employees_amount"`
+	Registered      bool   `json:"registered"`
+	Type            string `json:"type"`
+	Version         int    `json:"version"`
+}
+
+// CompanyImport is a valid import row found on Line of the upload. A non-zero
+// Id replaces that company.
+type CompanyImport struct {
+	Line    int
+	Id      int
+	Company Company
+}
+
+type ImportRow struct {
+	Line   int    `json:"line"`
+	Action string `json:"action"`
+	Id     int    `json:"id,omitempty"`
+}
+
+// ImportReport lists what an import did, or would do on a dry run.
+type ImportReport struct {
+	DryRun  bool        `json:"dry_run"`
+	Created int         `json:"created"`
+	Updated int         `json:"updated"`
+	Rows    []ImportRow `json:"rows"`
+}
+
+type StreamFilter struct {
+	CompanyIds []int    `json:"company_id" validate:"dive,min=1"`
+	Types      []string `json:"type" validate:"dive,oneof=corporations non_profit cooperative sole_proprietorship"`
+	EventTypes []string `json:"event_type" validate:"dive,oneof=CompanyCreated CompanyUpdated CompanyDeleted"`
+}
+
+// Matches reports whether the event passes every filter.
+func (f StreamFilter) Matches(event entities.CompanyEvent) bool {
+	return matchesAny(f.CompanyIds, event.CompanyId) &&
+		matchesAny(f.Types, event.Company.Type) &&
+		matchesAny(f.EventTypes, event.Type)
+}
+
+// matchesAny reports whether value is one of values, no values match all.
+func matchesAny[T comparable](values []T, value T) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
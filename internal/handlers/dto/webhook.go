@@ -0,0 +1,21 @@
+package dto
+
+import "xm/internal/repositories/entities"
+
+type Webhook struct {
+	URL        string   `json:"url" validate:"required,http_url,max=2048"`
+	Secret     string   `json:"secret" validate:"required,min=16,max=255"`
+	EventTypes []string `json:"event_types" validate:"required,min=1,unique,dive,oneof=CompanyCreated CompanyUpdated CompanyDeleted"`
+}
+
+type WebhookPatch struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+type WebhookList struct {
+	Webhooks []entities.Webhook `json:"webhooks"`
+}
+
+type WebhookDeliveryList struct {
+	Deliveries []entities.WebhookDelivery `json:"deliveries"`
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"xm/internal/handlers/problem"
+	"xm/internal/repositories/entities"
+)
+
+func etag(c entities.Company) string {
+	return `"` + strconv.Itoa(c.Version) + `"`
+}
+
+func setETag(w http.ResponseWriter, c entities.Company) {
+	w.Header().Set("ETag", etag(c))
+}
+
+// notModified reports whether If-None-Match matches the company, using weak
+// comparison as RFC 9110 requires for GET.
+func notModified(r *http.Request, c entities.Company) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag(c) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ifMatchVersion resolves If-Match into the version a conditional write must
+// match; 0 means the write is unconditional. When ok is false the response
+// has already been written.
+func (h companyHandler) ifMatchVersion(w http.ResponseWriter, r *http.Request, id int) (version int, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+
+	if header == "" {
+		if h.requireIfMatch {
+			h.writeProblem(w, r, problem.New(r, http.StatusPreconditionRequired, problem.TypePreconditionRequired,
+				"If-Match header with the company ETag is required"))
+			return 0, false
+		}
+		return 0, true
+	}
+
+	if header == "*" {
+		return 0, true
+	}
+
+	var versions []int
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 2 {
+			continue
+		}
+		v, err := strconv.Atoi(tag[1 : len(tag)-1])
+		if err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+
+	switch len(versions) {
+	case 0:
+		h.errPreconditionFailed(w, r)
+		return 0, false
+	case 1:
+		return versions[0], true
+	}
+
+	company, err := h.companyRepository.GetCompany(r.Context(), id)
+	if err != nil {
+		h.errRepository(w, r, err)
+		return 0, false
+	}
+
+	for _, v := range versions {
+		if v == company.Version {
+			return v, true
+		}
+	}
+
+	h.errPreconditionFailed(w, r)
+	return 0, false
+}
+
+func (h companyHandler) errPreconditionFailed(w http.ResponseWriter, r *http.Request) {
+	h.writeProblem(w, r, problem.New(r, http.StatusPreconditionFailed, problem.TypePreconditionFailed,
+		"company was modified, fetch it again to get the current ETag"))
+}
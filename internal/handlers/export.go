@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"xm/internal/handlers/dto"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+)
+
+const (
+	mediaTypeCSV    = "text/csv"
+	mediaTypeNDJSON = "application/x-ndjson"
+
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+// exportPageSize is the number of companies read and flushed at a time.
+const exportPageSize = 1000
+
+// recordColumns are the CSV columns of exports and imports.
+var recordColumns = []string{"id", "name", "description", "employees_amount", "registered", "type", "version"}
+
+var exportMediaType = map[string]string{
+	formatCSV:    mediaTypeCSV + ";charset=utf-8",
+	formatNDJSON: mediaTypeNDJSON,
+}
+
+// recordWriter writes companies to an export.
+type recordWriter interface {
+	Write(record dto.CompanyRecord) error
+	Flush() error
+}
+
+// newRecordWriter returns the writer of format. A CSV export starts with the
+// header, write errors surface on Flush.
+func newRecordWriter(w io.Writer, format string) recordWriter {
+	if format == formatNDJSON {
+		return ndjsonRecordWriter{encoder: json.NewEncoder(w)}
+	}
+
+	writer := csv.NewWriter(w)
+	_ = writer.Write(recordColumns)
+
+	return csvRecordWriter{writer: writer}
+}
+
+func writeRecords(writer recordWriter, companies []entities.Company) error {
+	for _, company := range companies {
+		err := writer.Write(companyToRecord(company))
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+type csvRecordWriter struct {
+	writer *csv.Writer
+}
+
+func (w csvRecordWriter) Write(record dto.CompanyRecord) error {
+	return w.writer.Write([]string{
+		strconv.Itoa(record.Id),
+		record.Name,
+		record.Description,
+		strconv.Itoa(record.EmployeesAmount),
+		strconv.FormatBool(record.Registered),
+		record.Type,
+		strconv.Itoa(record.Version),
+	})
+}
+
+func (w csvRecordWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type ndjsonRecordWriter struct {
+	encoder *json.Encoder
+}
+
+func (w ndjsonRecordWriter) Write(record dto.CompanyRecord) error {
+	return w.encoder.Encode(record)
+}
+
+func (w ndjsonRecordWriter) Flush() error {
+	return nil
+}
+
+// ExportCompanies streams the companies matching the list filters as CSV or
+// NDJSON, ordered by id. Companies are read and flushed a page at a time, so
+// the export never holds the whole table.
+func (h companyHandler) ExportCompanies(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var filter dto.CompanyFilter
+
+	format, err := exportFormat(r)
+	if err != nil {
+		h.errCompanyFilter(w, r, err)
+		return
+	}
+
+	filter, err = parseCompanyFilter(r.URL.Query())
+	if err != nil {
+		h.errCompanyFilter(w, r, err)
+		return
+	}
+
+	// The export walks the cursor in id order, sort and paging do not apply.
+	filter.Sort, filter.Desc, filter.Limit, filter.Cursor = "id", false, maxListLimit, ""
+
+	err = dto.Validator.Struct(filter)
+	if err != nil {
+		h.errCompanyFilter(w, r, err)
+		return
+	}
+
+	filter.Limit = exportPageSize
+
+	// The first page is read before anything is written, so its errors are
+	// still reported as problems.
+	companies, next, err := h.companyRepository.ListCompanies(r.Context(), filter)
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", exportMediaType[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="companies.%s"`, format))
+	writer := newRecordWriter(w, format)
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		err = writeRecords(writer, companies)
+		if err != nil {
+			h.log(r).Warn().Timestamp().Msg(err.Error())
+			break
+		}
+		if next == "" {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		filter.Cursor = next
+		companies, next, err = h.companyRepository.ListCompanies(r.Context(), filter)
+		if errors.Is(err, repositories.ErrCanceled) {
+			h.log(r).Info().Timestamp().Int("status", statusClientClosedRequest).Msg(err.Error())
+			break
+		}
+		if err != nil {
+			h.log(r).Error().Timestamp().Msg(err.Error())
+			break
+		}
+	}
+
+	// The status is sent already. Aborting the response keeps the client from
+	// taking a truncated export for a complete one.
+	panic(http.ErrAbortHandler)
+}
+
+// exportFormat picks the format from the format query parameter, then from
+// the Accept header, and defaults to CSV.
+func exportFormat(r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	switch format {
+	case formatCSV, formatNDJSON:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("format: must be %s or %s", formatCSV, formatNDJSON)
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		switch strings.TrimSpace(strings.SplitN(accept, ";", 2)[0]) {
+		case mediaTypeNDJSON:
+			return formatNDJSON, nil
+		case mediaTypeCSV:
+			return formatCSV, nil
+		}
+	}
+
+	return formatCSV, nil
+}
+
+func companyToRecord(c entities.Company) dto.CompanyRecord {
+	return dto.CompanyRecord{
+		Id:              c.Id,
+		Name:            c.Name,
+		Description:     c.Description,
+		EmployeesAmount: c.EmployeesAmount,
+		Registered:      c.Registered,
+		Type:            c.Type,
+		Version:         c.Version,
+	}
+}
@@ -0,0 +1,160 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"xm/config"
+	"xm/internal/handlers"
+	"xm/internal/handlers/dto"
+	"xm/internal/logging"
+	"xm/internal/metrics"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+
+	"github.com/go-chi/chi/v5"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCompanies(t *testing.T) {
+	acme := entities.Company{Id: 1, Name: "Acme", Description: "Anvils, rockets", EmployeesAmount: 10, Registered: true, Type: "corporations", Version: 2}
+	beta := entities.Company{Id: 2, Name: "Beta", EmployeesAmount: 5, Type: "cooperative", Version: 1}
+
+	twoPages := func(mr *MockcompanyRepository) {
+		gomock.InOrder(
+			mr.EXPECT().ListCompanies(gomock.Any(), dto.CompanyFilter{Type: "corporations", Sort: "id", Limit: 1000}).
+				Return([]entities.Company{acme}, "next", nil),
+			mr.EXPECT().ListCompanies(gomock.Any(), dto.CompanyFilter{Type: "corporations", Sort: "id", Limit: 1000, Cursor: "next"}).
+				Return([]entities.Company{beta}, "", nil),
+		)
+	}
+
+	cases := map[string]struct {
+		query           string
+		accept          string
+		mocks           func(*MockcompanyRepository)
+		WantCode        int
+		WantContentType string
+		WantBody        string
+	}{
+		"csv": {
+			query:           "?type=corporations&sort=-name&limit=5",
+			mocks:           twoPages,
+			WantCode:        http.StatusOK,
+			WantContentType: "text/csv;charset=utf-8",
+			WantBody: "id,name,description,employees_amount,registered,type,version\n" +
+				"1,Acme,\"Anvils, rockets\",10,true,corporations,2\n" +
+				"2,Beta,,5,false,cooperative,1\n",
+		},
+		"ndjson from accept": {
+			query:           "?type=corporations",
+			accept:          "application/x-ndjson",
+			mocks:           twoPages,
+			WantCode:        http.StatusOK,
+			WantContentType: "application/x-ndjson",
+			WantBody: `{"id":1,"name":"Acme","description":"Anvils, rockets","employees_amount":10,"registered":true,"type":"corporations","version":2}` + "\n" +
+				`{"id":2,"name":"Beta","description":"","employees_amount":5,"registered":false,"type":"cooperative","version":1}` + "\n",
+		},
+		"format wins over accept": {
+			query:  "?format=csv",
+			accept: "application/x-ndjson",
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().ListCompanies(gomock.Any(), gomock.Any()).Return(nil, "", nil)
+			},
+			WantCode:        http.StatusOK,
+			WantContentType: "text/csv;charset=utf-8",
+			WantBody:        "id,name,description,employees_amount,registered,type,version\n",
+		},
+		"unknown format": {
+			query:    "?format=xml",
+			WantCode: http.StatusBadRequest,
+		},
+		"invalid filter": {
+			query:    "?type=guild",
+			WantCode: http.StatusBadRequest,
+		},
+		"storage unavailable": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().ListCompanies(gomock.Any(), gomock.Any()).Return(nil, "", repositories.ErrUnavailable)
+			},
+			WantCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			companyRepository := NewMockcompanyRepository(ctrl)
+			if tc.mocks != nil {
+				tc.mocks(companyRepository)
+			}
+
+			h := handlers.NewCompanyHandler(companyRepository, logger, config.Configuration{})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/company/export"+tc.query, nil)
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+
+			h.ExportCompanies(w, r)
+
+			require.Equal(t, tc.WantCode, w.Code, w.Body.String())
+			if tc.WantBody != "" {
+				assert.Equal(t, tc.WantContentType, w.Header().Get("Content-Type"))
+				assert.Equal(t, tc.WantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestExportCompaniesAbort(t *testing.T) {
+	var logger zerolog.Logger
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	companyRepository := NewMockcompanyRepository(ctrl)
+	gomock.InOrder(
+		companyRepository.EXPECT().ListCompanies(gomock.Any(), gomock.Any()).Return([]entities.Company{{Id: 1, Name: "Acme"}}, "next", nil),
+		companyRepository.EXPECT().ListCompanies(gomock.Any(), gomock.Any()).Return(nil, "", repositories.ErrTimeout),
+	)
+
+	var out bytes.Buffer
+	h := handlers.NewCompanyHandler(companyRepository, logger, config.Configuration{})
+
+	router := chi.NewRouter()
+	router.Use(logging.AccessLog(zerolog.New(&out)))
+	router.Use(metrics.Middleware)
+	router.Get("/v1/company/export", h.ExportCompanies)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/company/export", nil)
+
+	// A failure after the first page cannot change the status, the response
+	// is aborted instead.
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { router.ServeHTTP(w, r) })
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The abort is still logged and counted.
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	var access map[string]interface{}
+	require.NoError(t, json.Unmarshal(lines[len(lines)-1], &access))
+	assert.Equal(t, "request", access["message"])
+	assert.Equal(t, "error", access["level"])
+	assert.Equal(t, true, access["aborted"])
+	assert.Equal(t, "/v1/company/export", access["route"])
+
+	scraped := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(scraped, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, scraped.Body.String(), `xm_http_requests_total{method="GET",route="/v1/company/export",status="aborted"} 1`)
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"xm/config"
+	"xm/internal/handlers/dto"
+	"xm/internal/handlers/problem"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/rs/zerolog"
+)
+
+type graphqlHandler struct {
+	responder
+	schema         graphql.Schema
+	limits         queryLimits
+	maxBodyBytes   int64
+	requireIfMatch bool
+}
+
+// NewGraphQLHandler serves the company queries and mutations of the GraphQL
+// schema. Its resolvers use the same repository and validation rules as
+// companyHandler.
+func NewGraphQLHandler(companyRepository companyRepository, logger zerolog.Logger, cfg config.Configuration) (graphqlHandler, error) {
+	h := graphqlHandler{
+		responder:      responder{logger: logger},
+		limits:         queryLimits{maxDepth: cfg.GraphQL.MaxDepth, maxComplexity: cfg.GraphQL.MaxComplexity},
+		maxBodyBytes:   cfg.GraphQL.MaxBodyBytes,
+		requireIfMatch: cfg.RequireIfMatch,
+	}
+
+	schema, err := newSchema(companyRepository, h.requireIfMatch)
+	if err != nil {
+		return graphqlHandler{}, err
+	}
+	h.schema = schema
+
+	return h, nil
+}
+
+// GraphQL executes a query or mutation. Requests that can not be parsed,
+// fail validation or exceed GRAPHQL_MAX_DEPTH or GRAPHQL_MAX_COMPLEXITY are
+// answered with 400 before anything is resolved; once executed the response
+// is 200 and field errors are listed next to the data.
+func (h graphqlHandler) GraphQL(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var request dto.GraphQLRequest
+
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBodyBytes)).Decode(&request)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		detail := fmt.Sprintf("GraphQL body is larger than %d bytes", maxBytesErr.Limit)
+		h.log(r).Warn().Timestamp().Msg(detail)
+		h.writeProblem(w, r, problem.New(r, http.StatusRequestEntityTooLarge, problem.TypeTooLarge, detail))
+		return
+	}
+	if err == nil {
+		err = dto.Validator.Struct(request)
+	}
+	if err != nil {
+		h.log(r).Warn().Timestamp().Msg(err.Error())
+		h.writeProblem(w, r, problem.Validation(r, "invalid GraphQL request body", err))
+		return
+	}
+
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(request.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		h.writeRequestErrors(w, r, gqlerrors.FormatErrors(err))
+		return
+	}
+
+	validation := graphql.ValidateDocument(&h.schema, document, nil)
+	if !validation.IsValid {
+		h.writeRequestErrors(w, r, validation.Errors)
+		return
+	}
+
+	err = h.limits.check(document, request.OperationName, request.Variables)
+	if err != nil {
+		h.writeRequestErrors(w, r, []gqlerrors.FormattedError{{
+			Message:    err.Error(),
+			Extensions: map[string]interface{}{"type": problem.TypeValidation, "status": http.StatusBadRequest},
+		}})
+		return
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           document,
+		OperationName: request.OperationName,
+		Args:          request.Variables,
+		Context:       withCompanyLoader(r.Context()),
+	})
+	for i, formatted := range result.Errors {
+		result.Errors[i] = h.formatError(r, formatted)
+	}
+
+	h.writeJSON(w, r, http.StatusOK, result)
+}
+
+func (h graphqlHandler) writeRequestErrors(w http.ResponseWriter, r *http.Request, errs []gqlerrors.FormattedError) {
+	for _, err := range errs {
+		h.log(r).Warn().Timestamp().Msg(err.Message)
+	}
+
+	h.writeJSON(w, r, http.StatusBadRequest, graphql.Result{Errors: errs})
+}
+
+// formatError reports the error a resolver returned the way the REST API
+// would: repository errors get the detail, problem type and status of
+// RepositoryError, so internal messages do not reach the client.
+func (h graphqlHandler) formatError(r *http.Request, formatted gqlerrors.FormattedError) gqlerrors.FormattedError {
+	err := originalError(formatted)
+
+	var fieldErr fieldError
+	switch {
+	case errors.As(err, &fieldErr):
+		h.log(r).Warn().Timestamp().Msg(err.Error())
+		formatted.Message = fieldErr.detail
+		formatted.Extensions = map[string]interface{}{"type": fieldErr.typ, "status": fieldErr.status}
+		if fields := problem.FieldErrors(fieldErr.err); len(fields) > 0 {
+			formatted.Extensions["errors"] = fields
+		}
+	case errors.Is(err, repositories.ErrCanceled):
+		h.log(r).Info().Timestamp().Int("status", statusClientClosedRequest).Msg(err.Error())
+		formatted.Message = "request canceled"
+		formatted.Extensions = map[string]interface{}{"status": statusClientClosedRequest}
+	case err != nil:
+		status, typ, detail := RepositoryError(err)
+		if status >= http.StatusInternalServerError {
+			h.log(r).Error().Timestamp().Msg(err.Error())
+		} else {
+			h.log(r).Warn().Timestamp().Msg(err.Error())
+		}
+		formatted.Message = detail
+		formatted.Extensions = map[string]interface{}{"type": typ, "status": status}
+	}
+
+	return formatted
+}
+
+// originalError digs the error returned by a resolver out of the wrapping
+// graphql-go adds; errors of the executor itself, such as a null returned
+// for a non-null field, have none.
+func originalError(err error) error {
+	for {
+		switch e := err.(type) {
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			return err
+		}
+		if err == nil {
+			return nil
+		}
+	}
+}
+
+// fieldError is an error of a resolver that is not a repository error, like
+// a failed validation or a missing scope.
+type fieldError struct {
+	status int
+	typ    string
+	detail string
+	err    error
+}
+
+func (e fieldError) Error() string {
+	if e.err != nil {
+		return e.detail + ": " + e.err.Error()
+	}
+
+	return e.detail
+}
+
+type companiesReader interface {
+	GetCompanies(ctx context.Context, ids []int) ([]entities.Company, error)
+}
+
+type companyLoaderKey struct{}
+
+func withCompanyLoader(ctx context.Context) context.Context {
+	return context.WithValue(ctx, companyLoaderKey{}, &companyLoader{loaded: map[int]loadedCompany{}})
+}
+
+type loadedCompany struct {
+	company *entities.Company
+	err     error
+}
+
+// companyLoader batches the company lookups of a request. The executor
+// resolves every field of a selection level before it calls the thunks they
+// returned, so all the IDs queued on one level are read with a single
+// GetCompanies when the first thunk runs.
+type companyLoader struct {
+	mu      sync.Mutex
+	pending []int
+	loaded  map[int]loadedCompany
+}
+
+// load queues id and returns the thunk that resolves it, to a nil company
+// when it does not exist or was deleted.
+func (l *companyLoader) load(ctx context.Context, repository companiesReader, id int) func() (interface{}, error) {
+	l.mu.Lock()
+	if _, ok := l.loaded[id]; !ok {
+		l.pending = append(l.pending, id)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		result, ok := l.loaded[id]
+		if !ok {
+			l.flush(ctx, repository)
+			result = l.loaded[id]
+		}
+
+		if result.err != nil || result.company == nil {
+			return nil, result.err
+		}
+		return *result.company, nil
+	}
+}
+
+func (l *companyLoader) flush(ctx context.Context, repository companiesReader) {
+	ids := l.pending
+	l.pending = nil
+
+	companies, err := repository.GetCompanies(ctx, ids)
+	for _, id := range ids {
+		l.loaded[id] = loadedCompany{err: err}
+	}
+	for i := range companies {
+		l.loaded[companies[i].Id] = loadedCompany{company: &companies[i]}
+	}
+}
+
+func companyLoaderFrom(ctx context.Context) *companyLoader {
+	loader, ok := ctx.Value(companyLoaderKey{}).(*companyLoader)
+	if !ok {
+		// Resolvers called outside GraphQL still load one by one.
+		return &companyLoader{loaded: map[int]loadedCompany{}}
+	}
+
+	return loader
+}
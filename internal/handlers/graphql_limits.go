@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// pageFields are the fields that return a page of companies, with the size
+// of the page when the query sets no limit.
+var pageFields = map[string]int{
+	"companies": defaultListLimit,
+}
+
+// queryLimits keeps a single request from fanning out into reads the
+// database can not afford. The depth counts nested field selections; the
+// complexity counts every selected field once, and once per company of a
+// page for the fields selected below it. Zero disables a limit.
+type queryLimits struct {
+	maxDepth      int
+	maxComplexity int
+}
+
+func (l queryLimits) check(document *ast.Document, operationName string, variables map[string]interface{}) error {
+	q := query{
+		fragments:   map[string]*ast.FragmentDefinition{},
+		definitions: map[string]*ast.VariableDefinition{},
+		variables:   variables,
+	}
+
+	var operation *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch d := definition.(type) {
+		case *ast.FragmentDefinition:
+			q.fragments[d.Name.Value] = d
+		case *ast.OperationDefinition:
+			if operation == nil && (operationName == "" || d.Name != nil && d.Name.Value == operationName) {
+				operation = d
+			}
+		}
+	}
+	if operation == nil {
+		// The executor reports the missing operation.
+		return nil
+	}
+	for _, definition := range operation.VariableDefinitions {
+		q.definitions[definition.Variable.Name.Value] = definition
+	}
+
+	depth, complexity := q.measure(operation.SelectionSet, map[string]bool{})
+	if l.maxDepth > 0 && depth > l.maxDepth {
+		return fmt.Errorf("query depth %d exceeds the limit of %d", depth, l.maxDepth)
+	}
+	if l.maxComplexity > 0 && complexity > l.maxComplexity {
+		return fmt.Errorf("query complexity %d exceeds the limit of %d", complexity, l.maxComplexity)
+	}
+
+	return nil
+}
+
+type query struct {
+	fragments   map[string]*ast.FragmentDefinition
+	definitions map[string]*ast.VariableDefinition
+	variables   map[string]interface{}
+}
+
+// measure returns the depth and complexity of a selection set. Fragments
+// count as if their fields were selected in place, introspection fields read
+// nothing from the database and are not counted.
+func (q query) measure(set *ast.SelectionSet, spreading map[string]bool) (depth int, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	for _, selection := range set.Selections {
+		var d, c int
+
+		switch s := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+			d, c = q.measure(s.SelectionSet, spreading)
+			d++
+			c = 1 + q.pageSize(s)*c
+		case *ast.InlineFragment:
+			d, c = q.measure(s.SelectionSet, spreading)
+		case *ast.FragmentSpread:
+			name := s.Name.Value
+			fragment, ok := q.fragments[name]
+			// Validation rejects fragment cycles, they are not followed
+			// regardless.
+			if !ok || spreading[name] {
+				continue
+			}
+			spreading[name] = true
+			d, c = q.measure(fragment.SelectionSet, spreading)
+			delete(spreading, name)
+		}
+
+		if d > depth {
+			depth = d
+		}
+		complexity += c
+	}
+
+	return depth, complexity
+}
+
+// pageSize is the number of companies a field returns at most, 1 for fields
+// that do not return a page. A limit it can not resolve counts as the largest
+// page, so the measure never falls below what the query can read.
+func (q query) pageSize(field *ast.Field) int {
+	size, ok := pageFields[field.Name.Value]
+	if !ok {
+		return 1
+	}
+
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "limit" {
+			continue
+		}
+
+		size = q.limit(argument.Value, size)
+	}
+
+	if size < 1 {
+		return 1
+	}
+
+	return size
+}
+
+// limit resolves the limit argument of a page field. A variable missing from
+// the request takes the default of its definition, without one the field
+// default applies.
+func (q query) limit(value ast.Value, fieldDefault int) int {
+	switch v := value.(type) {
+	case *ast.IntValue:
+		limit, err := strconv.Atoi(v.Value)
+		if err == nil {
+			return limit
+		}
+	case *ast.Variable:
+		name := v.Name.Value
+		if value, ok := q.variables[name]; ok {
+			// JSON numbers decode to float64.
+			if limit, ok := value.(float64); ok {
+				return int(limit)
+			}
+			break
+		}
+
+		definition, ok := q.definitions[name]
+		if !ok {
+			break
+		}
+		if definition.DefaultValue == nil {
+			return fieldDefault
+		}
+		if _, ok := definition.DefaultValue.(*ast.Variable); !ok {
+			return q.limit(definition.DefaultValue, fieldDefault)
+		}
+	}
+
+	return maxListLimit
+}
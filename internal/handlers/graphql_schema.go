@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"xm/internal/auth"
+	"xm/internal/handlers/dto"
+	"xm/internal/handlers/problem"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+
+	"github.com/graphql-go/graphql"
+)
+
+var companyType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Company",
+	Description: "A company, the GraphQL view of entities.Company.",
+	Fields: graphql.Fields{
+		"id":              companyField(graphql.ID, func(c entities.Company) interface{} { return c.Id }),
+		"name":            companyField(graphql.String, func(c entities.Company) interface{} { return c.Name }),
+		"description":     companyField(graphql.String, func(c entities.Company) interface{} { return c.Description }),
+		"employeesAmount": companyField(graphql.Int, func(c entities.Company) interface{} { return c.EmployeesAmount }),
+		"registered":      companyField(graphql.Boolean, func(c entities.Company) interface{} { return c.Registered }),
+		"type":            companyField(graphql.String, func(c entities.Company) interface{} { return c.Type }),
+		"version":         companyField(graphql.Int, func(c entities.Company) interface{} { return c.Version }),
+	},
+})
+
+func companyField(fieldType graphql.Output, value func(c entities.Company) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.NewNonNull(fieldType),
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return value(p.Source.(entities.Company)), nil
+		},
+	}
+}
+
+var companyListType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "CompanyList",
+	Fields: graphql.Fields{
+		"companies": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(companyType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(dto.CompanyList).Companies, nil
+			},
+		},
+		"nextCursor": &graphql.Field{
+			Type:        graphql.String,
+			Description: "Passed as cursor to read the next page, null on the last page.",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if next := p.Source.(dto.CompanyList).NextCursor; next != "" {
+					return next, nil
+				}
+				return nil, nil
+			},
+		},
+	},
+})
+
+var companyInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "CompanyInput",
+	Description: "Validated with the rules of the REST request body.",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name":            &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"description":     &graphql.InputObjectFieldConfig{Type: graphql.String, DefaultValue: ""},
+		"employeesAmount": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+		"registered":      &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Boolean)},
+		"type":            &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+// companyResolvers resolves the queries and mutations with the repository of
+// companyHandler.
+type companyResolvers struct {
+	companyRepository companyRepository
+	requireIfMatch    bool
+}
+
+func newSchema(companyRepository companyRepository, requireIfMatch bool) (graphql.Schema, error) {
+	resolvers := companyResolvers{companyRepository: companyRepository, requireIfMatch: requireIfMatch}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"company": &graphql.Field{
+				Type:        companyType,
+				Description: "The company, null when it does not exist or was deleted. Lookups of one request are batched into one query.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: resolvers.company,
+			},
+			"companies": &graphql.Field{
+				Type:        graphql.NewNonNull(companyListType),
+				Description: "A page of companies, filtered and sorted like GET /v1/company.",
+				Args: graphql.FieldConfigArgument{
+					"type":               &graphql.ArgumentConfig{Type: graphql.String},
+					"registered":         &graphql.ArgumentConfig{Type: graphql.Boolean},
+					"namePrefix":         &graphql.ArgumentConfig{Type: graphql.String},
+					"employeesAmountMin": &graphql.ArgumentConfig{Type: graphql.Int},
+					"employeesAmountMax": &graphql.ArgumentConfig{Type: graphql.Int},
+					"sort":               &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "id"},
+					"limit":              &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultListLimit},
+					"cursor":             &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolvers.companies,
+			},
+		},
+	})
+
+	versionArg := &graphql.ArgumentConfig{
+		Type:        graphql.Int,
+		Description: "Makes the mutation conditional like If-Match.",
+	}
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createCompany": &graphql.Field{
+				Type: graphql.NewNonNull(companyType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(companyInputType)},
+				},
+				Resolve: resolvers.createCompany,
+			},
+			"updateCompany": &graphql.Field{
+				Type: graphql.NewNonNull(companyType),
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"version": versionArg,
+					"input":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(companyInputType)},
+				},
+				Resolve: resolvers.updateCompany,
+			},
+			"deleteCompany": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"version": versionArg,
+				},
+				Resolve: resolvers.deleteCompany,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func (c companyResolvers) company(p graphql.ResolveParams) (interface{}, error) {
+	id, err := idArg(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return companyLoaderFrom(p.Context).load(p.Context, c.companyRepository, id), nil
+}
+
+func (c companyResolvers) companies(p graphql.ResolveParams) (interface{}, error) {
+	filter := dto.CompanyFilter{
+		Sort:  "id",
+		Limit: defaultListLimit,
+	}
+	if v, ok := p.Args["limit"].(int); ok {
+		filter.Limit = v
+	}
+	filter.Type, _ = p.Args["type"].(string)
+	filter.NamePrefix, _ = p.Args["namePrefix"].(string)
+	filter.Cursor, _ = p.Args["cursor"].(string)
+	if v, ok := p.Args["registered"].(bool); ok {
+		filter.Registered = &v
+	}
+	if v, ok := p.Args["employeesAmountMin"].(int); ok {
+		filter.EmployeesAmountMin = &v
+	}
+	if v, ok := p.Args["employeesAmountMax"].(int); ok {
+		filter.EmployeesAmountMax = &v
+	}
+	if v, _ := p.Args["sort"].(string); v != "" {
+		filter.Desc = strings.HasPrefix(v, "-")
+		filter.Sort = strings.TrimPrefix(v, "-")
+	}
+
+	err := dto.Validator.Struct(filter)
+	if err != nil {
+		return nil, fieldError{status: http.StatusBadRequest, typ: problem.TypeValidation, detail: "invalid company list parameters", err: err}
+	}
+
+	companies, next, err := c.companyRepository.ListCompanies(p.Context, filter)
+	if err != nil {
+		if errors.Is(err, repositories.ErrInvalidCursor) {
+			return nil, fieldError{status: http.StatusBadRequest, typ: problem.TypeValidation, detail: "invalid company list parameters", err: err}
+		}
+		return nil, err
+	}
+
+	return dto.CompanyList{Companies: companies, NextCursor: next}, nil
+}
+
+func (c companyResolvers) createCompany(p graphql.ResolveParams) (interface{}, error) {
+	err := requireScope(p.Context, auth.ScopeWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := companyInput(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.companyRepository.CreateCompany(p.Context, body)
+}
+
+func (c companyResolvers) updateCompany(p graphql.ResolveParams) (interface{}, error) {
+	err := requireScope(p.Context, auth.ScopeWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := idArg(p)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := c.versionArg(p)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := companyInput(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.companyRepository.UpdateCompany(p.Context, id, version, body)
+}
+
+func (c companyResolvers) deleteCompany(p graphql.ResolveParams) (interface{}, error) {
+	err := requireScope(p.Context, auth.ScopeDelete)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := idArg(p)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := c.versionArg(p)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.companyRepository.DeleteCompany(p.Context, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+// versionArg enforces REQUIRE_IF_MATCH, a mutation without the version is
+// rejected like a request without If-Match.
+func (c companyResolvers) versionArg(p graphql.ResolveParams) (int, error) {
+	version, _ := p.Args["version"].(int)
+	if version == 0 && c.requireIfMatch {
+		return 0, fieldError{status: http.StatusPreconditionRequired, typ: problem.TypePreconditionRequired, detail: "version of the company is required"}
+	}
+
+	return version, nil
+}
+
+func idArg(p graphql.ResolveParams) (int, error) {
+	id, err := strconv.Atoi(fmt.Sprint(p.Args["id"]))
+	if err != nil {
+		return 0, fieldError{status: http.StatusBadRequest, typ: problem.TypeValidation, detail: "invalid company ID", err: err}
+	}
+
+	return id, nil
+}
+
+func companyInput(p graphql.ResolveParams) (dto.Company, error) {
+	input := p.Args["input"].(map[string]interface{})
+
+	body := dto.Company{}
+	body.Name, _ = input["name"].(string)
+	body.Description, _ = input["description"].(string)
+	body.EmployeesAmount, _ = input["employeesAmount"].(int)
+	body.Registered, _ = input["registered"].(bool)
+	body.Type, _ = input["type"].(string)
+
+	err := dto.Validator.Struct(body)
+	if err != nil {
+		return dto.Company{}, fieldError{status: http.StatusBadRequest, typ: problem.TypeValidation, detail: "invalid company input", err: err}
+	}
+
+	return body, nil
+}
+
+// requireScope checks the scope of a mutation, the endpoint itself only
+// requires company:read.
+func requireScope(ctx context.Context, scope string) error {
+	principal, ok := auth.PrincipalFrom(ctx)
+	if !ok {
+		return fieldError{status: http.StatusUnauthorized, typ: problem.TypeUnauthorized, detail: "invalid token"}
+	}
+	if !principal.HasScope(scope) {
+		return fieldError{status: http.StatusForbidden, typ: problem.TypeForbidden, detail: "missing scope " + scope}
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"xm/config"
+	"xm/internal/auth"
+	"xm/internal/handlers"
+	"xm/internal/handlers/dto"
+	"xm/internal/handlers/problem"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Type   string               `json:"type"`
+			Status int                  `json:"status"`
+			Errors []problem.FieldError `json:"errors"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func TestGraphQL(t *testing.T) {
+	reader := auth.Principal{Subject: "dashboard", Scopes: []string{auth.ScopeRead}}
+	writer := auth.Principal{Subject: "sync", Scopes: []string{auth.ScopeRead, auth.ScopeWrite}}
+	limits := config.GraphQL{MaxDepth: 8, MaxComplexity: 1000, MaxBodyBytes: 1024}
+	registered := true
+
+	cases := map[string]struct {
+		query      string
+		variables  string
+		principal  auth.Principal
+		limits     *config.GraphQL
+		mocks      func(*MockcompanyRepository)
+		WantCode   int
+		WantData   string
+		WantStatus int
+		WantField  string
+	}{
+		"lookups batched": {
+			query:     `{ a: company(id: 1) { name } b: company(id: "2") { name } c: company(id: 3) { name } }`,
+			principal: reader,
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompanies(gomock.Any(), gomock.InAnyOrder([]int{1, 2, 3})).Return([]entities.Company{
+					{Id: 1, Name: "Acme"},
+					{Id: 2, Name: "Globex"},
+				}, nil)
+			},
+			WantCode: http.StatusOK,
+			WantData: `{"a":{"name":"Acme"},"b":{"name":"Globex"},"c":null}`,
+		},
+		"list": {
+			query:     `query ($limit: Int) { companies(type: "corporations", registered: true, limit: $limit) { companies { id name version } nextCursor } }`,
+			variables: `{"limit": 2}`,
+			principal: reader,
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().ListCompanies(gomock.Any(), dto.CompanyFilter{
+					Type:       "corporations",
+					Registered: &registered,
+					Sort:       "id",
+					Limit:      2,
+				}).Return([]entities.Company{{Id: 1, Name: "Acme", Version: 3}}, "next", nil)
+			},
+			WantCode: http.StatusOK,
+			WantData: `{"companies":{"companies":[{"id":"1","name":"Acme","version":3}],"nextCursor":"next"}}`,
+		},
+		"invalid list parameters": {
+			query:      `{ companies(sort: "size") { nextCursor } }`,
+			principal:  reader,
+			WantCode:   http.StatusOK,
+			WantStatus: http.StatusBadRequest,
+			WantField:  "sort",
+		},
+		"storage unavailable": {
+			query:     `{ company(id: 1) { name } }`,
+			principal: reader,
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompanies(gomock.Any(), []int{1}).Return(nil, repositories.ErrUnavailable)
+			},
+			WantCode:   http.StatusOK,
+			WantData:   `{"company":null}`,
+			WantStatus: http.StatusServiceUnavailable,
+		},
+		"create": {
+			query:     `mutation { createCompany(input: {name: "Acme", employeesAmount: 10, registered: true, type: "corporations"}) { id version } }`,
+			principal: writer,
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().CreateCompany(gomock.Any(), dto.Company{
+					Name:            "Acme",
+					EmployeesAmount: 10,
+					Registered:      true,
+					Type:            "corporations",
+				}).Return(entities.Company{Id: 1, Version: 1}, nil)
+			},
+			WantCode: http.StatusOK,
+			WantData: `{"createCompany":{"id":"1","version":1}}`,
+		},
+		"create without write scope": {
+			query:      `mutation { createCompany(input: {name: "Acme", employeesAmount: 10, registered: true, type: "corporations"}) { id } }`,
+			principal:  reader,
+			WantCode:   http.StatusOK,
+			WantData:   `null`,
+			WantStatus: http.StatusForbidden,
+		},
+		"invalid input": {
+			query:      `mutation { createCompany(input: {name: "Acme Corporation Worldwide", employeesAmount: 10, registered: true, type: "corporations"}) { id } }`,
+			principal:  writer,
+			WantCode:   http.StatusOK,
+			WantStatus: http.StatusBadRequest,
+			WantField:  "name",
+		},
+		"update of modified company": {
+			query:     `mutation { updateCompany(id: 1, version: 2, input: {name: "Acme", employeesAmount: 10, registered: true, type: "corporations"}) { version } }`,
+			principal: writer,
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().UpdateCompany(gomock.Any(), 1, 2, gomock.Any()).Return(entities.Company{}, repositories.ErrVersionMismatch)
+			},
+			WantCode:   http.StatusOK,
+			WantStatus: http.StatusPreconditionFailed,
+		},
+		"too deep": {
+			query:     `{ companies { companies { name } } }`,
+			principal: reader,
+			limits:    &config.GraphQL{MaxDepth: 2, MaxBodyBytes: 1024},
+			WantCode:  http.StatusBadRequest,
+		},
+		"too complex": {
+			query:     `query ($limit: Int) { companies(limit: $limit) { companies { id name description employeesAmount registered type version } } }`,
+			variables: `{"limit": 200}`,
+			principal: reader,
+			WantCode:  http.StatusBadRequest,
+		},
+		"too complex by variable default": {
+			query:     `query ($limit: Int = 200) { companies(limit: $limit) { companies { id name description employeesAmount registered type version } } }`,
+			principal: reader,
+			limits:    &config.GraphQL{MaxComplexity: 5000, MaxBodyBytes: 1024},
+			WantCode:  http.StatusBadRequest,
+		},
+		"unresolved limit counted as largest page": {
+			query:     `query ($limit: Int) { companies(limit: $limit) { companies { id name description employeesAmount registered type version } } }`,
+			variables: `{"limit": "20"}`,
+			principal: reader,
+			limits:    &config.GraphQL{MaxComplexity: 5000, MaxBodyBytes: 1024},
+			WantCode:  http.StatusBadRequest,
+		},
+		"unknown field": {
+			query:     `{ company(id: 1) { revenue } }`,
+			principal: reader,
+			WantCode:  http.StatusBadRequest,
+		},
+		"syntax error": {
+			query:     `{ company(id: 1) { name }`,
+			principal: reader,
+			WantCode:  http.StatusBadRequest,
+		},
+		"body too large": {
+			query:     `{ company(id: 1) { name } }` + strings.Repeat(" ", 1024),
+			principal: reader,
+			WantCode:  http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			companyRepository := NewMockcompanyRepository(ctrl)
+			if tc.mocks != nil {
+				tc.mocks(companyRepository)
+			}
+
+			cfg := config.Configuration{GraphQL: limits}
+			if tc.limits != nil {
+				cfg.GraphQL = *tc.limits
+			}
+			h, err := handlers.NewGraphQLHandler(companyRepository, logger, cfg)
+			require.NoError(t, err)
+
+			variables := tc.variables
+			if variables == "" {
+				variables = "null"
+			}
+			query, err := json.Marshal(tc.query)
+			require.NoError(t, err)
+			body := `{"query":` + string(query) + `,"variables":` + variables + `}`
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(body))
+			r = r.WithContext(auth.WithPrincipal(context.Background(), tc.principal))
+
+			http.HandlerFunc(h.GraphQL).ServeHTTP(w, r)
+
+			require.Equal(t, tc.WantCode, w.Code, w.Body.String())
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var response graphqlResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+
+			if tc.WantData != "" {
+				assert.JSONEq(t, tc.WantData, string(response.Data))
+			}
+			if tc.WantStatus == 0 {
+				assert.Empty(t, response.Errors)
+				return
+			}
+			require.Len(t, response.Errors, 1)
+			assert.Equal(t, tc.WantStatus, response.Errors[0].Extensions.Status)
+			if tc.WantField != "" {
+				require.NotEmpty(t, response.Errors[0].Extensions.Errors)
+				assert.Equal(t, tc.WantField, response.Errors[0].Extensions.Errors[0].Field)
+			}
+		})
+	}
+}
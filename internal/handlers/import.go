@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"xm/internal/handlers/dto"
+	"xm/internal/handlers/problem"
+	"xm/internal/repositories"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// maxNDJSONLine caps one line of an NDJSON import.
+const maxNDJSONLine = 1 << 20
+
+// rowError is an import row that cannot be parsed, reading continues with
+// the next row.
+type rowError struct {
+	problem.FieldError
+}
+
+func (e *rowError) Error() string {
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Detail)
+}
+
+// recordReader reads the rows of an import. Read returns the record with its
+// line, a *rowError for a row that cannot be parsed and io.EOF at the end.
+type recordReader interface {
+	Read() (dto.CompanyRecord, int, error)
+}
+
+type csvRecordReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+// newCSVRecordReader reads the header, columns are matched by name.
+func newCSVRecordReader(r io.Reader) (*csvRecordReader, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, column := range recordColumns {
+		known[column] = true
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if !known[column] {
+			return nil, &rowError{problem.FieldError{Line: 1, Field: column, Rule: "oneof", Param: strings.Join(recordColumns, " "), Detail: "unknown column"}}
+		}
+		columns[column] = i
+	}
+
+	return &csvRecordReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvRecordReader) Read() (dto.CompanyRecord, int, error) {
+	var record dto.CompanyRecord
+
+	fields, err := c.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) && errors.Is(err, csv.ErrFieldCount) {
+		return record, parseErr.StartLine, &rowError{problem.FieldError{Line: parseErr.StartLine, Rule: "csv", Detail: parseErr.Err.Error()}}
+	}
+	if err != nil {
+		return record, 0, err
+	}
+
+	line, _ := c.reader.FieldPos(0)
+	field := func(name string) string {
+		if i, ok := c.columns[name]; ok {
+			return fields[i]
+		}
+		return ""
+	}
+	number := func(name string) (int, error) {
+		v := strings.TrimSpace(field(name))
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, &rowError{problem.FieldError{Line: line, Field: name, Rule: "number", Detail: err.Error()}}
+		}
+		return n, nil
+	}
+
+	record.Name = field("name")
+	record.Description = field("description")
+	record.Type = field("type")
+
+	record.Id, err = number("id")
+	if err != nil {
+		return record, line, err
+	}
+	record.EmployeesAmount, err = number("employees_amount")
+	if err != nil {
+		return record, line, err
+	}
+	if v := strings.TrimSpace(field("registered")); v != "" {
+		record.Registered, err = strconv.ParseBool(v)
+		if err != nil {
+			return record, line, &rowError{problem.FieldError{Line: line, Field: "registered", Rule: "boolean", Detail: err.Error()}}
+		}
+	}
+
+	return record, line, nil
+}
+
+type ndjsonRecordReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONRecordReader(r io.Reader) *ndjsonRecordReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLine)
+
+	return &ndjsonRecordReader{scanner: scanner}
+}
+
+func (n *ndjsonRecordReader) Read() (dto.CompanyRecord, int, error) {
+	var record dto.CompanyRecord
+
+	for n.scanner.Scan() {
+		n.line++
+		data := bytes.TrimSpace(n.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&record)
+		if err != nil {
+			fieldErr := problem.FieldError{Line: n.line, Rule: "json", Detail: err.Error()}
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				fieldErr.Field = typeErr.Field
+			}
+			return record, n.line, &rowError{fieldErr}
+		}
+
+		return record, n.line, nil
+	}
+
+	err := n.scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+
+	return record, n.line, err
+}
+
+// LimitImportBody caps the import request body at IMPORT_MAX_BODY_BYTES.
+func (h companyHandler) LimitImportBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, h.importMaxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ImportCompanies creates or replaces the companies of a CSV or NDJSON
+// upload. Every row is validated first and all invalid rows are reported with
+// their line; the rows are applied in one transaction, only if all of them
+// are valid. With dry_run=true nothing is applied and the report tells what
+// would be created or updated.
+func (h companyHandler) ImportCompanies(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var reader recordReader
+	var dryRun bool
+
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			h.errValidateImport(w, r, fmt.Errorf("dry_run: %w", err))
+			return
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case mediaTypeCSV:
+		reader, err = newCSVRecordReader(r.Body)
+	case mediaTypeNDJSON:
+		reader = newNDJSONRecordReader(r.Body)
+	default:
+		h.writeProblem(w, r, problem.New(r, http.StatusUnsupportedMediaType, problem.TypeUnsupportedMedia,
+			fmt.Sprintf("use %s or %s", mediaTypeCSV, mediaTypeNDJSON)))
+		return
+	}
+
+	var rows []dto.CompanyImport
+	var fieldErrors []problem.FieldError
+	var read int
+	names := map[string]int{}
+	ids := map[int]int{}
+
+	for err == nil {
+		var record dto.CompanyRecord
+		var line int
+
+		record, line, err = reader.Read()
+		if !errors.Is(err, io.EOF) {
+			read++
+		}
+		if read > h.importMaxRows {
+			h.errImportTooLarge(w, r, fmt.Sprintf("import has more than %d rows", h.importMaxRows))
+			return
+		}
+
+		var rowErr *rowError
+		if errors.As(err, &rowErr) {
+			fieldErrors = append(fieldErrors, rowErr.FieldError)
+			err = nil
+			continue
+		}
+		if err != nil {
+			break
+		}
+
+		row := dto.CompanyImport{Line: line, Id: record.Id, Company: dto.Company{
+			Name:            record.Name,
+			Description:     record.Description,
+			EmployeesAmount: record.EmployeesAmount,
+			Registered:      record.Registered,
+			Type:            record.Type,
+		}}
+		rowErrors := validateImportRow(row, names, ids)
+		if len(rowErrors) > 0 {
+			fieldErrors = append(fieldErrors, rowErrors...)
+			continue
+		}
+
+		rows = append(rows, row)
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		h.errImportTooLarge(w, r, fmt.Sprintf("import body is larger than %d bytes", maxBytesErr.Limit))
+		return
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		h.errValidateImport(w, r, err)
+		return
+	}
+
+	if len(fieldErrors) > 0 {
+		h.errInvalidImport(w, r, fmt.Sprintf("import has %d errors, nothing was imported", len(fieldErrors)), fieldErrors)
+		return
+	}
+
+	report := dto.ImportReport{DryRun: dryRun, Rows: make([]dto.ImportRow, 0, len(rows))}
+	if len(rows) == 0 {
+		h.writeJSON(w, r, http.StatusOK, report)
+		return
+	}
+
+	results, err := h.companyRepository.ImportCompanies(r.Context(), rows, dryRun)
+
+	var batchErr *repositories.BatchError
+	if errors.As(err, &batchErr) {
+		p := repositoryProblem(r, batchErr.Err)
+		h.errInvalidImport(w, r, "nothing was imported", []problem.FieldError{{
+			Line:   rows[batchErr.Index].Line,
+			Detail: p.Detail,
+		}})
+		return
+	}
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	for i, result := range results {
+		row := dto.ImportRow{Line: rows[i].Line, Action: result.Op, Id: result.Company.Id}
+		if result.Op == dto.BatchCreate {
+			report.Created++
+			// A dry run rolls back, the id it got will not be used.
+			if dryRun {
+				row.Id = 0
+			}
+		} else {
+			report.Updated++
+		}
+		report.Rows = append(report.Rows, row)
+	}
+
+	h.writeJSON(w, r, http.StatusOK, report)
+}
+
+// validateImportRow checks the row against the company rules and against the
+// rows before it, an import cannot name or replace a company twice.
+func validateImportRow(row dto.CompanyImport, names map[string]int, ids map[int]int) []problem.FieldError {
+	var fieldErrors []problem.FieldError
+
+	if row.Id < 0 {
+		fieldErrors = append(fieldErrors, problem.FieldError{Line: row.Line, Field: "id", Rule: "min", Param: "0"})
+	}
+
+	var validationErrors validator.ValidationErrors
+	if errors.As(dto.Validator.Struct(row.Company), &validationErrors) {
+		for _, fe := range validationErrors {
+			fieldErrors = append(fieldErrors, problem.FieldError{Line: row.Line, Field: fe.Field(), Rule: fe.Tag(), Param: fe.Param()})
+		}
+	}
+
+	if line, ok := names[row.Company.Name]; ok && row.Company.Name != "" {
+		fieldErrors = append(fieldErrors, problem.FieldError{Line: row.Line, Field: "name", Rule: "unique", Detail: fmt.Sprintf("same name as line %d", line)})
+	}
+	names[row.Company.Name] = row.Line
+
+	if line, ok := ids[row.Id]; ok && row.Id != 0 {
+		fieldErrors = append(fieldErrors, problem.FieldError{Line: row.Line, Field: "id", Rule: "unique", Detail: fmt.Sprintf("same id as line %d", line)})
+	}
+	ids[row.Id] = row.Line
+
+	return fieldErrors
+}
+
+func (h companyHandler) errValidateImport(w http.ResponseWriter, r *http.Request, err error) {
+	h.log(r).Warn().Timestamp().Msg(err.Error())
+
+	p := problem.Validation(r, fmt.Sprintf("invalid import: %s", err), nil)
+	var rowErr *rowError
+	if errors.As(err, &rowErr) {
+		p.Detail = "invalid import header"
+		p.Errors = append(p.Errors, rowErr.FieldError)
+	}
+
+	h.writeProblem(w, r, p)
+}
+
+func (h companyHandler) errInvalidImport(w http.ResponseWriter, r *http.Request, detail string, fieldErrors []problem.FieldError) {
+	h.log(r).Warn().Timestamp().Msg(detail)
+
+	p := problem.New(r, http.StatusUnprocessableEntity, problem.TypeInvalid, detail)
+	p.Errors = fieldErrors
+
+	h.writeProblem(w, r, p)
+}
+
+func (h companyHandler) errImportTooLarge(w http.ResponseWriter, r *http.Request, detail string) {
+	h.log(r).Warn().Timestamp().Msg(detail)
+	h.writeProblem(w, r, problem.New(r, http.StatusRequestEntityTooLarge, problem.TypeTooLarge, detail))
+}
@@ -0,0 +1,173 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"xm/config"
+	"xm/internal/handlers"
+	"xm/internal/handlers/dto"
+	"xm/internal/handlers/problem"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const importCSV = "name,employees_amount,registered,type\n" +
+	"Acme,10,true,corporations\n" +
+	"Beta,5,true,cooperative\n"
+
+func TestImportCompanies(t *testing.T) {
+	acme := dto.Company{Name: "Acme", EmployeesAmount: 10, Registered: true, Type: "corporations"}
+	beta := dto.Company{Name: "Beta", EmployeesAmount: 5, Registered: true, Type: "cooperative"}
+
+	cases := map[string]struct {
+		query       string
+		contentType string
+		body        string
+		mocks       func(*MockcompanyRepository)
+		WantCode    int
+		WantReport  *dto.ImportReport
+		WantErrors  []problem.FieldError
+	}{
+		"csv": {
+			contentType: "text/csv",
+			body:        importCSV,
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().ImportCompanies(gomock.Any(), []dto.CompanyImport{{Line: 2, Company: acme}, {Line: 3, Company: beta}}, false).
+					Return([]entities.BatchResult{
+						{Op: dto.BatchCreate, Company: entities.Company{Id: 10}},
+						{Op: dto.BatchUpdate, Company: entities.Company{Id: 5}},
+					}, nil)
+			},
+			WantCode: http.StatusOK,
+			WantReport: &dto.ImportReport{Created: 1, Updated: 1, Rows: []dto.ImportRow{
+				{Line: 2, Action: dto.BatchCreate, Id: 10},
+				{Line: 3, Action: dto.BatchUpdate, Id: 5},
+			}},
+		},
+		"ndjson dry run": {
+			query:       "?dry_run=true",
+			contentType: "application/x-ndjson",
+			body:        `{"name":"Acme","employees_amount":10,"registered":true,"type":"corporations"}` + "\n\n" + `{"id":5,"name":"Beta","employees_amount":5,"registered":true,"type":"cooperative","version":9}` + "\n",
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().ImportCompanies(gomock.Any(), []dto.CompanyImport{{Line: 1, Company: acme}, {Line: 3, Id: 5, Company: beta}}, true).
+					Return([]entities.BatchResult{
+						{Op: dto.BatchCreate, Company: entities.Company{Id: 10}},
+						{Op: dto.BatchUpdate, Company: entities.Company{Id: 5}},
+					}, nil)
+			},
+			WantCode: http.StatusOK,
+			WantReport: &dto.ImportReport{DryRun: true, Created: 1, Updated: 1, Rows: []dto.ImportRow{
+				{Line: 1, Action: dto.BatchCreate},
+				{Line: 3, Action: dto.BatchUpdate, Id: 5},
+			}},
+		},
+		"invalid rows": {
+			contentType: "text/csv",
+			body: "id,name,employees_amount,registered,type\n" +
+				",Acme,10,true,corporations\n" +
+				",Beta,many,true,cooperative\n" +
+				"3,,10,true,corporations\n" +
+				",Acme,10,true\n" +
+				"4,Acme,10,true,corporations\n",
+			WantCode: http.StatusUnprocessableEntity,
+			WantErrors: []problem.FieldError{
+				{Line: 3, Field: "employees_amount", Rule: "number", Detail: `strconv.Atoi: parsing "many": invalid syntax`},
+				{Line: 4, Field: "name", Rule: "required"},
+				{Line: 5, Rule: "csv", Detail: "wrong number of fields"},
+				{Line: 6, Field: "name", Rule: "unique", Detail: "same name as line 2"},
+			},
+		},
+		"invalid json": {
+			contentType: "application/x-ndjson",
+			body:        `{"name":"Acme","employees_amount":"ten"}` + "\n" + `{"name":"Beta","owner":"x"}` + "\n",
+			WantCode:    http.StatusUnprocessableEntity,
+			WantErrors: []problem.FieldError{
+				{Line: 1, Field: "employees_amount", Rule: "json", Detail: "json: cannot unmarshal string into Go struct field CompanyRecord.employees_amount of type int"},
+				{Line: 2, Rule: "json", Detail: `json: unknown field "owner"`},
+			},
+		},
+		"conflict in storage": {
+			contentType: "text/csv",
+			body:        importCSV,
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().ImportCompanies(gomock.Any(), gomock.Len(2), false).
+					Return(nil, &repositories.BatchError{Index: 1, Err: repositories.ErrDuplicateName})
+			},
+			WantCode:   http.StatusUnprocessableEntity,
+			WantErrors: []problem.FieldError{{Line: 3, Detail: "company with this name already exists"}},
+		},
+		"unknown column": {
+			contentType: "text/csv",
+			body:        "name,owner\nAcme,x\n",
+			WantCode:    http.StatusBadRequest,
+			WantErrors:  []problem.FieldError{{Line: 1, Field: "owner", Rule: "oneof", Param: "id name description employees_amount registered type version", Detail: "unknown column"}},
+		},
+		"too many rows": {
+			contentType: "text/csv",
+			body:        importCSV + strings.Repeat("Gamma,1,true,corporations\n", 4),
+			WantCode:    http.StatusRequestEntityTooLarge,
+		},
+		"body too large": {
+			contentType: "text/csv",
+			body:        "name,description\nAcme," + strings.Repeat("a", 1024) + "\n",
+			WantCode:    http.StatusRequestEntityTooLarge,
+		},
+		"unsupported media type": {
+			contentType: "application/json",
+			body:        `[]`,
+			WantCode:    http.StatusUnsupportedMediaType,
+		},
+		"empty": {
+			contentType: "text/csv",
+			body:        "name,type\n",
+			WantCode:    http.StatusOK,
+			WantReport:  &dto.ImportReport{Rows: []dto.ImportRow{}},
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			companyRepository := NewMockcompanyRepository(ctrl)
+			if tc.mocks != nil {
+				tc.mocks(companyRepository)
+			}
+
+			cfg := config.Configuration{Import: config.Import{MaxRows: 5, MaxBodyBytes: 1024}}
+			h := handlers.NewCompanyHandler(companyRepository, logger, cfg)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/company/import"+tc.query, strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+
+			h.LimitImportBody(http.HandlerFunc(h.ImportCompanies)).ServeHTTP(w, r)
+
+			require.Equal(t, tc.WantCode, w.Code, w.Body.String())
+
+			if tc.WantReport != nil {
+				var report dto.ImportReport
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+				assert.Equal(t, *tc.WantReport, report)
+				return
+			}
+
+			if tc.WantErrors != nil {
+				var p problem.Problem
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+				assert.Equal(t, tc.WantErrors, p.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+)
+
+const ContentType = "application/problem+json"
+
+const (
+	TypeDefault              = "about:blank"
+	TypeValidation           = "/problems/validation-error"
+	TypeGone                 = "/problems/gone"
+	TypeNotFound             = "/problems/not-found"
+	TypeConflict             = "/problems/conflict"
+	TypeInvalid              = "/problems/invalid-data"
+	TypeUnavailable          = "/problems/unavailable"
+	TypeUnauthorized         = "/problems/unauthorized"
+	TypeForbidden            = "/problems/forbidden"
+	TypeUnsupportedMedia     = "/problems/unsupported-media-type"
+	TypeInvalidPatch         = "/problems/invalid-patch"
+	TypePreconditionFailed   = "/problems/precondition-failed"
+	TypePreconditionRequired = "/problems/precondition-required"
+	TypeIdempotencyMismatch  = "/problems/idempotency-key-mismatch"
+	TypeTooLarge             = "/problems/payload-too-large"
+)
+
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is an invalid field. Line locates it in an uploaded file and
+// Detail describes errors that are not validation rules.
+type FieldError struct {
+	Line   int    `json:"line,omitempty"`
+	Field  string `json:"field"`
+	Rule   string `json:"rule"`
+	Param  string `json:"param,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func New(r *http.Request, status int, problemType string, detail string) Problem {
+	return Problem{
+		Type:      problemType,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
+
+func Validation(r *http.Request, detail string, err error) Problem {
+	p := New(r, http.StatusBadRequest, TypeValidation, detail)
+	p.Errors = FieldErrors(err)
+
+	return p
+}
+
+// FieldErrors lists the failed rules of a validator error, nil for other
+// errors.
+func FieldErrors(err error) []FieldError {
+	var fieldErrors []FieldError
+
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		for _, fe := range validationErrors {
+			// The namespace locates fields of nested structs and slice
+			// elements, without the name of the validated type.
+			field := fe.Namespace()
+			if i := strings.Index(field, "."); i >= 0 {
+				field = field[i+1:]
+			}
+			fieldErrors = append(fieldErrors, FieldError{
+				Field: field,
+				Rule:  fe.Tag(),
+				Param: fe.Param(),
+			})
+		}
+	}
+
+	return fieldErrors
+}
+
+func Write(w http.ResponseWriter, p Problem) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	_, err = w.Write(body)
+
+	return err
+}
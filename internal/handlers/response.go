@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"xm/internal/handlers/problem"
+	"xm/internal/logging"
+	"xm/internal/repositories"
+
+	"github.com/rs/zerolog"
+)
+
+// responder writes the JSON and problem responses of a handler and logs with
+// the request logger.
+type responder struct {
+	logger zerolog.Logger
+}
+
+func (h responder) writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		h.log(r).Error().Timestamp().Msg(err.Error())
+		h.writeProblem(w, r, problem.New(r, http.StatusInternalServerError, problem.TypeDefault, "response marshal error"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(status)
+	_, err = w.Write(response)
+	if err != nil {
+		h.log(r).Warn().Timestamp().Msg(err.Error())
+	}
+}
+
+func (h responder) writeProblem(w http.ResponseWriter, r *http.Request, p problem.Problem) {
+	err := problem.Write(w, p)
+	if err != nil {
+		h.log(r).Warn().Timestamp().Msg(err.Error())
+	}
+}
+
+// log returns the request logger, which carries the request ID and subject.
+func (h responder) log(r *http.Request) *zerolog.Logger {
+	return logging.FromContext(r.Context(), h.logger)
+}
+
+// statusClientClosedRequest is logged for requests the client abandoned
+// before a response was written.
+const statusClientClosedRequest = 499
+
+func (h responder) errRepository(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, repositories.ErrCanceled) {
+		h.log(r).Info().Timestamp().Int("status", statusClientClosedRequest).Msg(err.Error())
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+
+	p := repositoryProblem(r, err)
+
+	if p.Status >= http.StatusInternalServerError {
+		h.log(r).Error().Timestamp().Msg(err.Error())
+	} else {
+		h.log(r).Warn().Timestamp().Msg(err.Error())
+	}
+
+	h.writeProblem(w, r, p)
+}
+
+func repositoryProblem(r *http.Request, err error) problem.Problem {
+	status, typ, detail := RepositoryError(err)
+
+	return problem.New(r, status, typ, detail)
+}
+
+// RepositoryError is how a repository error is reported to clients: the HTTP
+// status, the problem type and its detail. The gRPC server derives its status
+// codes from it, so both APIs answer the same error the same way.
+func RepositoryError(err error) (status int, typ string, detail string) {
+	switch {
+	case errors.Is(err, repositories.ErrCompanyNotFound):
+		return http.StatusNotFound, problem.TypeNotFound, "company not found"
+	case errors.Is(err, repositories.ErrHistoryNotFound):
+		return http.StatusNotFound, problem.TypeNotFound, "company version not found"
+	case errors.Is(err, repositories.ErrWebhookNotFound):
+		return http.StatusNotFound, problem.TypeNotFound, "webhook not found"
+	case errors.Is(err, repositories.ErrCompanyDeleted):
+		return http.StatusGone, problem.TypeGone, "company was deleted"
+	case errors.Is(err, repositories.ErrCompanyNotDeleted):
+		return http.StatusConflict, problem.TypeConflict, "company is not deleted"
+	case errors.Is(err, repositories.ErrDuplicateName):
+		return http.StatusConflict, problem.TypeConflict, "company with this name already exists"
+	case errors.Is(err, repositories.ErrInvalidCompanyType):
+		return http.StatusUnprocessableEntity, problem.TypeInvalid, "invalid company type"
+	case errors.Is(err, repositories.ErrConstraintViolation):
+		return http.StatusUnprocessableEntity, problem.TypeInvalid, "company violates data constraints"
+	case errors.Is(err, repositories.ErrVersionMismatch):
+		return http.StatusPreconditionFailed, problem.TypePreconditionFailed, "company was modified, fetch it again to get the current ETag"
+	case errors.Is(err, repositories.ErrUnavailable):
+		return http.StatusServiceUnavailable, problem.TypeUnavailable, "storage is temporarily unavailable"
+	case errors.Is(err, repositories.ErrTimeout):
+		return http.StatusServiceUnavailable, problem.TypeUnavailable, "storage did not respond in time"
+	}
+
+	return http.StatusInternalServerError, problem.TypeDefault, "internal error"
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"xm/config"
+	"xm/internal/handlers/dto"
+	"xm/internal/handlers/problem"
+	"xm/internal/repositories/entities"
+	"xm/internal/stream"
+
+	"github.com/rs/zerolog"
+)
+
+const mediaTypeEventStream = "text/event-stream"
+
+// eventReset tells a stream client that events may have been missed and its
+// state has to be reloaded.
+const eventReset = "reset"
+
+type companyStream interface {
+	Subscribe(lastEventId int64, resume bool) (*stream.Subscription, []entities.CompanyEvent, bool)
+	Unsubscribe(s *stream.Subscription)
+}
+
+type streamHandler struct {
+	responder
+	stream       companyStream
+	heartbeat    time.Duration
+	writeTimeout time.Duration
+}
+
+func NewStreamHandler(stream companyStream, logger zerolog.Logger, cfg config.Stream) streamHandler {
+	return streamHandler{
+		responder:    responder{logger: logger},
+		stream:       stream,
+		heartbeat:    cfg.Heartbeat,
+		writeTimeout: cfg.WriteTimeout,
+	}
+}
+
+// StreamCompanies pushes company events as server-sent events until the
+// client goes away. A client that reconnects with Last-Event-ID first gets
+// the events it missed from the replay buffer; when that event is no longer
+// buffered it gets a reset event instead.
+func (h streamHandler) StreamCompanies(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseStreamFilter(r.URL.Query())
+	if err == nil {
+		err = dto.Validator.Struct(filter)
+	}
+	if err != nil {
+		h.log(r).Warn().Timestamp().Msg(err.Error())
+		h.writeProblem(w, r, problem.Validation(r, "invalid stream parameters", err))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.log(r).Error().Timestamp().Msg("response writer does not support flushing")
+		h.writeProblem(w, r, problem.New(r, http.StatusInternalServerError, problem.TypeDefault, "streaming is not supported"))
+		return
+	}
+
+	var lastEventId int64
+	lastEvent := r.Header.Get("Last-Event-ID")
+	if lastEvent != "" {
+		// An ID that is not a number is never found and resets the client.
+		lastEventId, _ = strconv.ParseInt(lastEvent, 10, 64)
+	}
+
+	subscription, replay, found := h.stream.Subscribe(lastEventId, lastEvent != "")
+	defer h.stream.Unsubscribe(subscription)
+
+	w.Header().Set("Content-Type", mediaTypeEventStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keeps proxies such as nginx from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(fn func(w io.Writer) error) bool {
+		err := stream.ExtendWriteDeadline(r.Context(), h.writeTimeout)
+		if err == nil {
+			err = fn(w)
+		}
+		if err != nil {
+			h.log(r).Info().Timestamp().Msg(err.Error())
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	if !found && !write(writeResetEvent) {
+		return
+	}
+	for _, event := range replay {
+		if filter.Matches(event) && !write(eventWriter(event)) {
+			return
+		}
+	}
+	if !write(writeComment("connected")) {
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if !write(writeComment("heartbeat")) {
+				return
+			}
+		case event, ok := <-subscription.Events:
+			if !ok {
+				// A subscriber that fell behind reconnects and resumes from
+				// the replay buffer.
+				if subscription.Reset() {
+					write(writeResetEvent)
+				}
+				return
+			}
+			if filter.Matches(event) && !write(eventWriter(event)) {
+				return
+			}
+		}
+	}
+}
+
+// parseStreamFilter reads the filters, every one can be repeated or comma
+// separated and matches any of its values.
+func parseStreamFilter(q url.Values) (dto.StreamFilter, error) {
+	var filter dto.StreamFilter
+
+	for _, v := range splitValues(q["company_id"]) {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return dto.StreamFilter{}, fmt.Errorf("company_id: %w", err)
+		}
+		filter.CompanyIds = append(filter.CompanyIds, id)
+	}
+	filter.Types = splitValues(q["type"])
+	filter.EventTypes = splitValues(q["event_type"])
+
+	return filter, nil
+}
+
+func splitValues(values []string) []string {
+	var split []string
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				split = append(split, v)
+			}
+		}
+	}
+
+	return split
+}
+
+func eventWriter(event entities.CompanyEvent) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+		return err
+	}
+}
+
+func writeResetEvent(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventReset)
+	return err
+}
+
+func writeComment(comment string) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, ": %s\n\n", comment)
+		return err
+	}
+}
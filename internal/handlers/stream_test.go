@@ -0,0 +1,136 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/handlers"
+	"xm/internal/repositories/entities"
+	"xm/internal/stream"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readEvents reads server-sent events until n of them were read or until the
+// until comment, other comments are skipped.
+func readEvents(t *testing.T, body *bufio.Reader, n int, until string) []string {
+	var events []string
+	var event []string
+	for len(events) != n {
+		line, err := body.ReadString('\n')
+		require.NoError(t, err)
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case until != "" && line == until:
+			return events
+		case line == "" && len(event) > 0:
+			events = append(events, strings.Join(event, "|"))
+			event = nil
+		case strings.HasPrefix(line, "id:"), strings.HasPrefix(line, "event:"):
+			event = append(event, line)
+		}
+	}
+
+	return events
+}
+
+func TestStreamCompanies(t *testing.T) {
+	cases := map[string]struct {
+		Query       string
+		LastEventId string
+		WantCode    int
+		WantEvents  []string
+	}{
+		"live": {
+			WantCode:   200,
+			WantEvents: []string{"id: 4|event: CompanyCreated", "id: 5|event: CompanyDeleted"},
+		},
+		"resume": {
+			LastEventId: "2",
+			WantCode:    200,
+			WantEvents:  []string{"id: 3|event: CompanyUpdated", "id: 4|event: CompanyCreated", "id: 5|event: CompanyDeleted"},
+		},
+		"resume filtered": {
+			Query:       "?company_id=1,2&event_type=CompanyCreated&event_type=CompanyDeleted",
+			LastEventId: "1",
+			WantCode:    200,
+			WantEvents:  []string{"id: 2|event: CompanyCreated", "id: 5|event: CompanyDeleted"},
+		},
+		"filter by company type": {
+			Query:      "?type=cooperative",
+			WantCode:   200,
+			WantEvents: []string{"id: 4|event: CompanyCreated"},
+		},
+		"resume from evicted event": {
+			LastEventId: "100",
+			WantCode:    200,
+			WantEvents:  []string{"event: reset", "id: 4|event: CompanyCreated"},
+		},
+		"invalid company id": {
+			Query:    "?company_id=abc",
+			WantCode: 400,
+		},
+		"invalid event type": {
+			Query:    "?event_type=CompanyRenamed",
+			WantCode: 400,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			broker := stream.NewBroker(10, 10)
+			broker.Publish([]entities.CompanyEvent{
+				{Id: 1, CompanyId: 1, Type: entities.EventCompanyCreated},
+				{Id: 2, CompanyId: 2, Type: entities.EventCompanyCreated},
+				{Id: 3, CompanyId: 1, Type: entities.EventCompanyUpdated},
+			})
+
+			handler := handlers.NewStreamHandler(broker, logger, config.Stream{Heartbeat: time.Hour, WriteTimeout: time.Second})
+			server := httptest.NewUnstartedServer(http.HandlerFunc(handler.StreamCompanies))
+			server.Config.ConnContext = stream.ConnContext
+			server.Start()
+			defer server.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			r, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+tc.Query, nil)
+			require.NoError(t, err)
+			if tc.LastEventId != "" {
+				r.Header.Set("Last-Event-ID", tc.LastEventId)
+			}
+
+			res, err := http.DefaultClient.Do(r)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tc.WantCode, res.StatusCode)
+			if tc.WantCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+			body := bufio.NewReader(res.Body)
+			// The connected comment follows the replay, live events come after.
+			events := readEvents(t, body, -1, ": connected")
+
+			broker.Publish([]entities.CompanyEvent{
+				{Id: 4, CompanyId: 3, Type: entities.EventCompanyCreated, Company: entities.Company{Type: "cooperative"}},
+				{Id: 5, CompanyId: 1, Type: entities.EventCompanyDeleted},
+			})
+
+			events = append(events, readEvents(t, body, len(tc.WantEvents)-len(events), "")...)
+			assert.Equal(t, tc.WantEvents, events)
+		})
+	}
+}
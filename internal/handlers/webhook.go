@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"xm/internal/auth"
+	"xm/internal/handlers/dto"
+	"xm/internal/handlers/problem"
+	"xm/internal/repositories/entities"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+type webhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook dto.Webhook, owner string) (entities.Webhook, error)
+	ListWebhooks(ctx context.Context, owner string) ([]entities.Webhook, error)
+	GetWebhook(ctx context.Context, id int64, owner string) (entities.Webhook, error)
+	SetWebhookEnabled(ctx context.Context, id int64, owner string, enabled bool) (entities.Webhook, error)
+	DeleteWebhook(ctx context.Context, id int64, owner string) error
+	ListDeliveries(ctx context.Context, webhookId int64, limit int) ([]entities.WebhookDelivery, error)
+}
+
+type addressPolicy interface {
+	CheckURL(ctx context.Context, rawURL string) error
+}
+
+// deliveryListLimit is the number of latest deliveries listed for a webhook.
+const deliveryListLimit = 50
+
+// webhookHandler manages webhook subscriptions. A subscription belongs to
+// the subject that created it, admins see and delete all of them.
+type webhookHandler struct {
+	responder
+	webhookRepository webhookRepository
+	addresses         addressPolicy
+}
+
+// NewWebhookHandler rejects webhook URLs whose host the policy does not allow.
+func NewWebhookHandler(webhookRepository webhookRepository, addresses addressPolicy, logger zerolog.Logger) webhookHandler {
+	return webhookHandler{
+		responder:         responder{logger: logger},
+		webhookRepository: webhookRepository,
+		addresses:         addresses,
+	}
+}
+
+func (h webhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var err error
+	var webhookBody dto.Webhook
+
+	err = json.NewDecoder(r.Body).Decode(&webhookBody)
+	if err != nil {
+		h.errValidateWebhookStruct(w, r, err)
+		return
+	}
+
+	err = dto.Validator.Struct(webhookBody)
+	if err != nil {
+		h.errValidateWebhookStruct(w, r, err)
+		return
+	}
+
+	err = h.addresses.CheckURL(r.Context(), webhookBody.URL)
+	if err != nil {
+		h.log(r).Warn().Timestamp().Msg(err.Error())
+		h.writeProblem(w, r, problem.New(r, http.StatusBadRequest, problem.TypeValidation,
+			"webhook url must not point to a loopback, link-local or private address"))
+		return
+	}
+
+	webhook, err := h.webhookRepository.CreateWebhook(r.Context(), webhookBody, auth.Subject(r.Context()))
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusCreated, webhook)
+}
+
+func (h webhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.webhookRepository.ListWebhooks(r.Context(), owner(r))
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, dto.WebhookList{Webhooks: webhooks})
+}
+
+func (h webhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.errWebhookId(w, r, err)
+		return
+	}
+
+	webhook, err := h.webhookRepository.GetWebhook(r.Context(), id, owner(r))
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, webhook)
+}
+
+// UpdateWebhook enables or disables the webhook. Enabling resets its
+// failures, so a webhook disabled after WEBHOOK_MAX_FAILURES receives new
+// events again once its endpoint is fixed.
+func (h webhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhookBody dto.WebhookPatch
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.errWebhookId(w, r, err)
+		return
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&webhookBody)
+	if err == nil {
+		err = dto.Validator.Struct(webhookBody)
+	}
+	if err != nil {
+		h.errValidateWebhookStruct(w, r, err)
+		return
+	}
+
+	webhook, err := h.webhookRepository.SetWebhookEnabled(r.Context(), id, owner(r), *webhookBody.Enabled)
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, webhook)
+}
+
+// DeleteWebhook removes the subscription, its pending deliveries are dropped.
+func (h webhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.errWebhookId(w, r, err)
+		return
+	}
+
+	err = h.webhookRepository.DeleteWebhook(r.Context(), id, owner(r))
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries returns the latest deliveries of the webhook, newest first,
+// to tell why an endpoint was disabled.
+func (h webhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		h.errWebhookId(w, r, err)
+		return
+	}
+
+	_, err = h.webhookRepository.GetWebhook(r.Context(), id, owner(r))
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	deliveries, err := h.webhookRepository.ListDeliveries(r.Context(), id, deliveryListLimit)
+	if err != nil {
+		h.errRepository(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, dto.WebhookDeliveryList{Deliveries: deliveries})
+}
+
+// owner limits the request to the webhooks of its subject, for admins it is
+// empty and matches every webhook.
+func owner(r *http.Request) string {
+	principal, _ := auth.PrincipalFrom(r.Context())
+	if principal.HasRole(auth.RoleAdmin) {
+		return ""
+	}
+
+	return principal.Subject
+}
+
+func (h webhookHandler) errWebhookId(w http.ResponseWriter, r *http.Request, err error) {
+	h.log(r).Warn().Timestamp().Msg(err.Error())
+	h.writeProblem(w, r, problem.New(r, http.StatusBadRequest, problem.TypeValidation, "invalid webhook ID"))
+}
+
+func (h webhookHandler) errValidateWebhookStruct(w http.ResponseWriter, r *http.Request, err error) {
+	h.log(r).Warn().Timestamp().Msg(err.Error())
+	h.writeProblem(w, r, problem.Validation(r, "invalid webhook request body", err))
+}
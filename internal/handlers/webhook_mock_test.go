@@ -0,0 +1,163 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: webhook.go
+
+// Package handlers is a generated GoMock package.
+package handlers_test
+
+import (
+	context "context"
+	reflect "reflect"
+	dto "xm/internal/handlers/dto"
+	entities "xm/internal/repositories/entities"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockwebhookRepository is a mock of webhookRepository interface.
+type MockwebhookRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockwebhookRepositoryMockRecorder
+}
+
+// MockwebhookRepositoryMockRecorder is the mock recorder for MockwebhookRepository.
+type MockwebhookRepositoryMockRecorder struct {
+	mock *MockwebhookRepository
+}
+
+// NewMockwebhookRepository creates a new mock instance.
+func NewMockwebhookRepository(ctrl *gomock.Controller) *MockwebhookRepository {
+	mock := &MockwebhookRepository{ctrl: ctrl}
+	mock.recorder = &MockwebhookRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockwebhookRepository) EXPECT() *MockwebhookRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CreateWebhook mocks base method.
+func (m *MockwebhookRepository) CreateWebhook(ctx context.Context, webhook dto.Webhook, owner string) (entities.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhook", ctx, webhook, owner)
+	ret0, _ := ret[0].(entities.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWebhook indicates an expected call of CreateWebhook.
+func (mr *MockwebhookRepositoryMockRecorder) CreateWebhook(ctx, webhook, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhook", reflect.TypeOf((*MockwebhookRepository)(nil).CreateWebhook), ctx, webhook, owner)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockwebhookRepository) DeleteWebhook(ctx context.Context, id int64, owner string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", ctx, id, owner)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockwebhookRepositoryMockRecorder) DeleteWebhook(ctx, id, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockwebhookRepository)(nil).DeleteWebhook), ctx, id, owner)
+}
+
+// GetWebhook mocks base method.
+func (m *MockwebhookRepository) GetWebhook(ctx context.Context, id int64, owner string) (entities.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhook", ctx, id, owner)
+	ret0, _ := ret[0].(entities.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhook indicates an expected call of GetWebhook.
+func (mr *MockwebhookRepositoryMockRecorder) GetWebhook(ctx, id, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhook", reflect.TypeOf((*MockwebhookRepository)(nil).GetWebhook), ctx, id, owner)
+}
+
+// ListDeliveries mocks base method.
+func (m *MockwebhookRepository) ListDeliveries(ctx context.Context, webhookId int64, limit int) ([]entities.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDeliveries", ctx, webhookId, limit)
+	ret0, _ := ret[0].([]entities.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDeliveries indicates an expected call of ListDeliveries.
+func (mr *MockwebhookRepositoryMockRecorder) ListDeliveries(ctx, webhookId, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDeliveries", reflect.TypeOf((*MockwebhookRepository)(nil).ListDeliveries), ctx, webhookId, limit)
+}
+
+// ListWebhooks mocks base method.
+func (m *MockwebhookRepository) ListWebhooks(ctx context.Context, owner string) ([]entities.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWebhooks", ctx, owner)
+	ret0, _ := ret[0].([]entities.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWebhooks indicates an expected call of ListWebhooks.
+func (mr *MockwebhookRepositoryMockRecorder) ListWebhooks(ctx, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWebhooks", reflect.TypeOf((*MockwebhookRepository)(nil).ListWebhooks), ctx, owner)
+}
+
+// SetWebhookEnabled mocks base method.
+func (m *MockwebhookRepository) SetWebhookEnabled(ctx context.Context, id int64, owner string, enabled bool) (entities.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetWebhookEnabled", ctx, id, owner, enabled)
+	ret0, _ := ret[0].(entities.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetWebhookEnabled indicates an expected call of SetWebhookEnabled.
+func (mr *MockwebhookRepositoryMockRecorder) SetWebhookEnabled(ctx, id, owner, enabled interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetWebhookEnabled", reflect.TypeOf((*MockwebhookRepository)(nil).SetWebhookEnabled), ctx, id, owner, enabled)
+}
+
+// MockaddressPolicy is a mock of addressPolicy interface.
+type MockaddressPolicy struct {
+	ctrl     *gomock.Controller
+	recorder *MockaddressPolicyMockRecorder
+}
+
+// MockaddressPolicyMockRecorder is the mock recorder for MockaddressPolicy.
+type MockaddressPolicyMockRecorder struct {
+	mock *MockaddressPolicy
+}
+
+// NewMockaddressPolicy creates a new mock instance.
+func NewMockaddressPolicy(ctrl *gomock.Controller) *MockaddressPolicy {
+	mock := &MockaddressPolicy{ctrl: ctrl}
+	mock.recorder = &MockaddressPolicyMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockaddressPolicy) EXPECT() *MockaddressPolicyMockRecorder {
+	return m.recorder
+}
+
+// CheckURL mocks base method.
+func (m *MockaddressPolicy) CheckURL(ctx context.Context, rawURL string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckURL", ctx, rawURL)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckURL indicates an expected call of CheckURL.
+func (mr *MockaddressPolicyMockRecorder) CheckURL(ctx, rawURL interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckURL", reflect.TypeOf((*MockaddressPolicy)(nil).CheckURL), ctx, rawURL)
+}
@@ -0,0 +1,257 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"xm/internal/auth"
+	"xm/internal/handlers"
+	"xm/internal/handlers/dto"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+	"xm/internal/webhooks"
+
+	"github.com/go-chi/chi/v5"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateWebhook(t *testing.T) {
+	cases := map[string]struct {
+		mocks    func(*MockwebhookRepository)
+		Body     string
+		WantCode int
+	}{
+		"success": {
+			mocks: func(mr *MockwebhookRepository) {
+				mr.EXPECT().CreateWebhook(gomock.Any(), dto.Webhook{
+					URL:        "https://example.com/hooks",
+					Secret:     "0123456789abcdef",
+					EventTypes: []string{entities.EventCompanyCreated},
+				}, "user-1").Return(entities.Webhook{Id: 1, Owner: "user-1", Enabled: true}, nil)
+			},
+			Body:     `{"url":"https://example.com/hooks","secret":"0123456789abcdef","event_types":["CompanyCreated"]}`,
+			WantCode: 201,
+		},
+		"not http": {
+			Body:     `{"url":"ftp://example.com/hooks","secret":"0123456789abcdef","event_types":["CompanyCreated"]}`,
+			WantCode: 400,
+		},
+		"short secret": {
+			Body:     `{"url":"https://example.com/hooks","secret":"secret","event_types":["CompanyCreated"]}`,
+			WantCode: 400,
+		},
+		"unknown event type": {
+			Body:     `{"url":"https://example.com/hooks","secret":"0123456789abcdef","event_types":["CompanyRenamed"]}`,
+			WantCode: 400,
+		},
+		"no event types": {
+			Body:     `{"url":"https://example.com/hooks","secret":"0123456789abcdef","event_types":[]}`,
+			WantCode: 400,
+		},
+		"invalid json": {
+			Body:     `{"url":`,
+			WantCode: 400,
+		},
+		"loopback": {
+			Body:     `{"url":"http://127.0.0.1:8080/hooks","secret":"0123456789abcdef","event_types":["CompanyCreated"]}`,
+			WantCode: 400,
+		},
+		"cloud metadata": {
+			Body:     `{"url":"http://169.254.169.254/latest/meta-data","secret":"0123456789abcdef","event_types":["CompanyCreated"]}`,
+			WantCode: 400,
+		},
+		"private network": {
+			Body:     `{"url":"https://10.0.0.5/hooks","secret":"0123456789abcdef","event_types":["CompanyCreated"]}`,
+			WantCode: 400,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			webhookRepository := NewMockwebhookRepository(ctrl)
+			if tc.mocks != nil {
+				tc.mocks(webhookRepository)
+			}
+
+			ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "user-1", Scopes: []string{auth.ScopeWebhooks}})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/webhooks", bytes.NewBufferString(tc.Body)).WithContext(ctx)
+
+			handler := handlers.NewWebhookHandler(webhookRepository, webhooks.AddressPolicy{}, logger)
+			http.HandlerFunc(handler.CreateWebhook).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.WantCode, w.Code)
+			assert.NotContains(t, w.Body.String(), "0123456789abcdef")
+		})
+	}
+}
+
+func TestListWebhooks(t *testing.T) {
+	cases := map[string]struct {
+		Principal auth.Principal
+		WantOwner string
+	}{
+		"own webhooks": {
+			Principal: auth.Principal{Subject: "user-1", Scopes: []string{auth.ScopeWebhooks}},
+			WantOwner: "user-1",
+		},
+		"admin sees all": {
+			Principal: auth.Principal{Subject: "admin", Roles: []string{auth.RoleAdmin}},
+			WantOwner: "",
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			webhookRepository := NewMockwebhookRepository(ctrl)
+			webhookRepository.EXPECT().ListWebhooks(gomock.Any(), tc.WantOwner).Return([]entities.Webhook{}, nil)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/webhooks", nil).
+				WithContext(auth.WithPrincipal(context.Background(), tc.Principal))
+
+			handler := handlers.NewWebhookHandler(webhookRepository, webhooks.AddressPolicy{}, logger)
+			http.HandlerFunc(handler.ListWebhooks).ServeHTTP(w, r)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `{"webhooks":[]}`, w.Body.String())
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	cases := map[string]struct {
+		mocks     func(*MockwebhookRepository)
+		Handler   string
+		WebhookID string
+		Body      string
+		WantCode  int
+	}{
+		"get": {
+			mocks: func(mr *MockwebhookRepository) {
+				mr.EXPECT().GetWebhook(gomock.Any(), int64(1), "user-1").Return(entities.Webhook{Id: 1, Owner: "user-1"}, nil)
+			},
+			Handler:   "get",
+			WebhookID: "1",
+			WantCode:  200,
+		},
+		"get of another owner": {
+			mocks: func(mr *MockwebhookRepository) {
+				mr.EXPECT().GetWebhook(gomock.Any(), int64(2), "user-1").Return(entities.Webhook{}, repositories.ErrWebhookNotFound)
+			},
+			Handler:   "get",
+			WebhookID: "2",
+			WantCode:  404,
+		},
+		"get invalid id": {
+			Handler:   "get",
+			WebhookID: "abc",
+			WantCode:  400,
+		},
+		"enable": {
+			mocks: func(mr *MockwebhookRepository) {
+				mr.EXPECT().SetWebhookEnabled(gomock.Any(), int64(1), "user-1", true).Return(entities.Webhook{Id: 1, Owner: "user-1", Enabled: true}, nil)
+			},
+			Handler:   "update",
+			WebhookID: "1",
+			Body:      `{"enabled":true}`,
+			WantCode:  200,
+		},
+		"enable of another owner": {
+			mocks: func(mr *MockwebhookRepository) {
+				mr.EXPECT().SetWebhookEnabled(gomock.Any(), int64(2), "user-1", true).Return(entities.Webhook{}, repositories.ErrWebhookNotFound)
+			},
+			Handler:   "update",
+			WebhookID: "2",
+			Body:      `{"enabled":true}`,
+			WantCode:  404,
+		},
+		"update without enabled": {
+			Handler:   "update",
+			WebhookID: "1",
+			Body:      `{}`,
+			WantCode:  400,
+		},
+		"delete": {
+			mocks: func(mr *MockwebhookRepository) {
+				mr.EXPECT().DeleteWebhook(gomock.Any(), int64(1), "user-1").Return(nil)
+			},
+			Handler:   "delete",
+			WebhookID: "1",
+			WantCode:  204,
+		},
+		"delete not found": {
+			mocks: func(mr *MockwebhookRepository) {
+				mr.EXPECT().DeleteWebhook(gomock.Any(), int64(3), "user-1").Return(repositories.ErrWebhookNotFound)
+			},
+			Handler:   "delete",
+			WebhookID: "3",
+			WantCode:  404,
+		},
+		"deliveries": {
+			mocks: func(mr *MockwebhookRepository) {
+				mr.EXPECT().GetWebhook(gomock.Any(), int64(1), "user-1").Return(entities.Webhook{Id: 1, Owner: "user-1"}, nil)
+				mr.EXPECT().ListDeliveries(gomock.Any(), int64(1), 50).Return([]entities.WebhookDelivery{{Id: 1, WebhookId: 1}}, nil)
+			},
+			Handler:   "deliveries",
+			WebhookID: "1",
+			WantCode:  200,
+		},
+		"deliveries of another owner": {
+			mocks: func(mr *MockwebhookRepository) {
+				mr.EXPECT().GetWebhook(gomock.Any(), int64(2), "user-1").Return(entities.Webhook{}, repositories.ErrWebhookNotFound)
+			},
+			Handler:   "deliveries",
+			WebhookID: "2",
+			WantCode:  404,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			webhookRepository := NewMockwebhookRepository(ctrl)
+			if tc.mocks != nil {
+				tc.mocks(webhookRepository)
+			}
+
+			ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "user-1", Scopes: []string{auth.ScopeWebhooks}})
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tc.WebhookID)
+			ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/webhooks/{id}", bytes.NewBufferString(tc.Body)).WithContext(ctx)
+
+			handler := handlers.NewWebhookHandler(webhookRepository, webhooks.AddressPolicy{}, logger)
+			routes := map[string]http.HandlerFunc{
+				"get":        handler.GetWebhook,
+				"update":     handler.UpdateWebhook,
+				"delete":     handler.DeleteWebhook,
+				"deliveries": handler.ListDeliveries,
+			}
+			routes[tc.Handler].ServeHTTP(w, r)
+
+			assert.Equal(t, tc.WantCode, w.Code)
+		})
+	}
+}
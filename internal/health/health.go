@@ -0,0 +1,229 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xm/config"
+	"xm/internal/handlers/problem"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+)
+
+// Check probes one dependency. A failing critical check makes the service not
+// ready, other failures only degrade the reported status.
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+type Result struct {
+	Status      string     `json:"status"`
+	Critical    bool       `json:"critical"`
+	LatencyMs   float64    `json:"latency_ms"`
+	CheckedAt   time.Time  `json:"checked_at"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Ready  bool              `json:"ready"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// health serves the liveness, readiness and dependency endpoints. Check
+// results are cached for HEALTH_CACHE_TTL and concurrent probes share one run,
+// so probes cannot overload the dependencies.
+type health struct {
+	checks   []Check
+	cacheTTL time.Duration
+	timeout  time.Duration
+	logger   zerolog.Logger
+	ready    *atomic.Bool
+	group    *singleflight.Group
+	mu       *sync.Mutex
+	results  map[string]Result
+	expires  *time.Time
+}
+
+func New(cfg config.Health, logger zerolog.Logger, checks ...Check) health {
+	return health{
+		checks:   checks,
+		cacheTTL: cfg.CacheTTL,
+		timeout:  cfg.Timeout,
+		logger:   logger,
+		ready:    &atomic.Bool{},
+		group:    &singleflight.Group{},
+		mu:       &sync.Mutex{},
+		results:  map[string]Result{},
+		expires:  &time.Time{},
+	}
+}
+
+// SetReady marks whether the service accepts traffic. It starts not ready and
+// is flipped back when shutdown begins, so new requests go elsewhere while
+// in-flight ones drain.
+func (h health) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+// Live reports that the process is running, it checks no dependencies.
+func (h health) Live(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, map[string]string{"status": StatusUp})
+}
+
+func (h health) Ready(w http.ResponseWriter, r *http.Request) {
+	report := h.Report(r.Context())
+	if !report.Ready {
+		err := problem.Write(w, problem.New(r, http.StatusServiceUnavailable, problem.TypeUnavailable, "service is not ready"))
+		if err != nil {
+			h.logger.Warn().Ctx(r.Context()).Timestamp().Msg(err.Error())
+		}
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// Health returns the status, latency and last error of every dependency.
+func (h health) Health(w http.ResponseWriter, r *http.Request) {
+	report := h.Report(r.Context())
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	h.writeJSON(w, status, report)
+}
+
+func (h health) Report(ctx context.Context) Report {
+	report := Report{
+		Status: StatusUp,
+		Ready:  h.ready.Load(),
+		Checks: h.run(ctx),
+	}
+
+	for _, result := range report.Checks {
+		switch {
+		case result.Status == StatusUp:
+		case result.Critical:
+			report.Status = StatusDown
+			report.Ready = false
+		case report.Status == StatusUp:
+			report.Status = StatusDegraded
+		}
+	}
+
+	if !h.ready.Load() {
+		report.Status = StatusDown
+	}
+
+	return report
+}
+
+func (h health) run(ctx context.Context) map[string]Result {
+	h.mu.Lock()
+	if time.Now().Before(*h.expires) {
+		defer h.mu.Unlock()
+		return h.copyResults()
+	}
+	h.mu.Unlock()
+
+	// The shared run is not tied to the probe that started it, the check
+	// timeout bounds it instead.
+	results := h.group.DoChan("checks", func() (interface{}, error) {
+		var wg sync.WaitGroup
+		for _, check := range h.checks {
+			wg.Add(1)
+			go func(check Check) {
+				defer wg.Done()
+				h.runCheck(check)
+			}(check)
+		}
+		wg.Wait()
+
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		*h.expires = time.Now().Add(h.cacheTTL)
+
+		return h.copyResults(), nil
+	})
+
+	select {
+	case result := <-results:
+		return result.Val.(map[string]Result)
+	case <-ctx.Done():
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.copyResults()
+	}
+}
+
+func (h health) runCheck(check Check) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Run(ctx)
+	latency := time.Since(start)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := h.results[check.Name]
+	result.Status = StatusUp
+	result.Critical = check.Critical
+	result.LatencyMs = float64(latency.Microseconds()) / 1000
+	result.CheckedAt = start
+	if err != nil {
+		result.Status = StatusDown
+		result.LastError = err.Error()
+		result.LastErrorAt = &start
+		h.logger.Error().Timestamp().Str("check", check.Name).Msg(err.Error())
+	}
+
+	h.results[check.Name] = result
+}
+
+// copyResults must be called with mu held.
+func (h health) copyResults() map[string]Result {
+	results := make(map[string]Result, len(h.checks))
+	for _, check := range h.checks {
+		result, ok := h.results[check.Name]
+		if !ok {
+			result = Result{Status: StatusDown, Critical: check.Critical, LastError: "not checked yet"}
+		}
+		results[check.Name] = result
+	}
+
+	return results
+}
+
+func (h health) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	response, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Error().Timestamp().Msg(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(status)
+	_, err = w.Write(response)
+	if err != nil {
+		h.logger.Warn().Timestamp().Msg(err.Error())
+	}
+}
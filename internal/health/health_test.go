@@ -0,0 +1,118 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/health"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func check(name string, critical bool, err error) health.Check {
+	return health.Check{Name: name, Critical: critical, Run: func(ctx context.Context) error { return err }}
+}
+
+func TestHealth(t *testing.T) {
+	cases := map[string]struct {
+		Checks     []health.Check
+		Ready      bool
+		WantReady  int
+		WantStatus string
+	}{
+		"up": {
+			Checks:     []health.Check{check("postgres", true, nil), check("redis", false, nil)},
+			Ready:      true,
+			WantReady:  http.StatusOK,
+			WantStatus: health.StatusUp,
+		},
+		"critical down": {
+			Checks:     []health.Check{check("postgres", true, errors.New("connection refused")), check("redis", false, nil)},
+			Ready:      true,
+			WantReady:  http.StatusServiceUnavailable,
+			WantStatus: health.StatusDown,
+		},
+		"optional down": {
+			Checks:     []health.Check{check("postgres", true, nil), check("redis", false, errors.New("connection refused"))},
+			Ready:      true,
+			WantReady:  http.StatusOK,
+			WantStatus: health.StatusDegraded,
+		},
+		"draining": {
+			Checks:     []health.Check{check("postgres", true, nil)},
+			WantReady:  http.StatusServiceUnavailable,
+			WantStatus: health.StatusDown,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			h := health.New(config.Health{CacheTTL: time.Minute, Timeout: time.Second}, zerolog.Nop(), tc.Checks...)
+			h.SetReady(tc.Ready)
+
+			w := httptest.NewRecorder()
+			h.Ready(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			assert.Equal(t, tc.WantReady, w.Code)
+
+			w = httptest.NewRecorder()
+			h.Health(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+			assert.Equal(t, tc.WantReady, w.Code)
+
+			var report health.Report
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+			assert.Equal(t, tc.WantStatus, report.Status)
+			assert.Len(t, report.Checks, len(tc.Checks))
+
+			w = httptest.NewRecorder()
+			h.Live(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+func TestHealthCache(t *testing.T) {
+	var runs int32
+	var fail atomic.Bool
+
+	h := health.New(config.Health{CacheTTL: 50 * time.Millisecond, Timeout: time.Second}, zerolog.Nop(), health.Check{
+		Name:     "postgres",
+		Critical: true,
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			if fail.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+	})
+	h.SetReady(true)
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, h.Report(context.Background()).Ready)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+
+	fail.Store(true)
+	time.Sleep(60 * time.Millisecond)
+
+	report := h.Report(context.Background())
+	assert.False(t, report.Ready)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&runs))
+	assert.Equal(t, "connection refused", report.Checks["postgres"].LastError)
+
+	fail.Store(false)
+	time.Sleep(60 * time.Millisecond)
+
+	report = h.Report(context.Background())
+	assert.True(t, report.Ready)
+	assert.Equal(t, health.StatusUp, report.Checks["postgres"].Status)
+	assert.Equal(t, "connection refused", report.Checks["postgres"].LastError, "last error is kept after recovery")
+}
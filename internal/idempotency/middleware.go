@@ -0,0 +1,194 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"xm/config"
+	"xm/internal/auth"
+	"xm/internal/handlers/problem"
+	"xm/internal/logging"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+
+	// statusClientClosedRequest is written by the handlers when the client
+	// went away before the response.
+	statusClientClosedRequest = 499
+
+	// storeTimeout bounds Complete and Release, which run after the request
+	// context may already be cancelled.
+	storeTimeout = 5 * time.Second
+)
+
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// Middleware replays the stored response for requests repeating an
+// Idempotency-Key. Keys are scoped to the authenticated subject. A key is
+// reserved for cfg.Lease while its request runs and the response is kept for
+// cfg.TTL; server errors and cancelled requests release the key so the client
+// can retry.
+func Middleware(store Store, cfg config.Idempotency, logger zerolog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestLogger := logging.FromContext(r.Context(), logger)
+
+			key := r.Header.Get(HeaderKey)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxKeyLength {
+				writeProblem(w, requestLogger, problem.New(r, http.StatusBadRequest, problem.TypeValidation, "Idempotency-Key is too long"))
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				writeProblem(w, requestLogger, problem.New(r, http.StatusRequestEntityTooLarge, problem.TypeTooLarge,
+					fmt.Sprintf("request body is larger than %d bytes", maxBytesErr.Limit)))
+				return
+			}
+			if err != nil {
+				writeProblem(w, requestLogger, problem.New(r, http.StatusBadRequest, problem.TypeValidation, "request body can not be read"))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key = storeKey(r, key)
+			fingerprint := requestFingerprint(r, body)
+
+			record, reserved, err := store.Reserve(r.Context(), key, fingerprint, cfg.Lease)
+			if err != nil {
+				requestLogger.Error().Timestamp().Msg(err.Error())
+				writeProblem(w, requestLogger, problem.New(r, http.StatusServiceUnavailable, problem.TypeUnavailable, "idempotency storage is temporarily unavailable"))
+				return
+			}
+
+			if !reserved {
+				switch {
+				case record.Fingerprint != fingerprint:
+					writeProblem(w, requestLogger, problem.New(r, http.StatusUnprocessableEntity, problem.TypeIdempotencyMismatch,
+						"Idempotency-Key was already used with a different request"))
+				case !record.Completed:
+					writeProblem(w, requestLogger, problem.New(r, http.StatusConflict, problem.TypeConflict,
+						"request with this Idempotency-Key is still in progress"))
+				default:
+					replay(w, requestLogger, record)
+				}
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+			defer cancel()
+
+			if recorder.status >= http.StatusInternalServerError || recorder.status == statusClientClosedRequest || r.Context().Err() != nil {
+				err = store.Release(ctx, record)
+				if err != nil {
+					requestLogger.Error().Timestamp().Msg(err.Error())
+				}
+				return
+			}
+
+			record.Completed = true
+			record.StatusCode = recorder.status
+			record.Header = http.Header{}
+			for _, name := range replayedHeaders {
+				if value := w.Header().Get(name); value != "" {
+					record.Header.Set(name, value)
+				}
+			}
+			record.Body = recorder.body.Bytes()
+
+			err = store.Complete(ctx, record, cfg.TTL)
+			if err != nil {
+				requestLogger.Error().Timestamp().Msg(err.Error())
+			}
+		})
+	}
+}
+
+// storeKey scopes the key to the subject, so one client can not replay the
+// response stored for another. Hashing keeps it within maxKeyLength.
+func storeKey(r *http.Request, key string) string {
+	hash := sha256.New()
+	hash.Write([]byte(auth.Subject(r.Context())))
+	hash.Write([]byte{0})
+	hash.Write([]byte(key))
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(r.URL.Path))
+	hash.Write([]byte{0})
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, logger *zerolog.Logger, record Record) {
+	for name, values := range record.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(record.StatusCode)
+
+	_, err := w.Write(record.Body)
+	if err != nil {
+		logger.Warn().Timestamp().Msg(err.Error())
+	}
+}
+
+func writeProblem(w http.ResponseWriter, logger *zerolog.Logger, p problem.Problem) {
+	err := problem.Write(w, p)
+	if err != nil {
+		logger.Warn().Timestamp().Msg(err.Error())
+	}
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,216 @@
+package idempotency_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/auth"
+	"xm/internal/idempotency"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	var logger zerolog.Logger
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	calls := 0
+	status := http.StatusCreated
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		w.Header().Set("ETag", `"1"`)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"Id":1}`))
+	})
+
+	cfg := config.Idempotency{TTL: time.Hour, Lease: time.Minute}
+	handler := idempotency.Middleware(idempotency.NewRedisStore(client), cfg, logger)(next)
+
+	send := func(key string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/company", bytes.NewReader([]byte(body)))
+		r = r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Subject: "client-a"}))
+		if key != "" {
+			r.Header.Set(idempotency.HeaderKey, key)
+		}
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	first := send("key-1", `{"name":"A"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, 1, calls)
+
+	retry := send("key-1", `{"name":"A"}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, `"1"`, retry.Header().Get("ETag"))
+	assert.Equal(t, "true", retry.Header().Get(idempotency.HeaderReplayed))
+	assert.Equal(t, 1, calls)
+
+	mismatch := send("key-1", `{"name":"B"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, mismatch.Code)
+	assert.Equal(t, 1, calls)
+
+	send("", `{"name":"A"}`)
+	assert.Equal(t, 2, calls)
+
+	status = http.StatusServiceUnavailable
+	send("key-2", `{"name":"C"}`)
+	status = http.StatusCreated
+	released := send("key-2", `{"name":"C"}`)
+	assert.Equal(t, http.StatusCreated, released.Code)
+	assert.Equal(t, 4, calls)
+
+	server.FastForward(2 * time.Hour)
+	expired := send("key-1", `{"name":"B"}`)
+	assert.Equal(t, http.StatusCreated, expired.Code)
+	assert.Equal(t, 5, calls)
+}
+
+func TestMiddlewareRelease(t *testing.T) {
+	var logger zerolog.Logger
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			// The client gave up while the request was running.
+			cancel()
+			w.WriteHeader(499)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	cfg := config.Idempotency{TTL: time.Hour, Lease: time.Minute}
+	handler := idempotency.Middleware(idempotency.NewRedisStore(client), cfg, logger)(next)
+
+	send := func(ctx context.Context, subject string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/company", bytes.NewReader([]byte(`{"name":"A"}`)))
+		r = r.WithContext(auth.WithPrincipal(ctx, auth.Principal{Subject: subject}))
+		r.Header.Set(idempotency.HeaderKey, "key-1")
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	send(ctx, "client-a")
+
+	retry := send(context.Background(), "client-a")
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Empty(t, retry.Header().Get(idempotency.HeaderReplayed))
+
+	other := send(context.Background(), "client-b")
+	assert.Equal(t, http.StatusCreated, other.Code)
+	assert.Empty(t, other.Header().Get(idempotency.HeaderReplayed))
+	assert.Equal(t, 3, calls)
+}
+
+func TestMiddlewareLease(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	store := idempotency.NewRedisStore(client)
+
+	_, reserved, err := store.Reserve(context.Background(), "key-1", "fingerprint", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+
+	// The process stopped before completing the request, the key is free
+	// again once the lease ran out.
+	server.FastForward(2 * time.Minute)
+
+	record, reserved, err := store.Reserve(context.Background(), "key-1", "fingerprint", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+
+	record.Completed = true
+	err = store.Complete(context.Background(), record, time.Hour)
+	assert.NoError(t, err)
+
+	server.FastForward(2 * time.Minute)
+
+	record, reserved, err = store.Reserve(context.Background(), "key-1", "fingerprint", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, reserved)
+	assert.True(t, record.Completed)
+}
+
+func TestMiddlewareExpiredLease(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	store := idempotency.NewRedisStore(client)
+	ctx := context.Background()
+
+	// Request a outlives its lease, request b reserves the key again and
+	// completes it.
+	a, reserved, err := store.Reserve(ctx, "key-1", "fingerprint", time.Minute)
+	require.NoError(t, err)
+	require.True(t, reserved)
+
+	server.FastForward(2 * time.Minute)
+
+	b, reserved, err := store.Reserve(ctx, "key-1", "fingerprint", time.Minute)
+	require.NoError(t, err)
+	require.True(t, reserved)
+	b.Completed = true
+	b.StatusCode = http.StatusCreated
+	require.NoError(t, store.Complete(ctx, b, time.Hour))
+
+	// Request a failing afterwards neither frees nor overwrites the response
+	// of b.
+	require.NoError(t, store.Release(ctx, a))
+	a.Completed = true
+	a.StatusCode = http.StatusConflict
+	assert.ErrorIs(t, store.Complete(ctx, a, time.Hour), idempotency.ErrReservationLost)
+
+	record, reserved, err := store.Reserve(ctx, "key-1", "fingerprint", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.True(t, record.Completed)
+	assert.Equal(t, http.StatusCreated, record.StatusCode)
+}
+
+func TestPostgresStoreExpiredLease(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	store := idempotency.NewPostgresStore(sqlx.NewDb(db, "postgres"))
+	record := idempotency.Record{Key: "key-1", Token: "token-a", StatusCode: http.StatusCreated}
+
+	mock.ExpectExec(`UPDATE idempotency_key\s+SET completed = true.+WHERE key = \$1 AND token = \$2`).
+		WithArgs("key-1", "token-a", http.StatusCreated, sqlmock.AnyArg(), sqlmock.AnyArg(), int64(3600000)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM idempotency_key WHERE key = \$1 AND token = \$2 AND NOT completed`).
+		WithArgs("key-1", "token-a").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.ErrorIs(t, store.Complete(context.Background(), record, time.Hour), idempotency.ErrReservationLost)
+	assert.NoError(t, store.Release(context.Background(), record))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,113 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type postgresStore struct {
+	db *sqlx.DB
+}
+
+func NewPostgresStore(db *sqlx.DB) Store {
+	return postgresStore{db: db}
+}
+
+type postgresRecord struct {
+	Key         string `db:"key"`
+	Fingerprint string `db:"fingerprint"`
+	Completed   bool   `db:"completed"`
+	StatusCode  int    `db:"status_code"`
+	Header      []byte `db:"header"`
+	Body        []byte `db:"body"`
+}
+
+func (s postgresStore) Reserve(ctx context.Context, key string, fingerprint string, lease time.Duration) (Record, bool, error) {
+	var inserted bool
+
+	token, err := newToken()
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	err = s.db.GetContext(ctx, &inserted, `INSERT INTO idempotency_key (key, token, fingerprint, expires_at)
+		VALUES ($1, $2, $3, now() + $4 * interval '1 millisecond')
+		ON CONFLICT (key) DO UPDATE
+			SET token = EXCLUDED.token, fingerprint = EXCLUDED.fingerprint, completed = false, status_code = 0, header = NULL, body = NULL,
+				expires_at = EXCLUDED.expires_at
+			WHERE idempotency_key.expires_at < now()
+		RETURNING true`, key, token, fingerprint, lease.Milliseconds())
+	if err == nil {
+		return Record{Key: key, Token: token, Fingerprint: fingerprint}, inserted, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Record{}, false, err
+	}
+
+	var row postgresRecord
+	err = s.db.GetContext(ctx, &row, `SELECT key, fingerprint, completed, status_code, header, body
+		FROM idempotency_key WHERE key = $1`, key)
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	record := Record{
+		Key:         row.Key,
+		Fingerprint: row.Fingerprint,
+		Completed:   row.Completed,
+		StatusCode:  row.StatusCode,
+		Body:        row.Body,
+	}
+	if len(row.Header) > 0 {
+		err = json.Unmarshal(row.Header, &record.Header)
+		if err != nil {
+			return Record{}, false, err
+		}
+	}
+
+	return record, false, nil
+}
+
+func (s postgresStore) Complete(ctx context.Context, record Record, ttl time.Duration) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx, `UPDATE idempotency_key
+		SET completed = true, status_code = $3, header = $4, body = $5, expires_at = now() + $6 * interval '1 millisecond'
+		WHERE key = $1 AND token = $2`, record.Key, record.Token, record.StatusCode, header, record.Body, ttl.Milliseconds())
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrReservationLost
+	}
+
+	return nil
+}
+
+func (s postgresStore) Release(ctx context.Context, record Record) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_key WHERE key = $1 AND token = $2 AND NOT completed`, record.Key, record.Token)
+
+	return err
+}
+
+func (s postgresStore) PurgeExpired(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_key WHERE expires_at < now()`)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
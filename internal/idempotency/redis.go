@@ -0,0 +1,107 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "idempotency:"
+
+// completeScript stores the completed record ARGV[2] for ARGV[3]
+// milliseconds if the key still holds the reservation with token ARGV[1].
+var completeScript = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if value and cjson.decode(value).token == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	return 1
+end
+return 0
+`)
+
+// releaseScript deletes the key if it still holds the pending reservation
+// with token ARGV[1].
+var releaseScript = redis.NewScript(`
+local value = redis.call('GET', KEYS[1])
+if value then
+	local record = cjson.decode(value)
+	if record.token == ARGV[1] and not record.completed then
+		return redis.call('DEL', KEYS[1])
+	end
+end
+return 0
+`)
+
+type redisStore struct {
+	client *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) Store {
+	return redisStore{client: client}
+}
+
+func (s redisStore) Reserve(ctx context.Context, key string, fingerprint string, lease time.Duration) (Record, bool, error) {
+	token, err := newToken()
+	if err != nil {
+		return Record{}, false, err
+	}
+	record := Record{Key: key, Token: token, Fingerprint: fingerprint}
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	reserved, err := s.client.SetNX(ctx, redisKeyPrefix+key, value, lease).Result()
+	if err != nil {
+		return Record{}, false, err
+	}
+	if reserved {
+		return record, true, nil
+	}
+
+	value, err = s.client.Get(ctx, redisKeyPrefix+key).Bytes()
+	if err == redis.Nil {
+		// The key expired between SETNX and GET, try to claim it again.
+		return s.Reserve(ctx, key, fingerprint, lease)
+	}
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	record = Record{}
+	err = json.Unmarshal(value, &record)
+	if err != nil {
+		return Record{}, false, err
+	}
+
+	return record, false, nil
+}
+
+func (s redisStore) Complete(ctx context.Context, record Record, ttl time.Duration) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	stored, err := completeScript.Run(ctx, s.client, []string{redisKeyPrefix + record.Key}, record.Token, value, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if stored == 0 {
+		return ErrReservationLost
+	}
+
+	return nil
+}
+
+func (s redisStore) Release(ctx context.Context, record Record) error {
+	return releaseScript.Run(ctx, s.client, []string{redisKeyPrefix + record.Key}, record.Token).Err()
+}
+
+// PurgeExpired has nothing to do, Redis expires the keys itself.
+func (s redisStore) PurgeExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
@@ -0,0 +1,50 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrReservationLost is returned by Complete when the lease of the
+// reservation ran out and the key was reserved again or expired.
+var ErrReservationLost = errors.New("idempotency key reservation expired before the request finished")
+
+// Record is an idempotency key with the stored response. Token identifies
+// the reservation, so a request whose lease ran out can not complete or
+// release the key another request reserved since.
+type Record struct {
+	Key         string      `json:"key"`
+	Token       string      `json:"token"`
+	Fingerprint string      `json:"fingerprint"`
+	Completed   bool        `json:"completed"`
+	StatusCode  int         `json:"status_code"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+// Store keeps idempotency records. Reserve atomically claims a key for a new
+// request until the lease expires and returns the existing record with
+// reserved set to false when the key is already taken and has not expired.
+// Complete keeps the response for ttl and Release frees the key, both only
+// while the reservation of the record still holds it. PurgeExpired removes
+// expired records from stores that do not expire them themselves.
+type Store interface {
+	Reserve(ctx context.Context, key string, fingerprint string, lease time.Duration) (record Record, reserved bool, err error)
+	Complete(ctx context.Context, record Record, ttl time.Duration) error
+	Release(ctx context.Context, record Record) error
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+func newToken() (string, error) {
+	token := make([]byte, 16)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
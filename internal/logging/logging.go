@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+	"xm/config"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+// New builds the service logger from LOG_LEVEL and LOG_FORMAT. The console
+// format is human readable and meant for local development.
+func New(cfg config.Log, w io.Writer) (zerolog.Logger, error) {
+	level, err := zerolog.ParseLevel(cfg.Level)
+	if err != nil || level == zerolog.NoLevel {
+		return zerolog.Logger{}, fmt.Errorf("unknown LOG_LEVEL %q", cfg.Level)
+	}
+
+	switch cfg.Format {
+	case FormatJSON:
+	case FormatConsole:
+		w = zerolog.ConsoleWriter{Out: w, TimeFormat: time.RFC3339}
+	default:
+		return zerolog.Logger{}, fmt.Errorf("unknown LOG_FORMAT %q", cfg.Format)
+	}
+
+	return zerolog.New(w).Level(level), nil
+}
+
+// FromContext returns the request logger attached by AccessLog, or fallback
+// outside of a request.
+func FromContext(ctx context.Context, fallback zerolog.Logger) *zerolog.Logger {
+	// zerolog.Ctx returns a disabled logger when none is attached.
+	if l := zerolog.Ctx(ctx); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
+
+	return &fallback
+}
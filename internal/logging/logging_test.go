@@ -0,0 +1,81 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"xm/config"
+	"xm/internal/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	cases := map[string]struct {
+		cfg      config.Log
+		wantErr  bool
+		logged   bool
+		contains string
+	}{
+		"json": {
+			cfg:      config.Log{Level: "info", Format: logging.FormatJSON},
+			logged:   true,
+			contains: `"level":"info","message":"hello"`,
+		},
+		"console": {
+			cfg:      config.Log{Level: "info", Format: logging.FormatConsole},
+			logged:   true,
+			contains: "INF\x1b[0m hello",
+		},
+		"below level": {
+			cfg: config.Log{Level: "warn", Format: logging.FormatJSON},
+		},
+		"unknown level": {
+			cfg:     config.Log{Level: "verbose", Format: logging.FormatJSON},
+			wantErr: true,
+		},
+		"empty level": {
+			cfg:     config.Log{Format: logging.FormatJSON},
+			wantErr: true,
+		},
+		"unknown format": {
+			cfg:     config.Log{Level: "info", Format: "xml"},
+			wantErr: true,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var out bytes.Buffer
+			logger, err := logging.New(tc.cfg, &out)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			logger.Info().Msg("hello")
+
+			if !tc.logged {
+				assert.Empty(t, out.String())
+				return
+			}
+			assert.Contains(t, out.String(), tc.contains)
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	var fallbackOut, requestOut bytes.Buffer
+	fallback := zerolog.New(&fallbackOut)
+	request := zerolog.New(&requestOut)
+
+	logging.FromContext(context.Background(), fallback).Info().Msg("outside")
+	logging.FromContext(request.WithContext(context.Background()), fallback).Info().Msg("inside")
+
+	assert.Contains(t, fallbackOut.String(), "outside")
+	assert.NotContains(t, fallbackOut.String(), "inside")
+	assert.Contains(t, requestOut.String(), "inside")
+}
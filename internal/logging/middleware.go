@@ -0,0 +1,143 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+)
+
+const (
+	HeaderRequestID = "X-Request-ID"
+
+	maxRequestIDLength = 128
+)
+
+// RequestID keeps the X-Request-ID sent by the client when it is a short
+// token of letters, digits and -_.: and generates one otherwise, so it can be
+// written to logs safely. The ID is echoed in the response and stored where
+// middleware.GetReqID finds it, problem responses and the history log read it
+// from there.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, id := WithRequestID(r.Context(), r.Header.Get(HeaderRequestID))
+
+		w.Header().Set(HeaderRequestID, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WithRequestID stores the ID where middleware.GetReqID finds it, an ID that
+// is not safe to log is replaced with a generated one.
+func WithRequestID(ctx context.Context, id string) (context.Context, string) {
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+
+	return context.WithValue(ctx, middleware.RequestIDKey, id), id
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// AccessLog attaches a logger carrying the request ID to the request context
+// and writes one line per request when it completes. Server errors are logged
+// at error level, client errors at warn and everything else at info. A
+// request whose handler panicked, like an export aborted after its status
+// was sent, is logged at error level with aborted set and the panic goes on
+// to the server. The authentication middleware adds the subject to the
+// request logger, so it shows up in the access line too.
+func AccessLog(logger zerolog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			ctx := logger.With().
+				Ctx(r.Context()).
+				Str("request_id", middleware.GetReqID(r.Context())).
+				Logger().
+				WithContext(r.Context())
+			requestLogger := zerolog.Ctx(ctx)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			completed := false
+			defer func() {
+				aborted := !completed
+
+				status := ww.Status()
+				switch {
+				case status == 0 && aborted:
+					status = http.StatusInternalServerError
+				case status == 0:
+					status = http.StatusOK
+				}
+
+				route := "unmatched"
+				if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+					route = rctx.RoutePattern()
+				}
+
+				remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+				if err != nil {
+					remoteIP = r.RemoteAddr
+				}
+
+				var event *zerolog.Event
+				switch {
+				case aborted, status >= http.StatusInternalServerError:
+					event = requestLogger.Error()
+				case status >= http.StatusBadRequest:
+					event = requestLogger.Warn()
+				default:
+					event = requestLogger.Info()
+				}
+
+				if aborted {
+					event = event.Bool("aborted", true)
+				}
+
+				event.Timestamp().
+					Str("method", r.Method).
+					Str("route", route).
+					Str("path", r.URL.Path).
+					Int("status", status).
+					Int("bytes", ww.BytesWritten()).
+					Float64("duration_ms", float64(time.Since(start).Microseconds())/1000).
+					Str("remote_ip", remoteIP).
+					Str("user_agent", r.UserAgent()).
+					Msg("request")
+			}()
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+			completed = true
+		})
+	}
+}
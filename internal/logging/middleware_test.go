@@ -0,0 +1,143 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"xm/internal/logging"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestID(t *testing.T) {
+	cases := map[string]struct {
+		header string
+		keep   bool
+	}{
+		"missing":          {},
+		"valid":            {header: "edge-1:4f2a.9_c", keep: true},
+		"unsafe":           {header: "id\nlevel=error"},
+		"spaces":           {header: "two words"},
+		"too long":         {header: strings.Repeat("a", 129)},
+		"longest accepted": {header: strings.Repeat("a", 128), keep: true},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var seen string
+			handler := logging.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = middleware.GetReqID(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/company", nil)
+			if tc.header != "" {
+				r.Header.Set(logging.HeaderRequestID, tc.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			require.NotEmpty(t, seen)
+			assert.Equal(t, seen, w.Header().Get(logging.HeaderRequestID))
+			if tc.keep {
+				assert.Equal(t, tc.header, seen)
+			} else {
+				assert.NotEqual(t, tc.header, seen)
+				assert.Len(t, seen, 32)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	cases := map[string]struct {
+		path      string
+		status    int
+		wantLevel string
+		wantRoute string
+	}{
+		"ok": {
+			path:      "/v1/company/1",
+			status:    http.StatusOK,
+			wantLevel: "info",
+			wantRoute: "/v1/company/{id}",
+		},
+		"client error": {
+			path:      "/v1/company/1",
+			status:    http.StatusNotFound,
+			wantLevel: "warn",
+			wantRoute: "/v1/company/{id}",
+		},
+		"server error": {
+			path:      "/v1/company/1",
+			status:    http.StatusServiceUnavailable,
+			wantLevel: "error",
+			wantRoute: "/v1/company/{id}",
+		},
+		"unmatched": {
+			path:      "/v2/unknown",
+			status:    http.StatusNotFound,
+			wantLevel: "warn",
+			wantRoute: "unmatched",
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := zerolog.New(&out)
+
+			router := chi.NewRouter()
+			router.Use(logging.RequestID)
+			router.Use(logging.AccessLog(logger))
+			router.Get("/v1/company/{id}", func(w http.ResponseWriter, r *http.Request) {
+				// Authentication adds the subject to the request logger.
+				zerolog.Ctx(r.Context()).UpdateContext(func(c zerolog.Context) zerolog.Context {
+					return c.Str("subject", "user-1")
+				})
+				zerolog.Ctx(r.Context()).Info().Msg("handled")
+
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte("body"))
+			})
+
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			r.Header.Set(logging.HeaderRequestID, "req-1")
+			r.RemoteAddr = "10.0.0.1:52000"
+			router.ServeHTTP(httptest.NewRecorder(), r)
+
+			lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+
+			var access map[string]interface{}
+			require.NoError(t, json.Unmarshal(lines[len(lines)-1], &access))
+
+			assert.Equal(t, "request", access["message"])
+			assert.Equal(t, tc.wantLevel, access["level"])
+			assert.Equal(t, "req-1", access["request_id"])
+			assert.Equal(t, http.MethodGet, access["method"])
+			assert.Equal(t, tc.wantRoute, access["route"])
+			assert.Equal(t, tc.path, access["path"])
+			assert.EqualValues(t, tc.status, access["status"])
+			assert.Equal(t, "10.0.0.1", access["remote_ip"])
+			assert.Contains(t, access, "duration_ms")
+
+			if tc.wantRoute == "unmatched" {
+				assert.Len(t, lines, 1)
+				return
+			}
+
+			assert.EqualValues(t, 4, access["bytes"])
+			assert.Equal(t, "user-1", access["subject"])
+
+			var handled map[string]interface{}
+			require.NoError(t, json.Unmarshal(lines[0], &handled))
+			assert.Equal(t, "req-1", handled["request_id"])
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryInterceptor records call counts and latencies of unary methods by full
+// method name and status code, like Middleware does for HTTP routes.
+func UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+
+	resp, err := handler(ctx, req)
+	observeCall(info.FullMethod, err, start)
+
+	return resp, err
+}
+
+// StreamInterceptor records streaming calls once they end.
+func StreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+
+	err := handler(srv, ss)
+	observeCall(info.FullMethod, err, start)
+
+	return err
+}
+
+// observeCall labels a call by its full method, the server only invokes
+// interceptors for registered methods so the label can not add series.
+func observeCall(method string, err error, start time.Time) {
+	code := status.Code(err).String()
+
+	grpcRequests.WithLabelValues(method, code).Inc()
+	grpcDuration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+}
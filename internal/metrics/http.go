@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// standardMethods are the methods used as label values, any other method a
+// client sends is labelled "other" so it can not add series.
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// Middleware records request counts and latencies labelled by the chi route
+// pattern, so /v1/company/1 and /v1/company/2 share one series. Requests that
+// match no route or use a non-standard method are labelled "unmatched".
+// Requests whose handler panicked, like an export aborted after its status
+// was sent, have the status "aborted".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		completed := false
+		defer func() {
+			method, route := r.Method, "unmatched"
+			if !standardMethods[method] {
+				method = "other"
+			} else if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			class := strconv.Itoa(status/100) + "xx"
+			if !completed {
+				class = "aborted"
+			}
+
+			httpRequests.WithLabelValues(method, route, class).Inc()
+			httpDuration.WithLabelValues(method, route, class).Observe(time.Since(start).Seconds())
+		}()
+
+		next.ServeHTTP(ww, r)
+		completed = true
+	})
+}
@@ -0,0 +1,97 @@
+package metrics_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"xm/config"
+	"xm/internal/metrics"
+	"xm/internal/repositories"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func scrape(t *testing.T) string {
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+
+	return string(body)
+}
+
+func TestMiddleware(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(metrics.Middleware)
+	router.Get("/v1/company/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "id") == "404" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	for _, path := range []string{"/v1/company/1", "/v1/company/2", "/v1/company/404", "/v1/unknown"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	for _, method := range []string{"FOO", "BAR"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/v1/company/1", nil))
+	}
+
+	body := scrape(t)
+	assert.Contains(t, body, `xm_http_requests_total{method="GET",route="/v1/company/{id}",status="2xx"} 2`)
+	assert.Contains(t, body, `xm_http_requests_total{method="GET",route="/v1/company/{id}",status="4xx"} 1`)
+	assert.Contains(t, body, `xm_http_requests_total{method="GET",route="unmatched",status="4xx"} 1`)
+	assert.Contains(t, body, `xm_http_request_duration_seconds_count{method="GET",route="/v1/company/{id}",status="2xx"} 2`)
+	assert.Contains(t, body, `xm_http_requests_total{method="other",route="unmatched",status="4xx"} 2`)
+	assert.NotContains(t, body, `method="FOO"`)
+	assert.NotContains(t, body, `/v1/company/1"`)
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/company.v1.CompanyService/Get"}
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) { return req, nil }
+	notFound := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "company not found")
+	}
+
+	for _, handler := range []grpc.UnaryHandler{ok, ok, notFound} {
+		_, _ = metrics.UnaryInterceptor(context.Background(), nil, info, handler)
+	}
+
+	body := scrape(t)
+	assert.Contains(t, body, `xm_grpc_requests_total{code="OK",method="/company.v1.CompanyService/Get"} 2`)
+	assert.Contains(t, body, `xm_grpc_requests_total{code="NotFound",method="/company.v1.CompanyService/Get"} 1`)
+	assert.Contains(t, body, `xm_grpc_request_duration_seconds_count{code="OK",method="/company.v1.CompanyService/Get"} 2`)
+}
+
+func TestCompanyRepository(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, metrics.RegisterDB(db))
+
+	mock.ExpectQuery(`SELECT .+ FROM company WHERE id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	repository := metrics.NewCompanyRepository(repositories.NewCompanyRepository(sqlx.NewDb(db, "postgres"), config.Postgres{}, true))
+
+	_, err = repository.GetCompany(context.Background(), 1)
+	require.ErrorIs(t, err, repositories.ErrCompanyNotFound)
+
+	body := scrape(t)
+	assert.Contains(t, body, `xm_db_query_duration_seconds_count{method="GetCompany"} 1`)
+	assert.Contains(t, body, `xm_db_query_errors_total{error="not_found",method="GetCompany"} 1`)
+	assert.Contains(t, body, `go_sql_open_connections{db_name="postgres"}`)
+}
@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+	"xm/internal/handlers/dto"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+)
+
+type companyRepository interface {
+	GetCompany(ctx context.Context, id int) (entities.Company, error)
+	GetCompanies(ctx context.Context, ids []int) ([]entities.Company, error)
+	CreateCompany(ctx context.Context, company dto.Company) (entities.Company, error)
+	DeleteCompany(ctx context.Context, id int, version int) error
+	UpdateCompany(ctx context.Context, id int, version int, company dto.Company) (entities.Company, error)
+	ListCompanies(ctx context.Context, filter dto.CompanyFilter) ([]entities.Company, string, error)
+	PatchCompany(ctx context.Context, id int, version int, patch dto.CompanyPatch) (entities.Company, error)
+	RestoreCompany(ctx context.Context, id int) (entities.Company, error)
+	PurgeCompany(ctx context.Context, id int) error
+	BatchCompanies(ctx context.Context, operations []dto.BatchOperation, atomic bool) ([]entities.BatchResult, error)
+	ImportCompanies(ctx context.Context, rows []dto.CompanyImport, dryRun bool) ([]entities.BatchResult, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]entities.CompanyEvent, error)
+	AckEvent(ctx context.Context, id int64) error
+	RetryEvent(ctx context.Context, id int64, delay time.Duration, cause string) error
+	ListChangeEvents(ctx context.Context, xactId int64) ([]entities.CompanyEvent, error)
+	ListCompanyHistory(ctx context.Context, id int, limit int, cursor string) ([]entities.CompanyHistory, string, error)
+	GetCompanyHistory(ctx context.Context, id int, version int) (entities.CompanyHistory, error)
+}
+
+// instrumentedRepository records the duration and errors of every repository
+// method.
+type instrumentedRepository struct {
+	repository companyRepository
+}
+
+func NewCompanyRepository(repository companyRepository) instrumentedRepository {
+	return instrumentedRepository{repository: repository}
+}
+
+func observe(method string, start time.Time, err error) {
+	dbDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		dbErrors.WithLabelValues(method, errorKind(err)).Inc()
+	}
+}
+
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, repositories.ErrCompanyNotFound), errors.Is(err, repositories.ErrHistoryNotFound):
+		return "not_found"
+	case errors.Is(err, repositories.ErrDuplicateName), errors.Is(err, repositories.ErrVersionMismatch),
+		errors.Is(err, repositories.ErrCompanyDeleted), errors.Is(err, repositories.ErrCompanyNotDeleted):
+		return "conflict"
+	case errors.Is(err, repositories.ErrInvalidCompanyType), errors.Is(err, repositories.ErrConstraintViolation),
+		errors.Is(err, repositories.ErrInvalidCursor):
+		return "invalid"
+	case errors.Is(err, repositories.ErrUnavailable):
+		return "unavailable"
+	case errors.Is(err, repositories.ErrTimeout):
+		return "timeout"
+	case errors.Is(err, repositories.ErrCanceled):
+		return "canceled"
+	}
+
+	return "internal"
+}
+
+func (r instrumentedRepository) GetCompany(ctx context.Context, id int) (entities.Company, error) {
+	start := time.Now()
+	company, err := r.repository.GetCompany(ctx, id)
+	observe("GetCompany", start, err)
+
+	return company, err
+}
+
+func (r instrumentedRepository) GetCompanies(ctx context.Context, ids []int) ([]entities.Company, error) {
+	start := time.Now()
+	companies, err := r.repository.GetCompanies(ctx, ids)
+	observe("GetCompanies", start, err)
+
+	return companies, err
+}
+
+func (r instrumentedRepository) CreateCompany(ctx context.Context, company dto.Company) (entities.Company, error) {
+	start := time.Now()
+	created, err := r.repository.CreateCompany(ctx, company)
+	observe("CreateCompany", start, err)
+
+	return created, err
+}
+
+func (r instrumentedRepository) DeleteCompany(ctx context.Context, id int, version int) error {
+	start := time.Now()
+	err := r.repository.DeleteCompany(ctx, id, version)
+	observe("DeleteCompany", start, err)
+
+	return err
+}
+
+func (r instrumentedRepository) UpdateCompany(ctx context.Context, id int, version int, company dto.Company) (entities.Company, error) {
+	start := time.Now()
+	updated, err := r.repository.UpdateCompany(ctx, id, version, company)
+	observe("UpdateCompany", start, err)
+
+	return updated, err
+}
+
+func (r instrumentedRepository) ListCompanies(ctx context.Context, filter dto.CompanyFilter) ([]entities.Company, string, error) {
+	start := time.Now()
+	companies, cursor, err := r.repository.ListCompanies(ctx, filter)
+	observe("ListCompanies", start, err)
+
+	return companies, cursor, err
+}
+
+func (r instrumentedRepository) PatchCompany(ctx context.Context, id int, version int, patch dto.CompanyPatch) (entities.Company, error) {
+	start := time.Now()
+	patched, err := r.repository.PatchCompany(ctx, id, version, patch)
+	observe("PatchCompany", start, err)
+
+	return patched, err
+}
+
+func (r instrumentedRepository) RestoreCompany(ctx context.Context, id int) (entities.Company, error) {
+	start := time.Now()
+	restored, err := r.repository.RestoreCompany(ctx, id)
+	observe("RestoreCompany", start, err)
+
+	return restored, err
+}
+
+func (r instrumentedRepository) PurgeCompany(ctx context.Context, id int) error {
+	start := time.Now()
+	err := r.repository.PurgeCompany(ctx, id)
+	observe("PurgeCompany", start, err)
+
+	return err
+}
+
+func (r instrumentedRepository) BatchCompanies(ctx context.Context, operations []dto.BatchOperation, atomic bool) ([]entities.BatchResult, error) {
+	start := time.Now()
+	results, err := r.repository.BatchCompanies(ctx, operations, atomic)
+	observe("BatchCompanies", start, err)
+
+	return results, err
+}
+
+func (r instrumentedRepository) ImportCompanies(ctx context.Context, rows []dto.CompanyImport, dryRun bool) ([]entities.BatchResult, error) {
+	start := time.Now()
+	results, err := r.repository.ImportCompanies(ctx, rows, dryRun)
+	observe("ImportCompanies", start, err)
+
+	return results, err
+}
+
+func (r instrumentedRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	start := time.Now()
+	purged, err := r.repository.PurgeDeleted(ctx, before)
+	observe("PurgeDeleted", start, err)
+
+	return purged, err
+}
+
+func (r instrumentedRepository) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]entities.CompanyEvent, error) {
+	start := time.Now()
+	events, err := r.repository.ClaimEvents(ctx, limit, lease)
+	observe("ClaimEvents", start, err)
+
+	return events, err
+}
+
+func (r instrumentedRepository) AckEvent(ctx context.Context, id int64) error {
+	start := time.Now()
+	err := r.repository.AckEvent(ctx, id)
+	observe("AckEvent", start, err)
+
+	return err
+}
+
+func (r instrumentedRepository) RetryEvent(ctx context.Context, id int64, delay time.Duration, cause string) error {
+	start := time.Now()
+	err := r.repository.RetryEvent(ctx, id, delay, cause)
+	observe("RetryEvent", start, err)
+
+	return err
+}
+
+func (r instrumentedRepository) ListChangeEvents(ctx context.Context, xactId int64) ([]entities.CompanyEvent, error) {
+	start := time.Now()
+	events, err := r.repository.ListChangeEvents(ctx, xactId)
+	observe("ListChangeEvents", start, err)
+
+	return events, err
+}
+
+func (r instrumentedRepository) ListCompanyHistory(ctx context.Context, id int, limit int, cursor string) ([]entities.CompanyHistory, string, error) {
+	start := time.Now()
+	history, next, err := r.repository.ListCompanyHistory(ctx, id, limit, cursor)
+	observe("ListCompanyHistory", start, err)
+
+	return history, next, err
+}
+
+func (r instrumentedRepository) GetCompanyHistory(ctx context.Context, id int, version int) (entities.CompanyHistory, error) {
+	start := time.Now()
+	change, err := r.repository.GetCompanyHistory(ctx, id, version)
+	observe("GetCompanyHistory", start, err)
+
+	return change, err
+}
@@ -0,0 +1,507 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"xm/internal/handlers/dto"
+	"xm/internal/repositories/entities"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// BatchError reports the operation that rolled back an atomic batch.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// BatchCompanies applies the operations in one transaction. Operations are
+// grouped by kind and each group runs as one set based statement, creates
+// first, then updates and deletes; the history of every applied operation is
+// written with one more statement. In atomic mode the first failing operation
+// rolls the batch back and is returned as a *BatchError, otherwise failing
+// operations are skipped and reported in their result.
+func (r companyRepository) BatchCompanies(ctx context.Context, operations []dto.BatchOperation, atomic bool) ([]entities.BatchResult, error) {
+	ctx, cancel := withTimeout(ctx, r.batchTimeout)
+	defer cancel()
+
+	b := batch{
+		ctx:        ctx,
+		operations: operations,
+		atomic:     atomic,
+		publish:    r.publish,
+		results:    make([]entities.BatchResult, len(operations)),
+		before:     map[int]entities.Company{},
+	}
+
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		b.tx = tx
+		return b.run()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b.results, nil
+}
+
+// errDryRun rolls back the transaction of a dry run import.
+var errDryRun = errors.New("dry run")
+
+// ImportCompanies creates or replaces companies like an atomic batch. A row
+// with an id replaces that company, a row without one replaces the live
+// company with the same name or creates it. A dry run applies the rows and
+// rolls them back, so it reports what would happen including the conflicts
+// only the database detects.
+func (r companyRepository) ImportCompanies(ctx context.Context, rows []dto.CompanyImport, dryRun bool) ([]entities.BatchResult, error) {
+	ctx, cancel := withTimeout(ctx, r.batchTimeout)
+	defer cancel()
+
+	b := batch{
+		ctx:     ctx,
+		atomic:  true,
+		publish: r.publish,
+		results: make([]entities.BatchResult, len(rows)),
+		before:  map[int]entities.Company{},
+	}
+
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		b.tx = tx
+
+		err := b.resolve(rows)
+		if err != nil {
+			return err
+		}
+
+		err = b.run()
+		if err == nil && dryRun {
+			return errDryRun
+		}
+		return err
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+
+	return b.results, nil
+}
+
+// resolve turns import rows into batch operations, looking up the companies
+// rows without an id refer to by name.
+func (b *batch) resolve(rows []dto.CompanyImport) error {
+	var names pq.StringArray
+	for _, row := range rows {
+		if row.Id == 0 {
+			names = append(names, row.Company.Name)
+		}
+	}
+
+	type namedCompany struct {
+		Id   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	existing := []namedCompany{}
+	if len(names) > 0 {
+		err := traced(b.ctx, "SELECT company", func(ctx context.Context) error {
+			return b.tx.SelectContext(ctx, &existing, `SELECT id, name FROM company
+				WHERE name = ANY($1) AND deleted_at IS NULL`, names)
+		})
+		if err != nil {
+			return mapError(b.ctx, err)
+		}
+	}
+
+	ids := make(map[string]int, len(existing))
+	for _, company := range existing {
+		ids[company.Name] = company.Id
+	}
+
+	b.operations = make([]dto.BatchOperation, 0, len(rows))
+	for _, row := range rows {
+		company := row.Company
+		op := dto.BatchOperation{Op: dto.BatchUpdate, Id: row.Id, Company: &company}
+		if op.Id == 0 {
+			op.Id = ids[company.Name]
+		}
+		if op.Id == 0 {
+			op.Op = dto.BatchCreate
+		}
+		b.operations = append(b.operations, op)
+	}
+
+	return nil
+}
+
+type batch struct {
+	ctx        context.Context
+	tx         *sqlx.Tx
+	operations []dto.BatchOperation
+	atomic     bool
+	publish    bool
+	results    []entities.BatchResult
+	// before holds the locked rows of the updated and deleted companies.
+	before map[int]entities.Company
+}
+
+func (b *batch) run() error {
+	var creates, updates, deletes []int
+	for i, op := range b.operations {
+		b.results[i].Op = op.Op
+		switch op.Op {
+		case dto.BatchCreate:
+			creates = append(creates, i)
+		case dto.BatchUpdate:
+			updates = append(updates, i)
+		case dto.BatchDelete:
+			deletes = append(deletes, i)
+		default:
+			return fmt.Errorf("unknown batch operation %q", op.Op)
+		}
+	}
+
+	err := b.lock(append(append([]int(nil), updates...), deletes...))
+	if err != nil {
+		return err
+	}
+
+	for _, step := range []struct {
+		indexes   []int
+		statement func(indexes []int) error
+	}{
+		{creates, b.insert},
+		{updates, b.update},
+		{deletes, b.delete},
+	} {
+		err = b.apply(b.pending(step.indexes), step.statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.writeHistory()
+}
+
+// lock reads and locks the companies of the given operations in id order, so
+// concurrent batches do not deadlock, and checks each operation against the
+// company state and expected version.
+func (b *batch) lock(indexes []int) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	ids := make(pq.Int64Array, 0, len(indexes))
+	for _, i := range indexes {
+		ids = append(ids, int64(b.operations[i].Id))
+	}
+
+	companies := []entities.Company{}
+	err := traced(b.ctx, "SELECT company FOR UPDATE", func(ctx context.Context) error {
+		return b.tx.SelectContext(ctx, &companies, `SELECT `+companyColumns+` FROM company
+			WHERE id = ANY($1) ORDER BY id FOR UPDATE`, ids)
+	})
+	if err != nil {
+		return mapError(b.ctx, err)
+	}
+
+	for _, company := range companies {
+		b.before[company.Id] = company
+	}
+
+	for _, i := range indexes {
+		op := b.operations[i]
+		before, ok := b.before[op.Id]
+
+		var err error
+		switch {
+		case !ok:
+			err = ErrCompanyNotFound
+		case before.DeletedAt != nil:
+			err = ErrCompanyDeleted
+		case op.Version != 0 && before.Version != op.Version:
+			err = ErrVersionMismatch
+		}
+		if err != nil {
+			err = b.fail(i, err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// apply runs statement for all operations at once. When it fails on the data
+// of some operation it is retried one operation at a time, each within a
+// savepoint, to find out which.
+func (b *batch) apply(indexes []int, statement func(indexes []int) error) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	err := b.savepoint(func() error { return statement(indexes) })
+	if err == nil || !isDataError(err) {
+		return err
+	}
+
+	for _, i := range indexes {
+		err := b.savepoint(func() error { return statement([]int{i}) })
+		if err == nil {
+			continue
+		}
+		if !isDataError(err) {
+			return err
+		}
+
+		err = b.fail(i, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *batch) savepoint(fn func() error) error {
+	err := b.exec("SAVEPOINT", `SAVEPOINT batch`)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+	if err != nil {
+		rollbackErr := b.exec("ROLLBACK TO SAVEPOINT", `ROLLBACK TO SAVEPOINT batch`)
+		if rollbackErr != nil {
+			return rollbackErr
+		}
+		return err
+	}
+
+	return b.exec("RELEASE SAVEPOINT", `RELEASE SAVEPOINT batch`)
+}
+
+func (b *batch) exec(statement string, query string) error {
+	return mapError(b.ctx, traced(b.ctx, statement, func(ctx context.Context) error {
+		_, err := b.tx.ExecContext(ctx, query)
+		return err
+	}))
+}
+
+// isDataError reports whether err was caused by the data of an operation
+// rather than by the database or the request going away.
+func isDataError(err error) bool {
+	return errors.Is(err, ErrDuplicateName) || errors.Is(err, ErrInvalidCompanyType) || errors.Is(err, ErrConstraintViolation)
+}
+
+// fail records err as the result of operation i. An atomic batch stops at the
+// first failure.
+func (b *batch) fail(i int, err error) error {
+	if b.atomic {
+		return &BatchError{Index: i, Err: err}
+	}
+
+	b.results[i].Err = err
+	return nil
+}
+
+func (b *batch) pending(indexes []int) []int {
+	var pending []int
+	for _, i := range indexes {
+		if b.results[i].Err == nil {
+			pending = append(pending, i)
+		}
+	}
+
+	return pending
+}
+
+func (b *batch) insert(indexes []int) error {
+	var names, descriptions, types pq.StringArray
+	var employees pq.Int64Array
+	var registered pq.BoolArray
+	for _, i := range indexes {
+		c := b.operations[i].Company
+		names = append(names, c.Name)
+		descriptions = append(descriptions, c.Description)
+		employees = append(employees, int64(c.EmployeesAmount))
+		registered = append(registered, c.Registered)
+		types = append(types, c.Type)
+	}
+
+	companies := []entities.Company{}
+	err := traced(b.ctx, "INSERT company", func(ctx context.Context) error {
+		return b.tx.SelectContext(ctx, &companies, `INSERT INTO company (name, description, employees_amount, registered, type)
+			SELECT * FROM unnest($1::text[], $2::text[], $3::int[], $4::bool[], $5::company_type[])
+			RETURNING `+companyColumns, names, descriptions, employees, registered, types)
+	})
+	if err != nil {
+		return mapError(b.ctx, err)
+	}
+
+	// Names of live companies are unique, so they tell which row belongs to
+	// which operation.
+	byName := make(map[string]entities.Company, len(companies))
+	for _, company := range companies {
+		byName[company.Name] = company
+	}
+	for _, i := range indexes {
+		b.results[i].Company = byName[b.operations[i].Company.Name]
+	}
+
+	return nil
+}
+
+func (b *batch) update(indexes []int) error {
+	var ids, employees pq.Int64Array
+	var names, descriptions, types pq.StringArray
+	var registered pq.BoolArray
+	for _, i := range indexes {
+		op := b.operations[i]
+		ids = append(ids, int64(op.Id))
+		names = append(names, op.Company.Name)
+		descriptions = append(descriptions, op.Company.Description)
+		employees = append(employees, int64(op.Company.EmployeesAmount))
+		registered = append(registered, op.Company.Registered)
+		types = append(types, op.Company.Type)
+	}
+
+	companies := []entities.Company{}
+	err := traced(b.ctx, "UPDATE company", func(ctx context.Context) error {
+		return b.tx.SelectContext(ctx, &companies, `UPDATE company AS c
+			SET name = u.name, description = u.description, employees_amount = u.employees_amount,
+				registered = u.registered, type = u.type, version = c.version + 1
+			FROM unnest($1::int[], $2::text[], $3::text[], $4::int[], $5::bool[], $6::company_type[])
+				AS u (id, name, description, employees_amount, registered, type)
+			WHERE c.id = u.id
+			RETURNING `+qualifiedCompanyColumns("c"), ids, names, descriptions, employees, registered, types)
+	})
+	if err != nil {
+		return mapError(b.ctx, err)
+	}
+
+	b.setResults(indexes, companies)
+	return nil
+}
+
+func (b *batch) delete(indexes []int) error {
+	ids := make(pq.Int64Array, 0, len(indexes))
+	for _, i := range indexes {
+		ids = append(ids, int64(b.operations[i].Id))
+	}
+
+	companies := []entities.Company{}
+	err := traced(b.ctx, "UPDATE company", func(ctx context.Context) error {
+		return b.tx.SelectContext(ctx, &companies, `UPDATE company SET deleted_at = now(), version = version + 1
+			WHERE id = ANY($1) RETURNING `+companyColumns, ids)
+	})
+	if err != nil {
+		return mapError(b.ctx, err)
+	}
+
+	b.setResults(indexes, companies)
+	return nil
+}
+
+func (b *batch) setResults(indexes []int, companies []entities.Company) {
+	byId := make(map[int]entities.Company, len(companies))
+	for _, company := range companies {
+		byId[company.Id] = company
+	}
+	for _, i := range indexes {
+		b.results[i].Company = byId[b.operations[i].Id]
+	}
+}
+
+func (b *batch) writeHistory() error {
+	var companyIds, versions pq.Int64Array
+	var actions, befores, afters, changed pq.StringArray
+	var actor, requestId string
+	var rows []historyRow
+	previous := map[int]*entities.Company{}
+
+	for i, op := range b.operations {
+		if b.results[i].Err != nil {
+			continue
+		}
+
+		var before *entities.Company
+		if company, ok := b.before[op.Id]; ok && op.Op != dto.BatchCreate {
+			before = &company
+		}
+		after := b.results[i].Company
+
+		row, err := newHistoryRow(b.ctx, op.Op, before, &after)
+		if err != nil {
+			return err
+		}
+
+		actor, requestId = row.Actor, row.RequestId
+		companyIds = append(companyIds, int64(row.CompanyId))
+		versions = append(versions, int64(row.Version))
+		actions = append(actions, row.Action)
+		befores = append(befores, string(row.Before))
+		afters = append(afters, string(row.After))
+		changed = append(changed, strings.Join(row.ChangedFields, ","))
+
+		rows = append(rows, row)
+		previous[row.CompanyId] = before
+	}
+
+	if len(companyIds) == 0 {
+		return nil
+	}
+
+	// The events take the IDs of their history records, a batch changes a
+	// company at most once.
+	inserted := []historyRow{}
+	err := traced(b.ctx, "INSERT company_history", func(ctx context.Context) error {
+		return b.tx.SelectContext(ctx, &inserted, `INSERT INTO company_history
+			(company_id, version, action, actor, request_id, before, after, changed_fields)
+			SELECT u.company_id, u.version, u.action, $7, $8, NULLIF(u.before, '')::jsonb, u.after::jsonb,
+				string_to_array(u.changed_fields, ',')
+			FROM unnest($1::int[], $2::int[], $3::text[], $4::text[], $5::text[], $6::text[])
+				AS u (company_id, version, action, before, after, changed_fields)
+			RETURNING id, company_id`,
+			companyIds, versions, actions, befores, afters, changed, actor, requestId)
+	})
+	if err != nil {
+		return mapError(b.ctx, err)
+	}
+
+	ids := make(map[int]int64, len(inserted))
+	for _, row := range inserted {
+		ids[row.CompanyId] = row.Id
+	}
+
+	var events []outboxRow
+	for _, row := range rows {
+		row.Id = ids[row.CompanyId]
+		if event, ok := newOutboxRow(row, previous[row.CompanyId]); ok {
+			events = append(events, event)
+		}
+	}
+
+	return writeOutbox(b.ctx, b.tx, events, b.publish)
+}
+
+// qualifiedCompanyColumns prefixes companyColumns with a table alias for
+// statements that join another relation with the same column names.
+func qualifiedCompanyColumns(alias string) string {
+	columns := strings.Split(companyColumns, ", ")
+	for i, column := range columns {
+		columns[i] = alias + "." + column
+	}
+
+	return strings.Join(columns, ", ")
+}
@@ -0,0 +1,179 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"xm/config"
+	"xm/internal/handlers/dto"
+	"xm/internal/repositories"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var duplicateName = &pq.Error{Code: "23505", Constraint: "company_name"}
+
+func newBatchRepository(t *testing.T) (sqlmock.Sqlmock, func(operations []dto.BatchOperation, atomic bool) ([]error, []int, error)) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	repository := repositories.NewCompanyRepository(sqlx.NewDb(db, "postgres"), config.Postgres{}, true)
+
+	batch := func(operations []dto.BatchOperation, atomic bool) ([]error, []int, error) {
+		results, err := repository.BatchCompanies(context.Background(), operations, atomic)
+
+		var errs []error
+		var ids []int
+		for _, result := range results {
+			errs = append(errs, result.Err)
+			ids = append(ids, result.Company.Id)
+		}
+		return errs, ids, err
+	}
+
+	return mock, batch
+}
+
+func TestBatchCompaniesBestEffort(t *testing.T) {
+	mock, batch := newBatchRepository(t)
+
+	acme := &dto.Company{Name: "Acme", EmployeesAmount: 10, Registered: true, Type: "corporations"}
+	beta := &dto.Company{Name: "Beta", EmployeesAmount: 5, Registered: true, Type: "cooperative"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT .+ FROM company\s+WHERE id = ANY\(\$1\) ORDER BY id FOR UPDATE`).
+		WithArgs(pq.Int64Array{2, 3, 4}).
+		WillReturnRows(sqlmock.NewRows(companyColumns).
+			AddRow(2, "Old", "", 1, true, "corporations", 1, nil).
+			AddRow(4, "Gone", "", 1, true, "corporations", 6, nil))
+
+	// Both creates in one statement fail on a duplicate name, they are
+	// retried one at a time to find the culprit.
+	mock.ExpectExec(`SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO company .+ FROM unnest`).
+		WithArgs(pq.StringArray{"Acme", "Beta"}, pq.StringArray{"", ""}, pq.Int64Array{10, 5}, pq.BoolArray{true, true}, pq.StringArray{"corporations", "cooperative"}).
+		WillReturnError(duplicateName)
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectExec(`SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO company .+ FROM unnest`).
+		WithArgs(pq.StringArray{"Acme"}, pq.StringArray{""}, pq.Int64Array{10}, pq.BoolArray{true}, pq.StringArray{"corporations"}).
+		WillReturnRows(sqlmock.NewRows(companyColumns).AddRow(10, "Acme", "", 10, true, "corporations", 1, nil))
+	mock.ExpectExec(`RELEASE SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectExec(`SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO company .+ FROM unnest`).
+		WithArgs(pq.StringArray{"Beta"}, pq.StringArray{""}, pq.Int64Array{5}, pq.BoolArray{true}, pq.StringArray{"cooperative"}).
+		WillReturnError(duplicateName)
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectExec(`SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`UPDATE company AS c .+ FROM unnest`).
+		WithArgs(pq.Int64Array{2}, pq.StringArray{"Acme"}, pq.StringArray{""}, pq.Int64Array{10}, pq.BoolArray{true}, pq.StringArray{"corporations"}).
+		WillReturnRows(sqlmock.NewRows(companyColumns).AddRow(2, "Acme", "", 10, true, "corporations", 2, nil))
+	mock.ExpectExec(`RELEASE SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectQuery(`INSERT INTO company_history .+ FROM unnest`).
+		WithArgs(pq.Int64Array{10, 2}, pq.Int64Array{1, 2}, pq.StringArray{"create", "update"},
+			sqlmock.AnyArg(), sqlmock.AnyArg(), pq.StringArray{"name,description,employees_amount,registered,type,deleted_at", "name,employees_amount"},
+			"", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "company_id"}).AddRow(41, 2).AddRow(40, 10))
+	mock.ExpectExec(`INSERT INTO company_outbox .+ FROM unnest`).
+		WithArgs(pq.Int64Array{40, 41}, pq.Int64Array{10, 2}, pq.Int64Array{1, 2}, pq.StringArray{"CompanyCreated", "CompanyUpdated"},
+			sqlmock.AnyArg(), 1, "", "").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	errs, ids, err := batch([]dto.BatchOperation{
+		{Op: dto.BatchCreate, Company: acme},
+		{Op: dto.BatchCreate, Company: beta},
+		{Op: dto.BatchUpdate, Id: 2, Company: acme},
+		{Op: dto.BatchUpdate, Id: 3, Company: beta},
+		{Op: dto.BatchDelete, Id: 4, Version: 5},
+	}, false)
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{10, 0, 2, 0, 0}, ids)
+	assert.NoError(t, errs[0])
+	assert.True(t, errors.Is(errs[1], repositories.ErrDuplicateName), "got %v", errs[1])
+	assert.NoError(t, errs[2])
+	assert.True(t, errors.Is(errs[3], repositories.ErrCompanyNotFound), "got %v", errs[3])
+	assert.True(t, errors.Is(errs[4], repositories.ErrVersionMismatch), "got %v", errs[4])
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBatchCompaniesAtomic(t *testing.T) {
+	cases := map[string]struct {
+		mocks     func(mock sqlmock.Sqlmock)
+		WantIndex int
+		WantErr   error
+	}{
+		"version mismatch": {
+			mocks: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT .+ FOR UPDATE`).
+					WithArgs(pq.Int64Array{2}).
+					WillReturnRows(sqlmock.NewRows(companyColumns).AddRow(2, "Old", "", 1, true, "corporations", 4, nil))
+			},
+			WantIndex: 1,
+			WantErr:   repositories.ErrVersionMismatch,
+		},
+		"duplicate name": {
+			mocks: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT .+ FOR UPDATE`).
+					WithArgs(pq.Int64Array{2}).
+					WillReturnRows(sqlmock.NewRows(companyColumns).AddRow(2, "Old", "", 1, true, "corporations", 3, nil))
+				mock.ExpectExec(`SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`INSERT INTO company`).WillReturnError(duplicateName)
+				mock.ExpectExec(`ROLLBACK TO SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(`SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(`INSERT INTO company`).WillReturnError(duplicateName)
+				mock.ExpectExec(`ROLLBACK TO SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			WantIndex: 0,
+			WantErr:   repositories.ErrDuplicateName,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			mock, batch := newBatchRepository(t)
+
+			mock.ExpectBegin()
+			tc.mocks(mock)
+			mock.ExpectRollback()
+
+			_, _, err := batch([]dto.BatchOperation{
+				{Op: dto.BatchCreate, Company: &dto.Company{Name: "Acme", Type: "corporations"}},
+				{Op: dto.BatchDelete, Id: 2, Version: 3},
+			}, true)
+
+			var batchErr *repositories.BatchError
+			require.True(t, errors.As(err, &batchErr), "got %v", err)
+			assert.Equal(t, tc.WantIndex, batchErr.Index)
+			assert.True(t, errors.Is(err, tc.WantErr), "got %v", err)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestBatchCompaniesUnavailable(t *testing.T) {
+	mock, batch := newBatchRepository(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`INSERT INTO company`).WillReturnError(&pq.Error{Code: "57P01"})
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	_, _, err := batch([]dto.BatchOperation{
+		{Op: dto.BatchCreate, Company: &dto.Company{Name: "Acme", Type: "corporations"}},
+	}, false)
+
+	assert.True(t, errors.Is(err, repositories.ErrUnavailable), "got %v", err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
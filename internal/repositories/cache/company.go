@@ -0,0 +1,324 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"xm/config"
+	"xm/internal/handlers/dto"
+	"xm/internal/metrics"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	keyPrefix       = "company:"
+	notFoundMarker  = "null"
+	tombstoneMarker = "invalidated"
+
+	defaultTTL = time.Minute
+	// defaultReadBound bounds the shared read when SQL_READ_TIMEOUT is 0.
+	defaultReadBound = 30 * time.Second
+	// tombstoneMargin keeps a tombstone past the end of the longest shared
+	// read, for the SETNX of a read that finished just in time.
+	tombstoneMargin = 5 * time.Second
+)
+
+type companyRepository interface {
+	GetCompany(ctx context.Context, id int) (entities.Company, error)
+	GetCompanies(ctx context.Context, ids []int) ([]entities.Company, error)
+	CreateCompany(ctx context.Context, company dto.Company) (entities.Company, error)
+	DeleteCompany(ctx context.Context, id int, version int) error
+	UpdateCompany(ctx context.Context, id int, version int, company dto.Company) (entities.Company, error)
+	ListCompanies(ctx context.Context, filter dto.CompanyFilter) ([]entities.Company, string, error)
+	PatchCompany(ctx context.Context, id int, version int, patch dto.CompanyPatch) (entities.Company, error)
+	RestoreCompany(ctx context.Context, id int) (entities.Company, error)
+	PurgeCompany(ctx context.Context, id int) error
+	BatchCompanies(ctx context.Context, operations []dto.BatchOperation, atomic bool) ([]entities.BatchResult, error)
+	ImportCompanies(ctx context.Context, rows []dto.CompanyImport, dryRun bool) ([]entities.BatchResult, error)
+	ListCompanyHistory(ctx context.Context, id int, limit int, cursor string) ([]entities.CompanyHistory, string, error)
+	GetCompanyHistory(ctx context.Context, id int, version int) (entities.CompanyHistory, error)
+}
+
+// companyCache is a read-through cache in front of companyRepository. Only
+// single company reads are cached, every write replaces the company key with
+// a short lived tombstone that keeps older reads from filling it again.
+// Without a Redis client or with USE_CACHE off it passes calls through.
+type companyCache struct {
+	companyRepository
+	enabled     bool
+	client      *redis.Client
+	logger      zerolog.Logger
+	ttl         time.Duration
+	negativeTTL time.Duration
+	retryAfter  time.Duration
+	// readBound bounds every shared read and tombstoneTTL outlasts it, so a
+	// read that started before a write can not cache what it loaded once
+	// the write invalidated the key.
+	readBound    time.Duration
+	tombstoneTTL time.Duration
+	group        *singleflight.Group
+	// disabledUntil holds a unix nano timestamp until which the cache is
+	// bypassed after a Redis failure.
+	disabledUntil *int64
+}
+
+// NewCompanyRepository bounds the reads that fill the cache by readTimeout,
+// the SQL_READ_TIMEOUT of the repository.
+func NewCompanyRepository(repository companyRepository, client *redis.Client, cfg config.Redis, readTimeout time.Duration, logger zerolog.Logger) companyCache {
+	ttl := cfg.DefaultCacheTTL
+	if cfg.CacheExpirationTime > 0 {
+		ttl = time.Duration(cfg.CacheExpirationTime) * time.Second
+	}
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+
+	readBound := readTimeout
+	if readBound <= 0 {
+		readBound = defaultReadBound
+	}
+
+	return companyCache{
+		companyRepository: repository,
+		enabled:           cfg.UseCache && client != nil,
+		client:            client,
+		logger:            logger,
+		ttl:               ttl,
+		negativeTTL:       cfg.NegativeCacheTTL,
+		retryAfter:        cfg.RetryAfter,
+		readBound:         readBound,
+		tombstoneTTL:      readBound + tombstoneMargin,
+		group:             &singleflight.Group{},
+		disabledUntil:     new(int64),
+	}
+}
+
+func (c companyCache) GetCompany(ctx context.Context, id int) (entities.Company, error) {
+	if !c.enabled {
+		return c.companyRepository.GetCompany(ctx, id)
+	}
+
+	key := keyPrefix + strconv.Itoa(id)
+
+	if c.available() {
+		value, err := c.client.Get(ctx, key).Bytes()
+		switch {
+		case errors.Is(err, redis.Nil), err == nil && string(value) == tombstoneMarker:
+			metrics.CacheRequests.WithLabelValues("miss").Inc()
+		case err == nil:
+			company, err := decode(value)
+			switch {
+			case err == nil:
+				metrics.CacheRequests.WithLabelValues("hit").Inc()
+				return company, nil
+			case errors.Is(err, repositories.ErrCompanyNotFound):
+				metrics.CacheRequests.WithLabelValues("negative_hit").Inc()
+				return company, err
+			}
+			metrics.CacheRequests.WithLabelValues("error").Inc()
+			c.logger.Error().Ctx(ctx).Timestamp().Msg(err.Error())
+		default:
+			metrics.CacheRequests.WithLabelValues("error").Inc()
+			c.fail(err)
+		}
+	} else {
+		metrics.CacheRequests.WithLabelValues("bypass").Inc()
+	}
+
+	// The shared read must not fail for every waiter when the request that
+	// started it goes away, it runs detached and is bounded by readBound
+	// while each caller stops waiting on its own context.
+	results := c.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(detached{ctx}, c.readBound)
+		defer cancel()
+
+		company, err := c.companyRepository.GetCompany(ctx, id)
+		switch {
+		case err == nil:
+			c.set(ctx, key, &company, c.ttl)
+		case errors.Is(err, repositories.ErrCompanyNotFound) && c.negativeTTL > 0:
+			c.set(ctx, key, nil, c.negativeTTL)
+		}
+		return company, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return entities.Company{}, fmt.Errorf("%w: %v", repositories.ErrCanceled, ctx.Err())
+	case result := <-results:
+		if result.Err != nil {
+			return entities.Company{}, result.Err
+		}
+		return result.Val.(entities.Company), nil
+	}
+}
+
+func (c companyCache) CreateCompany(ctx context.Context, company dto.Company) (entities.Company, error) {
+	created, err := c.companyRepository.CreateCompany(ctx, company)
+	if err == nil {
+		c.invalidate(ctx, created.Id)
+	}
+
+	return created, err
+}
+
+func (c companyCache) DeleteCompany(ctx context.Context, id int, version int) error {
+	err := c.companyRepository.DeleteCompany(ctx, id, version)
+	c.invalidate(ctx, id)
+
+	return err
+}
+
+func (c companyCache) UpdateCompany(ctx context.Context, id int, version int, company dto.Company) (entities.Company, error) {
+	updated, err := c.companyRepository.UpdateCompany(ctx, id, version, company)
+	c.invalidate(ctx, id)
+
+	return updated, err
+}
+
+func (c companyCache) PatchCompany(ctx context.Context, id int, version int, patch dto.CompanyPatch) (entities.Company, error) {
+	patched, err := c.companyRepository.PatchCompany(ctx, id, version, patch)
+	c.invalidate(ctx, id)
+
+	return patched, err
+}
+
+func (c companyCache) RestoreCompany(ctx context.Context, id int) (entities.Company, error) {
+	restored, err := c.companyRepository.RestoreCompany(ctx, id)
+	c.invalidate(ctx, id)
+
+	return restored, err
+}
+
+func (c companyCache) PurgeCompany(ctx context.Context, id int) error {
+	err := c.companyRepository.PurgeCompany(ctx, id)
+	c.invalidate(ctx, id)
+
+	return err
+}
+
+func (c companyCache) BatchCompanies(ctx context.Context, operations []dto.BatchOperation, atomic bool) ([]entities.BatchResult, error) {
+	results, err := c.companyRepository.BatchCompanies(ctx, operations, atomic)
+
+	var ids []int
+	for _, result := range results {
+		if result.Err == nil {
+			ids = append(ids, result.Company.Id)
+		}
+	}
+	c.invalidate(ctx, ids...)
+
+	return results, err
+}
+
+// ImportCompanies invalidates the imported companies, a dry run changes none.
+func (c companyCache) ImportCompanies(ctx context.Context, rows []dto.CompanyImport, dryRun bool) ([]entities.BatchResult, error) {
+	results, err := c.companyRepository.ImportCompanies(ctx, rows, dryRun)
+	if dryRun {
+		return results, err
+	}
+
+	var ids []int
+	for _, result := range results {
+		if result.Err == nil {
+			ids = append(ids, result.Company.Id)
+		}
+	}
+	c.invalidate(ctx, ids...)
+
+	return results, err
+}
+
+func (c companyCache) set(ctx context.Context, key string, company *entities.Company, ttl time.Duration) {
+	if !c.available() {
+		return
+	}
+
+	value := []byte(notFoundMarker)
+	if company != nil {
+		var err error
+		value, err = json.Marshal(company)
+		if err != nil {
+			c.logger.Error().Ctx(ctx).Timestamp().Msg(err.Error())
+			return
+		}
+	}
+
+	// Only a missing key is filled, a tombstone means the company changed
+	// while it was read. Running out of the read bound is not a Redis
+	// failure.
+	err := c.client.SetNX(ctx, key, value, ttl).Err()
+	if err != nil && ctx.Err() == nil {
+		c.fail(err)
+	}
+}
+
+// invalidate replaces the cached companies with tombstones. It is attempted
+// even while the cache is considered unavailable so a recovering Redis does
+// not serve stale data, and after the request is gone since the write may
+// have been committed.
+func (c companyCache) invalidate(ctx context.Context, ids ...int) {
+	if !c.enabled || len(ids) == 0 {
+		return
+	}
+
+	ctx = detached{ctx}
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Set(ctx, keyPrefix+strconv.Itoa(id), tombstoneMarker, c.tombstoneTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		c.fail(err)
+	}
+}
+
+func (c companyCache) available() bool {
+	return time.Now().UnixNano() >= atomic.LoadInt64(c.disabledUntil)
+}
+
+func (c companyCache) fail(err error) {
+	c.logger.Error().Timestamp().Msg(err.Error())
+	atomic.StoreInt64(c.disabledUntil, time.Now().Add(c.retryAfter).UnixNano())
+}
+
+func decode(value []byte) (entities.Company, error) {
+	if string(value) == notFoundMarker {
+		return entities.Company{}, repositories.ErrCompanyNotFound
+	}
+
+	var company entities.Company
+	err := json.Unmarshal(value, &company)
+	if err != nil {
+		return entities.Company{}, err
+	}
+
+	return company, nil
+}
+
+// detached keeps the values of a request context but not its cancellation.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
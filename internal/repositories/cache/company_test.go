@@ -0,0 +1,255 @@
+package cache_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/handlers/dto"
+	"xm/internal/repositories"
+	"xm/internal/repositories/cache"
+	"xm/internal/repositories/entities"
+
+	"github.com/alicebob/miniredis/v2"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+var company = entities.Company{
+	Id:              1,
+	Name:            "Test Company",
+	Description:     "Test",
+	EmployeesAmount: 10,
+	Registered:      true,
+	Type:            "corporations",
+	Version:         1,
+}
+
+var cacheConfig = config.Redis{
+	UseCache:         true,
+	DefaultCacheTTL:  time.Minute,
+	NegativeCacheTTL: time.Second,
+	RetryAfter:       time.Minute,
+}
+
+func TestGetCompany(t *testing.T) {
+	loading := make(chan struct{})
+	written := make(chan struct{})
+
+	cases := map[string]struct {
+		mocks func(*MockcompanyRepository)
+		run   func(*testing.T, *miniredis.Miniredis, cacheRepository)
+	}{
+		"served from cache": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 1).Return(company, nil).Times(1)
+			},
+			run: func(t *testing.T, _ *miniredis.Miniredis, c cacheRepository) {
+				for i := 0; i < 3; i++ {
+					got, err := c.GetCompany(context.Background(), 1)
+					assert.NoError(t, err)
+					assert.Equal(t, company, got)
+				}
+			},
+		},
+		"negative caching": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 2).Return(entities.Company{}, repositories.ErrCompanyNotFound).Times(2)
+			},
+			run: func(t *testing.T, server *miniredis.Miniredis, c cacheRepository) {
+				for i := 0; i < 3; i++ {
+					_, err := c.GetCompany(context.Background(), 2)
+					assert.ErrorIs(t, err, repositories.ErrCompanyNotFound)
+				}
+
+				server.FastForward(2 * time.Second)
+				_, err := c.GetCompany(context.Background(), 2)
+				assert.ErrorIs(t, err, repositories.ErrCompanyNotFound)
+			},
+		},
+		"invalidated on update": {
+			mocks: func(mr *MockcompanyRepository) {
+				updated := company
+				updated.Name = "Updated"
+				updated.Version = 2
+
+				gomock.InOrder(
+					mr.EXPECT().GetCompany(gomock.Any(), 1).Return(company, nil),
+					mr.EXPECT().PatchCompany(gomock.Any(), 1, 1, gomock.Any()).Return(updated, nil),
+					mr.EXPECT().GetCompany(gomock.Any(), 1).Return(updated, nil),
+				)
+			},
+			run: func(t *testing.T, _ *miniredis.Miniredis, c cacheRepository) {
+				_, err := c.GetCompany(context.Background(), 1)
+				assert.NoError(t, err)
+
+				name := "Updated"
+				_, err = c.PatchCompany(context.Background(), 1, 1, dto.CompanyPatch{Name: &name})
+				assert.NoError(t, err)
+
+				got, err := c.GetCompany(context.Background(), 1)
+				assert.NoError(t, err)
+				assert.Equal(t, "Updated", got.Name)
+			},
+		},
+		"write during a read": {
+			mocks: func(mr *MockcompanyRepository) {
+				updated := company
+				updated.Name = "Updated"
+				updated.Version = 2
+
+				gomock.InOrder(
+					mr.EXPECT().GetCompany(gomock.Any(), 1).DoAndReturn(func(context.Context, int) (entities.Company, error) {
+						close(loading)
+						<-written
+						return company, nil
+					}),
+					mr.EXPECT().PatchCompany(gomock.Any(), 1, 1, gomock.Any()).Return(updated, nil),
+					mr.EXPECT().GetCompany(gomock.Any(), 1).Return(updated, nil),
+				)
+			},
+			run: func(t *testing.T, _ *miniredis.Miniredis, c cacheRepository) {
+				read := make(chan entities.Company)
+				go func() {
+					got, _ := c.GetCompany(context.Background(), 1)
+					read <- got
+				}()
+
+				<-loading
+				name := "Updated"
+				_, err := c.PatchCompany(context.Background(), 1, 1, dto.CompanyPatch{Name: &name})
+				assert.NoError(t, err)
+				close(written)
+
+				// The read that started before the write returns the old
+				// company but must not cache it.
+				assert.Equal(t, company, <-read)
+
+				got, err := c.GetCompany(context.Background(), 1)
+				assert.NoError(t, err)
+				assert.Equal(t, "Updated", got.Name)
+			},
+		},
+		"falls back when redis is down": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 1).Return(company, nil).Times(2)
+			},
+			run: func(t *testing.T, server *miniredis.Miniredis, c cacheRepository) {
+				server.Close()
+
+				for i := 0; i < 2; i++ {
+					got, err := c.GetCompany(context.Background(), 1)
+					assert.NoError(t, err)
+					assert.Equal(t, company, got)
+				}
+			},
+		},
+		"single flight": {
+			mocks: func(mr *MockcompanyRepository) {
+				mr.EXPECT().GetCompany(gomock.Any(), 1).DoAndReturn(func(context.Context, int) (entities.Company, error) {
+					time.Sleep(50 * time.Millisecond)
+					return company, nil
+				}).Times(1)
+			},
+			run: func(t *testing.T, _ *miniredis.Miniredis, c cacheRepository) {
+				var wg sync.WaitGroup
+				for i := 0; i < 10; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						got, err := c.GetCompany(context.Background(), 1)
+						assert.NoError(t, err)
+						assert.Equal(t, company, got)
+					}()
+				}
+				wg.Wait()
+			},
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			companyRepository := NewMockcompanyRepository(ctrl)
+
+			if tc.mocks != nil {
+				tc.mocks(companyRepository)
+			}
+
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+			defer client.Close()
+
+			tc.run(t, server, cache.NewCompanyRepository(companyRepository, client, cacheConfig, 5*time.Second, logger))
+		})
+	}
+}
+
+func TestTombstoneOutlastsRead(t *testing.T) {
+	cases := map[string]struct {
+		readTimeout time.Duration
+	}{
+		"read timeout":                 {readTimeout: 2 * time.Minute},
+		"read timeout of 0 is bounded": {readTimeout: 0},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			var logger zerolog.Logger
+			var deadline time.Time
+
+			loading := make(chan struct{})
+			written := make(chan struct{})
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			companyRepository := NewMockcompanyRepository(ctrl)
+			companyRepository.EXPECT().GetCompany(gomock.Any(), 1).DoAndReturn(func(ctx context.Context, _ int) (entities.Company, error) {
+				var ok bool
+				deadline, ok = ctx.Deadline()
+				assert.True(t, ok, "the shared read has no deadline")
+				close(loading)
+				<-written
+				return company, nil
+			})
+			companyRepository.EXPECT().PatchCompany(gomock.Any(), 1, 1, gomock.Any()).Return(company, nil)
+
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+			defer client.Close()
+
+			c := cache.NewCompanyRepository(companyRepository, client, cacheConfig, tc.readTimeout, logger)
+
+			read := make(chan struct{})
+			go func() {
+				_, _ = c.GetCompany(context.Background(), 1)
+				close(read)
+			}()
+
+			<-loading
+			name := "Updated"
+			_, err := c.PatchCompany(context.Background(), 1, 1, dto.CompanyPatch{Name: &name})
+			assert.NoError(t, err)
+
+			// The tombstone is still there when the slowest possible read
+			// ends.
+			assert.Greater(t, server.TTL("company:1"), time.Until(deadline))
+
+			close(written)
+			<-read
+		})
+	}
+}
+
+type cacheRepository interface {
+	GetCompany(ctx context.Context, id int) (entities.Company, error)
+	PatchCompany(ctx context.Context, id int, version int, patch dto.CompanyPatch) (entities.Company, error)
+}
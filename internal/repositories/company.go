@@ -1,87 +1,511 @@
 package repositories
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"xm/config"
 	"xm/internal/handlers/dto"
 	"xm/internal/repositories/entities"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+const companyColumns = `id, name, description, employees_amount, registered, type, version, deleted_at`
+
+const purgeBatchSize = 1000
+
 type companyRepository struct {
-	db  *sqlx.DB
-	ctx context.Context
+	db           *sqlx.DB
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	purgeTimeout time.Duration
+	batchTimeout time.Duration
+	// publish queues the events in company_outbox, there is no point without
+	// a dispatcher removing them.
+	publish bool
 }
 
-func NewCompanyRepository(ctx context.Context, db *sqlx.DB) companyRepository {
+func NewCompanyRepository(db *sqlx.DB, cfg config.Postgres, publish bool) companyRepository {
 	return companyRepository{
-		db:  db,
-		ctx: ctx,
+		db:           db,
+		readTimeout:  cfg.ReadTimeout,
+		writeTimeout: cfg.WriteTimeout,
+		purgeTimeout: cfg.PurgeTimeout,
+		batchTimeout: cfg.BatchTimeout,
+		publish:      publish,
 	}
 }
 
+// withTimeout bounds the caller's context by the deadline configured for the
+// operation, a zero timeout leaves it unbounded.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
 func (r companyRepository) GetCompany(ctx context.Context, id int) (entities.Company, error) {
+	ctx, cancel := withTimeout(ctx, r.readTimeout)
+	defer cancel()
+
 	company := entities.Company{}
 
-	err := r.db.GetContext(r.ctx, &company, `SELECT id, name, description, employees_amount, registered, type FROM company WHERE id = $1`, id)
+	err := traced(ctx, "SELECT company", func(ctx context.Context) error {
+		return r.db.GetContext(ctx, &company, `SELECT `+companyColumns+` FROM company WHERE id = $1`, id)
+	})
 
 	if err != nil {
-		return entities.Company{}, err
+		return entities.Company{}, mapError(ctx, err)
+	}
+
+	if company.DeletedAt != nil {
+		return entities.Company{}, ErrCompanyDeleted
 	}
 
 	return company, nil
 }
 
-func (r companyRepository) CreateCompany(ctx context.Context, c dto.Company) (entities.Company, error) {
-	company := entities.Company{
-		Name:            c.Name,
-		Description:     c.Description,
-		EmployeesAmount: c.EmployeesAmount,
-		Registered:      c.Registered,
-		Type:            c.Type,
+// GetCompanies reads the companies with the given IDs in one statement,
+// ordered by ID. Unknown and deleted companies are left out.
+func (r companyRepository) GetCompanies(ctx context.Context, ids []int) ([]entities.Company, error) {
+	ctx, cancel := withTimeout(ctx, r.readTimeout)
+	defer cancel()
+
+	companies := []entities.Company{}
+	if len(ids) == 0 {
+		return companies, nil
 	}
 
-	stmt, err := r.db.PrepareNamedContext(r.ctx, `INSERT INTO company (name, description, employees_amount, registered, type) 
-		VALUES (:name, :description, :employees_amount, :registered, :type) RETURNING ID`)
+	values := make(pq.Int64Array, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, int64(id))
+	}
 
+	err := traced(ctx, "SELECT company", func(ctx context.Context) error {
+		return r.db.SelectContext(ctx, &companies, `SELECT `+companyColumns+` FROM company
+			WHERE id = ANY($1) AND deleted_at IS NULL ORDER BY id`, values)
+	})
 	if err != nil {
-		return entities.Company{}, err
+		return nil, mapError(ctx, err)
 	}
 
-	var id int
-	err = stmt.Get(&id, company)
+	return companies, nil
+}
+
+func (r companyRepository) CreateCompany(ctx context.Context, c dto.Company) (entities.Company, error) {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	company := entities.Company{}
+
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		err := traced(ctx, "INSERT company", func(ctx context.Context) error {
+			return tx.GetContext(ctx, &company, `INSERT INTO company (name, description, employees_amount, registered, type) 
+				VALUES ($1, $2, $3, $4, $5) RETURNING `+companyColumns, c.Name, c.Description, c.EmployeesAmount, c.Registered, c.Type)
+		})
+		if err != nil {
+			return mapError(ctx, err)
+		}
 
-	company.Id = id
+		return r.writeHistory(ctx, tx, entities.ActionCreate, nil, &company)
+	})
 	if err != nil {
 		return entities.Company{}, err
 	}
 
-	return company, err
+	return company, nil
 }
 
-func (r companyRepository) DeleteCompany(ctx context.Context, id int) error {
-	_, err := r.db.ExecContext(r.ctx, `DELETE FROM company WHERE id = $1`, id)
+// DeleteCompany soft deletes the company.
+func (r companyRepository) DeleteCompany(ctx context.Context, id int, version int) error {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	_, err := r.change(ctx, id, version, entities.ActionDelete, func(tx *sqlx.Tx) (entities.Company, error) {
+		company := entities.Company{}
+
+		err := traced(ctx, "UPDATE company", func(ctx context.Context) error {
+			return tx.GetContext(ctx, &company, `UPDATE company SET deleted_at = now(), version = version + 1
+				WHERE id = $1 RETURNING `+companyColumns, id)
+		})
+
+		return company, mapError(ctx, err)
+	})
 
 	return err
 }
 
-func (r companyRepository) UpdateCompany(ctx context.Context, id int, c dto.Company) (entities.Company, error) {
-	var err error
+// UpdateCompany replaces all company fields.
+func (r companyRepository) UpdateCompany(ctx context.Context, id int, version int, c dto.Company) (entities.Company, error) {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
 
-	_, err = r.db.ExecContext(r.ctx, `UPDATE company 
-		SET name = $1, description = $2, employees_amount = $3, registered = $4, type = $5
-		WHERE id = $6`, c.Name, c.Description, c.EmployeesAmount, c.Registered, c.Type, id)
+	return r.change(ctx, id, version, entities.ActionUpdate, func(tx *sqlx.Tx) (entities.Company, error) {
+		company := entities.Company{}
 
+		err := traced(ctx, "UPDATE company", func(ctx context.Context) error {
+			return tx.GetContext(ctx, &company, `UPDATE company 
+				SET name = $1, description = $2, employees_amount = $3, registered = $4, type = $5, version = version + 1
+				WHERE id = $6 RETURNING `+companyColumns, c.Name, c.Description, c.EmployeesAmount, c.Registered, c.Type, id)
+		})
+
+		return company, mapError(ctx, err)
+	})
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+var companySortColumns = map[string]string{
+	"id":               "id",
+	"name":             "name",
+	"description":      "description",
+	"employees_amount": "employees_amount",
+	"registered":       "registered",
+	"type":             "COALESCE(type::text, '')",
+}
+
+type companyCursor struct {
+	Sort  string      `json:"s"`
+	Desc  bool        `json:"d"`
+	Value interface{} `json:"v"`
+	Id    int         `json:"id"`
+}
+
+func (r companyRepository) ListCompanies(ctx context.Context, f dto.CompanyFilter) ([]entities.Company, string, error) {
+	ctx, cancel := withTimeout(ctx, r.readTimeout)
+	defer cancel()
+
+	sortExpr, ok := companySortColumns[f.Sort]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown sort column %q", f.Sort)
+	}
+
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if f.Type != "" {
+		where = append(where, "type = "+arg(f.Type))
+	}
+	if f.Registered != nil {
+		where = append(where, "registered = "+arg(*f.Registered))
+	}
+	if f.NamePrefix != "" {
+		where = append(where, "name LIKE "+arg(escapeLike(f.NamePrefix)+"%")+` ESCAPE '\'`)
+	}
+	if f.EmployeesAmountMin != nil {
+		where = append(where, "employees_amount >= "+arg(*f.EmployeesAmountMin))
+	}
+	if f.EmployeesAmountMax != nil {
+		where = append(where, "employees_amount <= "+arg(*f.EmployeesAmountMax))
+	}
+
+	direction, comparison := "ASC", ">"
+	if f.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if f.Cursor != "" {
+		cursor, err := decodeCompanyCursor(f.Cursor)
+		if err != nil || cursor.Sort != f.Sort || cursor.Desc != f.Desc {
+			return nil, "", ErrInvalidCursor
+		}
+		if f.Sort == "id" {
+			where = append(where, "id "+comparison+" "+arg(cursor.Id))
+		} else {
+			where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", sortExpr, comparison, arg(cursor.Value), arg(cursor.Id)))
+		}
+	}
+
+	where = append(where, "deleted_at IS NULL")
+
+	query := `SELECT ` + companyColumns + ` FROM company WHERE ` + strings.Join(where, " AND ")
+	if f.Sort == "id" {
+		query += fmt.Sprintf(" ORDER BY id %s", direction)
+	} else {
+		query += fmt.Sprintf(" ORDER BY %s %s, id %s", sortExpr, direction, direction)
+	}
+	query += " LIMIT " + arg(f.Limit+1)
+
+	companies := []entities.Company{}
+	err := traced(ctx, "SELECT company", func(ctx context.Context) error {
+		return r.db.SelectContext(ctx, &companies, query, args...)
+	})
 	if err != nil {
-		return entities.Company{}, err
+		return nil, "", mapError(ctx, err)
 	}
 
-	company := entities.Company{}
+	if len(companies) <= f.Limit {
+		return companies, "", nil
+	}
+
+	companies = companies[:f.Limit]
+	last := companies[len(companies)-1]
+	next, err := encodeCompanyCursor(companyCursor{
+		Sort:  f.Sort,
+		Desc:  f.Desc,
+		Value: companySortValue(last, f.Sort),
+		Id:    last.Id,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return companies, next, nil
+}
+
+func companySortValue(c entities.Company, column string) interface{} {
+	switch column {
+	case "name":
+		return c.Name
+	case "description":
+		return c.Description
+	case "employees_amount":
+		return c.EmployeesAmount
+	case "registered":
+		return c.Registered
+	case "type":
+		return c.Type
+	default:
+		return c.Id
+	}
+}
+
+func encodeCompanyCursor(c companyCursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCompanyCursor(s string) (companyCursor, error) {
+	var c companyCursor
 
-	err = r.db.GetContext(r.ctx, &company, `SELECT id, name, description, employees_amount, registered, type FROM company WHERE id = $1`, id)
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return companyCursor{}, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&c)
+	if err != nil {
+		return companyCursor{}, err
+	}
+
+	return c, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// PatchCompany updates only the columns set in the patch.
+func (r companyRepository) PatchCompany(ctx context.Context, id int, version int, p dto.CompanyPatch) (entities.Company, error) {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	var set []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if p.Name != nil {
+		set = append(set, "name = "+arg(*p.Name))
+	}
+	if p.Description != nil {
+		set = append(set, "description = "+arg(*p.Description))
+	}
+	if p.EmployeesAmount != nil {
+		set = append(set, "employees_amount = "+arg(*p.EmployeesAmount))
+	}
+	if p.Registered != nil {
+		set = append(set, "registered = "+arg(*p.Registered))
+	}
+	if p.Type != nil {
+		set = append(set, "type = "+arg(*p.Type))
+	}
+
+	if len(set) == 0 {
+		company, err := r.GetCompany(ctx, id)
+		if err == nil && version != 0 && company.Version != version {
+			return entities.Company{}, ErrVersionMismatch
+		}
+		return company, err
+	}
+
+	set = append(set, "version = version + 1")
+	query := fmt.Sprintf(`UPDATE company SET %s WHERE id = %s RETURNING `+companyColumns, strings.Join(set, ", "), arg(id))
+
+	return r.change(ctx, id, version, entities.ActionUpdate, func(tx *sqlx.Tx) (entities.Company, error) {
+		company := entities.Company{}
+
+		err := traced(ctx, "UPDATE company", func(ctx context.Context) error {
+			return tx.GetContext(ctx, &company, query, args...)
+		})
+
+		return company, mapError(ctx, err)
+	})
+}
+
+func (r companyRepository) RestoreCompany(ctx context.Context, id int) (entities.Company, error) {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	return r.change(ctx, id, 0, entities.ActionRestore, func(tx *sqlx.Tx) (entities.Company, error) {
+		company := entities.Company{}
+
+		err := traced(ctx, "UPDATE company", func(ctx context.Context) error {
+			return tx.GetContext(ctx, &company, `UPDATE company SET deleted_at = NULL, version = version + 1
+				WHERE id = $1 RETURNING `+companyColumns, id)
+		})
+
+		return company, mapError(ctx, err)
+	})
+}
+
+// PurgeCompany permanently removes the company whether or not it was soft
+// deleted. Its history is kept.
+func (r companyRepository) PurgeCompany(ctx context.Context, id int) error {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	_, err := r.change(ctx, id, 0, entities.ActionPurge, func(tx *sqlx.Tx) (entities.Company, error) {
+		err := traced(ctx, "DELETE company", func(ctx context.Context) error {
+			_, err := tx.ExecContext(ctx, `DELETE FROM company WHERE id = $1`, id)
+			return err
+		})
+
+		return entities.Company{}, mapError(ctx, err)
+	})
+
+	return err
+}
+
+// PurgeDeleted permanently removes companies soft deleted before the given
+// time, in batches so a large backlog does not hold long locks.
+func (r companyRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var total int64
+
+	for {
+		affected, err := r.purgeBatch(ctx, before)
+		if err != nil {
+			return total, err
+		}
+
+		total += affected
+		if affected < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
+func (r companyRepository) purgeBatch(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx, r.purgeTimeout)
+	defer cancel()
+
+	var affected int64
+	err := traced(ctx, "DELETE company deleted", func(ctx context.Context) error {
+		result, err := r.db.ExecContext(ctx, `WITH purged AS (
+				DELETE FROM company WHERE id IN (
+					SELECT id FROM company WHERE deleted_at < $1 LIMIT $2 FOR UPDATE SKIP LOCKED)
+				RETURNING `+companyColumns+`
+			)
+			INSERT INTO company_history (company_id, version, action, actor, request_id, before, changed_fields)
+			SELECT id, version + 1, $3, $4, '', `+companySnapshotSQL+`, $5 FROM purged`,
+			before, purgeBatchSize, entities.ActionPurge, systemActor, pq.StringArray(companyFields))
+		if err != nil {
+			return err
+		}
+
+		affected, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, mapError(ctx, err)
+	}
+
+	return affected, nil
+}
+
+// change locks the company row, checks its state against the action and the
+// expected version, applies the write and records it in the company history
+// within one transaction. A non-zero version makes the write conditional on
+// the company still being at that version.
+func (r companyRepository) change(ctx context.Context, id int, version int, action string, apply func(tx *sqlx.Tx) (entities.Company, error)) (entities.Company, error) {
+	var after entities.Company
+
+	err := r.inTx(ctx, func(tx *sqlx.Tx) error {
+		before := entities.Company{}
+
+		err := traced(ctx, "SELECT company FOR UPDATE", func(ctx context.Context) error {
+			return tx.GetContext(ctx, &before, `SELECT `+companyColumns+` FROM company WHERE id = $1 FOR UPDATE`, id)
+		})
+		if err != nil {
+			return mapError(ctx, err)
+		}
+
+		switch {
+		case action == entities.ActionRestore && before.DeletedAt == nil:
+			return ErrCompanyNotDeleted
+		case action != entities.ActionRestore && action != entities.ActionPurge && before.DeletedAt != nil:
+			return ErrCompanyDeleted
+		case version != 0 && before.Version != version:
+			return ErrVersionMismatch
+		}
+
+		after, err = apply(tx)
+		if err != nil {
+			return err
+		}
+
+		if action == entities.ActionPurge {
+			return r.writeHistory(ctx, tx, action, &before, nil)
+		}
+
+		return r.writeHistory(ctx, tx, action, &before, &after)
+	})
 	if err != nil {
 		return entities.Company{}, err
 	}
 
-	return company, nil
+	return after, nil
+}
+
+func (r companyRepository) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	return inTx(ctx, r.db, fn)
+}
+
+func inTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return mapError(ctx, err)
+	}
+
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return mapError(ctx, traced(ctx, "COMMIT", func(ctx context.Context) error {
+		return tx.Commit()
+	}))
 }
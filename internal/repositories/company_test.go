@@ -0,0 +1,135 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/handlers/dto"
+	"xm/internal/repositories"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const queryDelay = 5 * time.Second
+
+var companyColumns = []string{"id", "name", "description", "employees_amount", "registered", "type", "version", "deleted_at"}
+
+func newRepository(t *testing.T, cfg config.Postgres) (sqlmock.Sqlmock, func(ctx context.Context) error, func(ctx context.Context) error) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	repository := repositories.NewCompanyRepository(sqlx.NewDb(db, "postgres"), cfg, true)
+
+	get := func(ctx context.Context) error {
+		_, err := repository.GetCompany(ctx, 1)
+		return err
+	}
+	update := func(ctx context.Context) error {
+		_, err := repository.UpdateCompany(ctx, 1, 0, dto.Company{Name: "Test", Type: "corporations"})
+		return err
+	}
+
+	return mock, get, update
+}
+
+func TestQueryContext(t *testing.T) {
+	cases := map[string]struct {
+		Config  config.Postgres
+		Write   bool
+		Cancel  bool
+		WantErr error
+	}{
+		"read cancelled by client": {
+			Cancel:  true,
+			WantErr: repositories.ErrCanceled,
+		},
+		"read deadline": {
+			Config:  config.Postgres{ReadTimeout: 50 * time.Millisecond},
+			WantErr: repositories.ErrTimeout,
+		},
+		"write cancelled by client": {
+			Write:   true,
+			Cancel:  true,
+			WantErr: repositories.ErrCanceled,
+		},
+		"write deadline": {
+			Config:  config.Postgres{WriteTimeout: 50 * time.Millisecond},
+			Write:   true,
+			WantErr: repositories.ErrTimeout,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			mock, get, update := newRepository(t, tc.Config)
+
+			call := get
+			if tc.Write {
+				call = update
+				mock.ExpectBegin()
+			}
+			mock.ExpectQuery(`SELECT .+ FROM company WHERE id = \$1`).
+				WithArgs(1).
+				WillDelayFor(queryDelay).
+				WillReturnRows(sqlmock.NewRows(companyColumns))
+			if tc.Write {
+				mock.ExpectRollback()
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.Cancel {
+				time.AfterFunc(50*time.Millisecond, cancel)
+			}
+
+			start := time.Now()
+			err := call(ctx)
+
+			assert.True(t, errors.Is(err, tc.WantErr), "got %v", err)
+			assert.Less(t, time.Since(start), queryDelay)
+		})
+	}
+}
+
+func TestGetCompanyRequestContext(t *testing.T) {
+	mock, get, _ := newRepository(t, config.Postgres{ReadTimeout: time.Second})
+
+	mock.ExpectQuery(`SELECT .+ FROM company WHERE id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(companyColumns).AddRow(1, "Test", "", 10, true, "corporations", 1, nil))
+
+	require.NoError(t, get(context.Background()))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetCompanies(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repository := repositories.NewCompanyRepository(sqlx.NewDb(db, "postgres"), config.Postgres{}, true)
+
+	mock.ExpectQuery(`SELECT .+ FROM company\s+WHERE id = ANY\(\$1\) AND deleted_at IS NULL ORDER BY id`).
+		WithArgs("{3,1,7}").
+		WillReturnRows(sqlmock.NewRows(companyColumns).
+			AddRow(1, "Acme", "", 10, true, "corporations", 2, nil).
+			AddRow(3, "Beta", "", 5, false, "cooperative", 1, nil))
+
+	companies, err := repository.GetCompanies(context.Background(), []int{3, 1, 7})
+	require.NoError(t, err)
+	require.Len(t, companies, 2)
+	assert.Equal(t, 1, companies[0].Id)
+	assert.Equal(t, 3, companies[1].Id)
+
+	// Without IDs there is nothing to read.
+	companies, err = repository.GetCompanies(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, companies)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
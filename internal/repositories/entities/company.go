@@ -1,10 +1,68 @@
 package entities
 
+import "time"
+
 type Company struct {
-	Id              int    `db:"id"`
-	Name            string `db:"name"`
-	Description     string `db:"description"`
-	EmployeesAmount int    `db:"employees_amount"`
-	Registered      bool   `db:"registered"`
-	Type            string `db:"type"`
+	Id              int        `db:"id"`
+	Name            string     `db:"name"`
+	Description     string     `db:"description"`
+	EmployeesAmount int        `db:"employees_amount"`
+	Registered      bool       `db:"registered"`
+	Type            string     `db:"type"`
+	Version         int        `db:"version"`
+	DeletedAt       *time.Time `db:"deleted_at" json:",omitempty"`
+}
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+)
+
+type CompanyHistory struct {
+	Id            int64     `json:"id"`
+	CompanyId     int       `json:"company_id"`
+	Version       int       `json:"version"`
+	Action        string    `json:"action"`
+	Actor         string    `json:"actor"`
+	RequestId     string    `json:"request_id"`
+	Before        *Company  `json:"before"`
+	After         *Company  `json:"after"`
+	ChangedFields []string  `json:"changed_fields"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// BatchResult is the outcome of one batch operation. On success Company is
+// the company after the operation.
+type BatchResult struct {
+	Op      string
+	Company Company
+	Err     error
+}
+
+const (
+	EventCompanyCreated = "CompanyCreated"
+	EventCompanyUpdated = "CompanyUpdated"
+	EventCompanyDeleted = "CompanyDeleted"
+
+	// EventSchemaVersion is raised on incompatible changes of CompanyEvent.
+	EventSchemaVersion = 1
+)
+
+// CompanyEvent tells downstream services that a company changed. Id grows
+// with every event and identifies redeliveries, Company is the full snapshot
+// after the change.
+type CompanyEvent struct {
+	Id            int64     `json:"id"`
+	Type          string    `json:"type"`
+	SchemaVersion int       `json:"schema_version"`
+	CompanyId     int       `json:"company_id"`
+	Version       int       `json:"version"`
+	Actor         string    `json:"actor"`
+	RequestId     string    `json:"request_id"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	Company       Company   `json:"company"`
+	Attempts      int       `json:"-"`
 }
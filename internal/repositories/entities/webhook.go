@@ -0,0 +1,54 @@
+package entities
+
+import "time"
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is a subscription to company events. The secret signs deliveries
+// and is never returned.
+type Webhook struct {
+	Id                  int64      `json:"id"`
+	URL                 string     `json:"url"`
+	Secret              string     `json:"-"`
+	EventTypes          []string   `json:"event_types"`
+	Owner               string     `json:"owner"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// WebhookDelivery is one event sent to one webhook, retried until the
+// endpoint accepts it or the webhook is disabled.
+type WebhookDelivery struct {
+	Id             int64        `json:"id"`
+	WebhookId      int64        `json:"webhook_id"`
+	Event          CompanyEvent `json:"event"`
+	Status         string       `json:"status"`
+	Attempts       int          `json:"attempts"`
+	LastStatusCode int          `json:"last_status_code,omitempty"`
+	LastError      string       `json:"last_error,omitempty"`
+	NextAttemptAt  time.Time    `json:"next_attempt_at"`
+	CreatedAt      time.Time    `json:"created_at"`
+	FinishedAt     *time.Time   `json:"finished_at,omitempty"`
+	URL            string       `json:"-"`
+	Secret         string       `json:"-"`
+}
+
+// WebhookAttempt is the outcome of one POST of a delivery. A zero StatusCode
+// means no response was received.
+type WebhookAttempt struct {
+	DeliveryId int64
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+}
+
+// Succeeded reports whether the endpoint accepted the delivery.
+func (a WebhookAttempt) Succeeded() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrCompanyNotFound     = errors.New("company not found")
+	ErrDuplicateName       = errors.New("company name already exists")
+	ErrInvalidCompanyType  = errors.New("invalid company type")
+	ErrConstraintViolation = errors.New("constraint violation")
+	ErrUnavailable         = errors.New("database unavailable")
+	ErrVersionMismatch     = errors.New("company version mismatch")
+	ErrCompanyDeleted      = errors.New("company deleted")
+	ErrCompanyNotDeleted   = errors.New("company is not deleted")
+	ErrCanceled            = errors.New("query canceled")
+	ErrTimeout             = errors.New("query timeout")
+)
+
+const (
+	pqUniqueViolation           = "23505"
+	pqInvalidTextRepresentation = "22P02"
+	pqStringDataRightTruncation = "22001"
+	pqNumericValueOutOfRange    = "22003"
+	pqAdminShutdown             = "57P01"
+	pqCrashShutdown             = "57P02"
+	pqCannotConnectNow          = "57P03"
+)
+
+// mapError translates driver errors into the repository errors. A query that
+// failed because ctx was cancelled or ran past its deadline is reported as
+// such whatever the driver returned.
+func mapError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return fmt.Errorf("%w: %v", ErrCanceled, err)
+	case context.DeadlineExceeded:
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %v", ErrCompanyNotFound, err)
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code == pqUniqueViolation && pqErr.Constraint == "company_name":
+			return fmt.Errorf("%w: %v", ErrDuplicateName, err)
+		case pqErr.Code == pqInvalidTextRepresentation && pqErr.DataTypeName == "company_type",
+			pqErr.Code == pqInvalidTextRepresentation && pqErr.Routine == "enum_in":
+			return fmt.Errorf("%w: %v", ErrInvalidCompanyType, err)
+		case pqErr.Code.Class() == "23",
+			pqErr.Code == pqStringDataRightTruncation,
+			pqErr.Code == pqNumericValueOutOfRange:
+			return fmt.Errorf("%w: %v", ErrConstraintViolation, err)
+		case pqErr.Code.Class() == "08",
+			pqErr.Code.Class() == "53",
+			pqErr.Code == pqAdminShutdown,
+			pqErr.Code == pqCrashShutdown,
+			pqErr.Code == pqCannotConnectNow,
+			pqErr.Code.Class() == "40":
+			return fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		return err
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	return err
+}
@@ -0,0 +1,221 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+	"xm/internal/auth"
+	"xm/internal/repositories/entities"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// systemActor is recorded for changes made by background jobs.
+const systemActor = "system"
+
+// companySnapshotSQL renders a purged row the same way json.Marshal renders
+// entities.Company so snapshots written in SQL and in Go are interchangeable.
+const companySnapshotSQL = `jsonb_build_object('Id', id, 'Name', name, 'Description', description,
+	'EmployeesAmount', employees_amount, 'Registered', registered, 'Type', type, 'Version', version, 'DeletedAt', deleted_at)`
+
+var companyFields = []string{"name", "description", "employees_amount", "registered", "type", "deleted_at"}
+
+var ErrHistoryNotFound = errors.New("company history version not found")
+
+type historyRow struct {
+	Id            int64          `db:"id"`
+	CompanyId     int            `db:"company_id"`
+	Version       int            `db:"version"`
+	Action        string         `db:"action"`
+	Actor         string         `db:"actor"`
+	RequestId     string         `db:"request_id"`
+	Before        []byte         `db:"before"`
+	After         []byte         `db:"after"`
+	ChangedFields pq.StringArray `db:"changed_fields"`
+	CreatedAt     time.Time      `db:"created_at"`
+}
+
+const historyColumns = `id, company_id, version, action, actor, request_id, before, after, changed_fields, created_at`
+
+func newHistoryRow(ctx context.Context, action string, before *entities.Company, after *entities.Company) (historyRow, error) {
+	row := historyRow{
+		Action:        action,
+		Actor:         auth.Subject(ctx),
+		RequestId:     middleware.GetReqID(ctx),
+		ChangedFields: changedFields(before, after),
+	}
+
+	var err error
+	if before != nil {
+		row.CompanyId, row.Version = before.Id, before.Version+1
+		row.Before, err = json.Marshal(before)
+		if err != nil {
+			return historyRow{}, err
+		}
+	}
+	if after != nil {
+		row.CompanyId, row.Version = after.Id, after.Version
+		row.After, err = json.Marshal(after)
+		if err != nil {
+			return historyRow{}, err
+		}
+	}
+
+	return row, nil
+}
+
+// writeHistory records the change and emits its event under the ID of the
+// history record.
+func (r companyRepository) writeHistory(ctx context.Context, tx *sqlx.Tx, action string, before *entities.Company, after *entities.Company) error {
+	row, err := newHistoryRow(ctx, action, before, after)
+	if err != nil {
+		return err
+	}
+
+	err = traced(ctx, "INSERT company_history", func(ctx context.Context) error {
+		return tx.GetContext(ctx, &row.Id, `INSERT INTO company_history
+			(company_id, version, action, actor, request_id, before, after, changed_fields)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+			row.CompanyId, row.Version, row.Action, row.Actor, row.RequestId, row.Before, row.After, row.ChangedFields)
+	})
+	if err != nil {
+		return mapError(ctx, err)
+	}
+
+	var events []outboxRow
+	if event, ok := newOutboxRow(row, before); ok {
+		events = append(events, event)
+	}
+
+	return writeOutbox(ctx, tx, events, r.publish)
+}
+
+func (r companyRepository) ListCompanyHistory(ctx context.Context, companyId int, limit int, cursor string) ([]entities.CompanyHistory, string, error) {
+	ctx, cancel := withTimeout(ctx, r.readTimeout)
+	defer cancel()
+
+	var after int64
+
+	if cursor != "" {
+		c, err := decodeCompanyCursor(cursor)
+		if err != nil || c.Sort != "history" {
+			return nil, "", ErrInvalidCursor
+		}
+		after = int64(c.Id)
+	}
+
+	rows := []historyRow{}
+	err := traced(ctx, "SELECT company_history", func(ctx context.Context) error {
+		return r.db.SelectContext(ctx, &rows, `SELECT `+historyColumns+` FROM company_history
+			WHERE company_id = $1 AND id > $2 ORDER BY id LIMIT $3`, companyId, after, limit+1)
+	})
+	if err != nil {
+		return nil, "", mapError(ctx, err)
+	}
+
+	var next string
+	if len(rows) > limit {
+		rows = rows[:limit]
+		next, err = encodeCompanyCursor(companyCursor{Sort: "history", Id: int(rows[len(rows)-1].Id)})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	history := make([]entities.CompanyHistory, 0, len(rows))
+	for _, row := range rows {
+		entry, err := row.entity()
+		if err != nil {
+			return nil, "", err
+		}
+		history = append(history, entry)
+	}
+
+	return history, next, nil
+}
+
+func (r companyRepository) GetCompanyHistory(ctx context.Context, companyId int, version int) (entities.CompanyHistory, error) {
+	ctx, cancel := withTimeout(ctx, r.readTimeout)
+	defer cancel()
+
+	row := historyRow{}
+
+	err := traced(ctx, "SELECT company_history", func(ctx context.Context) error {
+		return r.db.GetContext(ctx, &row, `SELECT `+historyColumns+` FROM company_history
+			WHERE company_id = $1 AND version = $2 ORDER BY id DESC LIMIT 1`, companyId, version)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return entities.CompanyHistory{}, ErrHistoryNotFound
+	}
+	if err != nil {
+		return entities.CompanyHistory{}, mapError(ctx, err)
+	}
+
+	return row.entity()
+}
+
+func (row historyRow) entity() (entities.CompanyHistory, error) {
+	entry := entities.CompanyHistory{
+		Id:            row.Id,
+		CompanyId:     row.CompanyId,
+		Version:       row.Version,
+		Action:        row.Action,
+		Actor:         row.Actor,
+		RequestId:     row.RequestId,
+		ChangedFields: row.ChangedFields,
+		CreatedAt:     row.CreatedAt,
+	}
+
+	for _, snapshot := range []struct {
+		data []byte
+		dest **entities.Company
+	}{{row.Before, &entry.Before}, {row.After, &entry.After}} {
+		if len(snapshot.data) == 0 {
+			continue
+		}
+		company := &entities.Company{}
+		err := json.Unmarshal(snapshot.data, company)
+		if err != nil {
+			return entities.CompanyHistory{}, err
+		}
+		*snapshot.dest = company
+	}
+
+	if entry.ChangedFields == nil {
+		entry.ChangedFields = []string{}
+	}
+
+	return entry, nil
+}
+
+func changedFields(before *entities.Company, after *entities.Company) []string {
+	if before == nil || after == nil {
+		return append([]string(nil), companyFields...)
+	}
+
+	changed := []string{}
+	if before.Name != after.Name {
+		changed = append(changed, "name")
+	}
+	if before.Description != after.Description {
+		changed = append(changed, "description")
+	}
+	if before.EmployeesAmount != after.EmployeesAmount {
+		changed = append(changed, "employees_amount")
+	}
+	if before.Registered != after.Registered {
+		changed = append(changed, "registered")
+	}
+	if before.Type != after.Type {
+		changed = append(changed, "type")
+	}
+	if (before.DeletedAt == nil) != (after.DeletedAt == nil) {
+		changed = append(changed, "deleted_at")
+	}
+
+	return changed
+}
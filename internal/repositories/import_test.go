@@ -0,0 +1,121 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/handlers/dto"
+	"xm/internal/repositories"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportCompanies(t *testing.T) {
+	acme := dto.Company{Name: "Acme", EmployeesAmount: 10, Registered: true, Type: "corporations"}
+	beta := dto.Company{Name: "Beta", EmployeesAmount: 5, Registered: true, Type: "cooperative"}
+
+	cases := map[string]struct {
+		dryRun bool
+		finish func(mock sqlmock.Sqlmock)
+	}{
+		"import": {
+			finish: func(mock sqlmock.Sqlmock) {
+				mock.ExpectCommit()
+			},
+		},
+		"dry run": {
+			dryRun: true,
+			finish: func(mock sqlmock.Sqlmock) {
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			repository := repositories.NewCompanyRepository(sqlx.NewDb(db, "postgres"), config.Postgres{}, true)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT id, name FROM company\s+WHERE name = ANY\(\$1\) AND deleted_at IS NULL`).
+				WithArgs(pq.StringArray{"Acme", "Beta"}).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(5, "Beta"))
+			mock.ExpectQuery(`SELECT .+ FROM company\s+WHERE id = ANY\(\$1\) ORDER BY id FOR UPDATE`).
+				WithArgs(pq.Int64Array{5, 7}).
+				WillReturnRows(sqlmock.NewRows(companyColumns).
+					AddRow(5, "Beta", "", 1, true, "cooperative", 2, nil).
+					AddRow(7, "Old", "", 1, true, "corporations", 1, nil))
+			mock.ExpectExec(`SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`INSERT INTO company .+ FROM unnest`).
+				WithArgs(pq.StringArray{"Acme"}, pq.StringArray{""}, pq.Int64Array{10}, pq.BoolArray{true}, pq.StringArray{"corporations"}).
+				WillReturnRows(sqlmock.NewRows(companyColumns).AddRow(10, "Acme", "", 10, true, "corporations", 1, nil))
+			mock.ExpectExec(`RELEASE SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(`SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`UPDATE company AS c .+ FROM unnest`).
+				WithArgs(pq.Int64Array{5, 7}, pq.StringArray{"Beta", "Gamma"}, pq.StringArray{"", ""}, pq.Int64Array{5, 3}, pq.BoolArray{true, true}, pq.StringArray{"cooperative", "corporations"}).
+				WillReturnRows(sqlmock.NewRows(companyColumns).
+					AddRow(5, "Beta", "", 5, true, "cooperative", 3, nil).
+					AddRow(7, "Gamma", "", 3, true, "corporations", 2, nil))
+			mock.ExpectExec(`RELEASE SAVEPOINT batch`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`INSERT INTO company_history .+ FROM unnest`).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "company_id"}).AddRow(20, 10).AddRow(21, 5).AddRow(22, 7))
+			mock.ExpectExec(`INSERT INTO company_outbox .+ FROM unnest`).WillReturnResult(sqlmock.NewResult(0, 3))
+			tc.finish(mock)
+
+			results, err := repository.ImportCompanies(context.Background(), []dto.CompanyImport{
+				{Line: 2, Company: acme},
+				{Line: 3, Company: beta},
+				{Line: 4, Id: 7, Company: dto.Company{Name: "Gamma", EmployeesAmount: 3, Registered: true, Type: "corporations"}},
+			}, tc.dryRun)
+			require.NoError(t, err)
+
+			var ops []string
+			var ids []int
+			for _, result := range results {
+				require.NoError(t, result.Err)
+				ops = append(ops, result.Op)
+				ids = append(ids, result.Company.Id)
+			}
+			assert.Equal(t, []string{dto.BatchCreate, dto.BatchUpdate, dto.BatchUpdate}, ops)
+			assert.Equal(t, []int{10, 5, 7}, ids)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestImportCompaniesConflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repository := repositories.NewCompanyRepository(sqlx.NewDb(db, "postgres"), config.Postgres{}, true)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, name FROM company`).
+		WithArgs(pq.StringArray{"Acme"}).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectQuery(`SELECT .+ FOR UPDATE`).
+		WithArgs(pq.Int64Array{7}).
+		WillReturnRows(sqlmock.NewRows(companyColumns).AddRow(7, "Old", "", 1, true, "corporations", 1, time.Now()))
+	mock.ExpectRollback()
+
+	_, err = repository.ImportCompanies(context.Background(), []dto.CompanyImport{
+		{Line: 2, Company: dto.Company{Name: "Acme", Type: "corporations"}},
+		{Line: 3, Id: 7, Company: dto.Company{Name: "Gamma", Type: "corporations"}},
+	}, true)
+
+	var batchErr *repositories.BatchError
+	require.True(t, errors.As(err, &batchErr), "got %v", err)
+	assert.Equal(t, 1, batchErr.Index)
+	assert.True(t, errors.Is(err, repositories.ErrCompanyDeleted), "got %v", err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,2 @@
+-- +migrate Down
+ALTER TABLE company DROP COLUMN IF EXISTS version;
@@ -0,0 +1,3 @@
+-- +migrate Down
+DROP INDEX IF EXISTS idempotency_key_expires_at;
+DROP TABLE IF EXISTS idempotency_key;
@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS idempotency_key
+(
+    key VARCHAR(255) PRIMARY KEY NOT NULL
+    ,fingerprint VARCHAR(64) NOT NULL
+    ,completed BOOLEAN NOT NULL DEFAULT false
+    ,status_code INT NOT NULL DEFAULT 0
+    ,header JSONB
+    ,body BYTEA
+    ,expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_key_expires_at ON idempotency_key (expires_at);
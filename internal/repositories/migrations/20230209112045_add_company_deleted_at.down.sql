@@ -0,0 +1,6 @@
+-- +migrate Down
+DROP INDEX IF EXISTS company_deleted_at;
+DROP INDEX IF EXISTS company_name;
+DELETE FROM company WHERE deleted_at IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS company_name ON company (name);
+ALTER TABLE company DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE company ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+DROP INDEX IF EXISTS company_name;
+CREATE UNIQUE INDEX IF NOT EXISTS company_name ON company (name) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS company_deleted_at ON company (deleted_at) WHERE deleted_at IS NOT NULL;
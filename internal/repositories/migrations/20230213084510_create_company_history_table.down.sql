@@ -0,0 +1,5 @@
+-- +migrate Down
+DROP TRIGGER IF EXISTS company_history_immutable ON company_history;
+DROP FUNCTION IF EXISTS company_history_immutable();
+DROP INDEX IF EXISTS company_history_company_id;
+DROP TABLE IF EXISTS company_history;
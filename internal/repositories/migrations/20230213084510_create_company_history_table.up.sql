@@ -0,0 +1,26 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS company_history
+(
+    id BIGSERIAL PRIMARY KEY NOT NULL
+    ,company_id INT NOT NULL
+    ,version INT NOT NULL
+    ,action VARCHAR(16) NOT NULL
+    ,actor VARCHAR(255) NOT NULL
+    ,request_id VARCHAR(255) NOT NULL
+    ,before JSONB
+    ,after JSONB
+    ,changed_fields TEXT[] NOT NULL
+    ,created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS company_history_company_id ON company_history (company_id, id);
+
+CREATE OR REPLACE FUNCTION company_history_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'company_history is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER company_history_immutable
+    BEFORE UPDATE OR DELETE ON company_history
+    FOR EACH ROW EXECUTE FUNCTION company_history_immutable();
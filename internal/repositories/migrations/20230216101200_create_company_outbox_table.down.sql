@@ -0,0 +1,3 @@
+-- +migrate Down
+DROP INDEX IF EXISTS company_outbox_company_id;
+DROP TABLE IF EXISTS company_outbox;
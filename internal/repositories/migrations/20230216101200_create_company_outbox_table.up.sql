@@ -0,0 +1,18 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS company_outbox
+(
+    id BIGSERIAL PRIMARY KEY NOT NULL
+    ,company_id INT NOT NULL
+    ,version INT NOT NULL
+    ,event_type VARCHAR(32) NOT NULL
+    ,schema_version INT NOT NULL
+    ,actor VARCHAR(255) NOT NULL
+    ,request_id VARCHAR(255) NOT NULL
+    ,company JSONB NOT NULL
+    ,created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    ,attempts INT NOT NULL DEFAULT 0
+    ,next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    ,last_error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS company_outbox_company_id ON company_outbox (company_id, id);
@@ -0,0 +1,8 @@
+-- +migrate Down
+DROP INDEX IF EXISTS webhook_attempt_delivery_id;
+DROP TABLE IF EXISTS webhook_attempt;
+DROP INDEX IF EXISTS webhook_delivery_subscription_id;
+DROP INDEX IF EXISTS webhook_delivery_pending;
+DROP TABLE IF EXISTS webhook_delivery;
+DROP INDEX IF EXISTS webhook_subscription_owner;
+DROP TABLE IF EXISTS webhook_subscription;
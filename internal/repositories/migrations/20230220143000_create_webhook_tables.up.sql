@@ -0,0 +1,46 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS webhook_subscription
+(
+    id BIGSERIAL PRIMARY KEY NOT NULL
+    ,url TEXT NOT NULL
+    ,secret VARCHAR(255) NOT NULL
+    ,event_types TEXT[] NOT NULL
+    ,owner VARCHAR(255) NOT NULL
+    ,enabled BOOLEAN NOT NULL DEFAULT true
+    ,consecutive_failures INT NOT NULL DEFAULT 0
+    ,disabled_at TIMESTAMPTZ
+    ,created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_subscription_owner ON webhook_subscription (owner, id);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery
+(
+    id BIGSERIAL PRIMARY KEY NOT NULL
+    ,subscription_id BIGINT NOT NULL REFERENCES webhook_subscription (id) ON DELETE CASCADE
+    ,event_id BIGINT NOT NULL
+    ,company_id INT NOT NULL
+    ,event JSONB NOT NULL
+    ,status VARCHAR(16) NOT NULL DEFAULT 'pending'
+    ,attempts INT NOT NULL DEFAULT 0
+    ,next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    ,last_status_code INT NOT NULL DEFAULT 0
+    ,last_error TEXT NOT NULL DEFAULT ''
+    ,created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+    ,finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_pending ON webhook_delivery (subscription_id, company_id, id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_delivery_subscription_id ON webhook_delivery (subscription_id, id);
+
+CREATE TABLE IF NOT EXISTS webhook_attempt
+(
+    id BIGSERIAL PRIMARY KEY NOT NULL
+    ,delivery_id BIGINT NOT NULL REFERENCES webhook_delivery (id) ON DELETE CASCADE
+    ,status_code INT NOT NULL
+    ,error TEXT NOT NULL
+    ,duration_ms DOUBLE PRECISION NOT NULL
+    ,attempted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_attempt_delivery_id ON webhook_attempt (delivery_id, id);
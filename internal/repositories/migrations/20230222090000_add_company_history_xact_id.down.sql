@@ -0,0 +1,3 @@
+-- +migrate Down
+DROP INDEX IF EXISTS company_history_xact_id;
+ALTER TABLE company_history DROP COLUMN IF EXISTS xact_id;
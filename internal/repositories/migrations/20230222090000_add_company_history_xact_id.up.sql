@@ -0,0 +1,4 @@
+-- +migrate Up
+ALTER TABLE company_history ADD COLUMN IF NOT EXISTS xact_id BIGINT NOT NULL DEFAULT txid_current();
+
+CREATE INDEX IF NOT EXISTS company_history_xact_id ON company_history (xact_id);
@@ -0,0 +1,2 @@
+-- +migrate Down
+ALTER TABLE idempotency_key DROP COLUMN IF EXISTS token;
@@ -0,0 +1,2 @@
+-- +migrate Up
+ALTER TABLE idempotency_key ADD COLUMN IF NOT EXISTS token VARCHAR(32) NOT NULL DEFAULT '';
@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/rs/zerolog"
+)
+
+type MigrationStatus struct {
+	Version  int64
+	Dirty    bool
+	Expected int64
+	Pending  int
+}
+
+type migrator struct {
+	migrate *migrate.Migrate
+}
+
+// NewMigrator applies the migrations embedded in the binary. It opens its own
+// connection because golang-migrate closes the database it runs on. Every
+// command holds a Postgres advisory lock, so replicas migrating at once run
+// one after another; lockTimeout bounds the wait for it.
+func NewMigrator(driverName string, dsn string, lockTimeout time.Duration, logger zerolog.Logger) (migrator, error) {
+	files, err := iofs.New(migrationFiles, "migrations")
+	if err != nil {
+		return migrator{}, err
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return migrator{}, err
+	}
+
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		_ = db.Close()
+		return migrator{}, err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", files, "postgres", driver)
+	if err != nil {
+		_ = driver.Close()
+		return migrator{}, err
+	}
+	m.LockTimeout = lockTimeout
+	m.Log = migrateLogger{logger: logger}
+
+	return migrator{migrate: m}, nil
+}
+
+// Up applies every pending migration.
+func (m migrator) Up() error {
+	return ignoreNoChange(m.migrate.Up())
+}
+
+// Down reverts the last steps migrations.
+func (m migrator) Down(steps int) error {
+	if steps < 1 {
+		return fmt.Errorf("invalid number of steps %d", steps)
+	}
+
+	return ignoreNoChange(m.migrate.Steps(-steps))
+}
+
+// Goto migrates up or down to version.
+func (m migrator) Goto(version int64) error {
+	if version < 0 {
+		return fmt.Errorf("invalid version %d", version)
+	}
+
+	return ignoreNoChange(m.migrate.Migrate(uint(version)))
+}
+
+// Force marks version as applied and clean without running anything, it is
+// how a dirty schema is recovered after fixing it by hand.
+func (m migrator) Force(version int64) error {
+	return m.migrate.Force(int(version))
+}
+
+func (m migrator) Status() (MigrationStatus, error) {
+	version, dirty, err := m.migrate.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return MigrationStatus{}, err
+	}
+
+	status := MigrationStatus{
+		Version:  int64(version),
+		Dirty:    dirty,
+		Expected: SchemaVersion,
+	}
+	for _, v := range migrationVersions() {
+		if v > status.Version {
+			status.Pending++
+		}
+	}
+
+	return status, nil
+}
+
+func (m migrator) Close() error {
+	sourceErr, databaseErr := m.migrate.Close()
+	if sourceErr != nil {
+		return sourceErr
+	}
+
+	return databaseErr
+}
+
+func ignoreNoChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+
+	return err
+}
+
+type migrateLogger struct {
+	logger zerolog.Logger
+}
+
+func (l migrateLogger) Printf(format string, v ...interface{}) {
+	l.logger.Info().Timestamp().Msg(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (l migrateLogger) Verbose() bool {
+	return false
+}
@@ -0,0 +1,197 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+	"xm/internal/repositories/entities"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var eventTypes = map[string]string{
+	entities.ActionCreate:  entities.EventCompanyCreated,
+	entities.ActionUpdate:  entities.EventCompanyUpdated,
+	entities.ActionRestore: entities.EventCompanyUpdated,
+	entities.ActionDelete:  entities.EventCompanyDeleted,
+	entities.ActionPurge:   entities.EventCompanyDeleted,
+}
+
+type outboxRow struct {
+	Id            int64     `db:"id"`
+	CompanyId     int       `db:"company_id"`
+	Version       int       `db:"version"`
+	EventType     string    `db:"event_type"`
+	SchemaVersion int       `db:"schema_version"`
+	Actor         string    `db:"actor"`
+	RequestId     string    `db:"request_id"`
+	Company       []byte    `db:"company"`
+	CreatedAt     time.Time `db:"created_at"`
+	Attempts      int       `db:"attempts"`
+}
+
+const outboxColumns = `id, company_id, version, event_type, schema_version, actor, request_id, company, created_at, attempts`
+
+// eventSQL renders an outbox row of the events relation the same way
+// json.Marshal renders entities.CompanyEvent.
+const eventSQL = `jsonb_build_object('id', e.id, 'type', e.event_type, 'schema_version', e.schema_version,
+	'company_id', e.company_id, 'version', e.version, 'actor', e.actor, 'request_id', e.request_id,
+	'occurred_at', e.created_at, 'company', e.company)`
+
+// newOutboxRow turns a history record into the event published for it, the
+// event takes the ID of the record so every channel reports the same ID.
+// Purging a soft deleted company publishes nothing, consumers were told
+// about the delete already.
+func newOutboxRow(row historyRow, before *entities.Company) (outboxRow, bool) {
+	company := row.After
+	if row.Action == entities.ActionPurge {
+		if before == nil || before.DeletedAt != nil {
+			return outboxRow{}, false
+		}
+		company = row.Before
+	}
+
+	return outboxRow{
+		Id:            row.Id,
+		CompanyId:     row.CompanyId,
+		Version:       row.Version,
+		EventType:     eventTypes[row.Action],
+		SchemaVersion: entities.EventSchemaVersion,
+		Actor:         row.Actor,
+		RequestId:     row.RequestId,
+		Company:       company,
+	}, true
+}
+
+// writeOutbox stores the events in the transaction of the change, the
+// dispatcher publishes them once it commits. Without a dispatcher nothing
+// would ever remove them, so unless publish is set the events are only
+// fanned out to the webhooks and streams.
+func writeOutbox(ctx context.Context, tx *sqlx.Tx, rows []outboxRow, publish bool) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var ids, companyIds, versions pq.Int64Array
+	var eventTypes, companies pq.StringArray
+	for _, row := range rows {
+		ids = append(ids, row.Id)
+		companyIds = append(companyIds, int64(row.CompanyId))
+		versions = append(versions, int64(row.Version))
+		eventTypes = append(eventTypes, row.EventType)
+		companies = append(companies, string(row.Company))
+	}
+
+	span := "INSERT company_outbox"
+	events := `INSERT INTO company_outbox
+		(id, company_id, version, event_type, schema_version, actor, request_id, company)
+		SELECT u.id, u.company_id, u.version, u.event_type, $6, $7, $8, u.company::jsonb
+		FROM unnest($1::bigint[], $2::int[], $3::int[], $4::text[], $5::text[])
+			AS u (id, company_id, version, event_type, company)
+		RETURNING ` + outboxColumns
+	if !publish {
+		span = "SELECT company events"
+		events = `SELECT u.id, u.company_id, u.version, u.event_type, $6::int AS schema_version,
+			$7::text AS actor, $8::text AS request_id, u.company::jsonb AS company, now() AS created_at
+		FROM unnest($1::bigint[], $2::int[], $3::int[], $4::text[], $5::text[])
+			AS u (id, company_id, version, event_type, company)`
+	}
+
+	// The events are also fanned out to the webhooks subscribed to them, each
+	// delivery is retried on its own, and the listening streams are told
+	// which transaction to read once it commits.
+	err := traced(ctx, span, func(ctx context.Context) error {
+		_, err := tx.ExecContext(ctx, `WITH events AS (`+events+`
+			), deliveries AS (
+				INSERT INTO webhook_delivery (subscription_id, event_id, company_id, event)
+				SELECT s.id, e.id, e.company_id, `+eventSQL+`
+				FROM events AS e JOIN webhook_subscription AS s ON s.enabled AND e.event_type = ANY(s.event_types)
+				ORDER BY e.id, s.id
+			)
+			SELECT pg_notify('`+ChangesChannel+`', txid_current()::text)`,
+			ids, companyIds, versions, eventTypes, companies, entities.EventSchemaVersion, rows[0].Actor, rows[0].RequestId)
+		return err
+	})
+
+	return mapError(ctx, err)
+}
+
+// ClaimEvents leases up to limit events that are due for publishing, oldest
+// first. Only the oldest pending event of a company is claimed, so events of
+// one company are published in order even by concurrent dispatchers; a
+// leased event that is neither acknowledged nor retried becomes due again
+// when the lease ends.
+func (r companyRepository) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]entities.CompanyEvent, error) {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	rows := []outboxRow{}
+	err := traced(ctx, "UPDATE company_outbox claim", func(ctx context.Context) error {
+		return r.db.SelectContext(ctx, &rows, `UPDATE company_outbox
+			SET attempts = attempts + 1, next_attempt_at = now() + $2 * interval '1 second'
+			WHERE id IN (
+				SELECT p.id FROM company_outbox AS p
+				WHERE p.next_attempt_at <= now() AND NOT EXISTS (
+					SELECT 1 FROM company_outbox AS e WHERE e.company_id = p.company_id AND e.id < p.id)
+				ORDER BY p.id LIMIT $1 FOR UPDATE SKIP LOCKED)
+			RETURNING `+outboxColumns, limit, lease.Seconds())
+	})
+	if err != nil {
+		return nil, mapError(ctx, err)
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Id < rows[j].Id })
+
+	events := make([]entities.CompanyEvent, 0, len(rows))
+	for _, row := range rows {
+		event := entities.CompanyEvent{
+			Id:            row.Id,
+			Type:          row.EventType,
+			SchemaVersion: row.SchemaVersion,
+			CompanyId:     row.CompanyId,
+			Version:       row.Version,
+			Actor:         row.Actor,
+			RequestId:     row.RequestId,
+			OccurredAt:    row.CreatedAt,
+			Attempts:      row.Attempts,
+		}
+		err = json.Unmarshal(row.Company, &event.Company)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// AckEvent removes a published event, the company history keeps the change.
+func (r companyRepository) AckEvent(ctx context.Context, id int64) error {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	err := traced(ctx, "DELETE company_outbox", func(ctx context.Context) error {
+		_, err := r.db.ExecContext(ctx, `DELETE FROM company_outbox WHERE id = $1`, id)
+		return err
+	})
+
+	return mapError(ctx, err)
+}
+
+// RetryEvent makes a failed event due again after delay, the later events of
+// its company wait for it.
+func (r companyRepository) RetryEvent(ctx context.Context, id int64, delay time.Duration, cause string) error {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	err := traced(ctx, "UPDATE company_outbox retry", func(ctx context.Context) error {
+		_, err := r.db.ExecContext(ctx, `UPDATE company_outbox
+			SET next_attempt_at = now() + $2 * interval '1 second', last_error = $3
+			WHERE id = $1`, id, delay.Seconds(), cause)
+		return err
+	})
+
+	return mapError(ctx, err)
+}
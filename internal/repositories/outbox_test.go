@@ -0,0 +1,100 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var outboxColumns = []string{"id", "company_id", "version", "event_type", "schema_version", "actor", "request_id", "company", "created_at", "attempts"}
+
+func TestClaimEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repository := repositories.NewCompanyRepository(sqlx.NewDb(db, "postgres"), config.Postgres{}, true)
+
+	createdAt := time.Date(2023, 2, 16, 10, 12, 0, 0, time.UTC)
+	mock.ExpectQuery(`UPDATE company_outbox\s+SET attempts = attempts \+ 1, next_attempt_at = .+ FOR UPDATE SKIP LOCKED\)\s+RETURNING`).
+		WithArgs(100, 30.0).
+		WillReturnRows(sqlmock.NewRows(outboxColumns).
+			AddRow(9, 2, 4, "CompanyDeleted", 1, "sync", "req-2", []byte(`{"Id":2,"Name":"Beta","Version":4,"DeletedAt":"2023-02-16T10:12:00Z"}`), createdAt, 3).
+			AddRow(7, 1, 1, "CompanyCreated", 1, "sync", "req-1", []byte(`{"Id":1,"Name":"Acme","Version":1}`), createdAt, 1))
+
+	events, err := repository.ClaimEvents(context.Background(), 100, 30*time.Second)
+	require.NoError(t, err)
+
+	require.Len(t, events, 2)
+	assert.Equal(t, entities.CompanyEvent{
+		Id:            7,
+		Type:          entities.EventCompanyCreated,
+		SchemaVersion: 1,
+		CompanyId:     1,
+		Version:       1,
+		Actor:         "sync",
+		RequestId:     "req-1",
+		OccurredAt:    createdAt,
+		Company:       entities.Company{Id: 1, Name: "Acme", Version: 1},
+		Attempts:      1,
+	}, events[0])
+	assert.Equal(t, int64(9), events[1].Id)
+	assert.Equal(t, &createdAt, events[1].Company.DeletedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeCompanyEvent(t *testing.T) {
+	deletedAt := time.Now()
+
+	cases := map[string]struct {
+		deletedAt *time.Time
+		noSink    bool
+		WantEvent bool
+	}{
+		"live company":         {WantEvent: true},
+		"soft deleted company": {deletedAt: &deletedAt},
+		"no sink":              {noSink: true, WantEvent: true},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			repository := repositories.NewCompanyRepository(sqlx.NewDb(db, "postgres"), config.Postgres{}, !tc.noSink)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT .+ FROM company WHERE id = \$1 FOR UPDATE`).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows(companyColumns).AddRow(1, "Acme", "", 10, true, "corporations", 3, tc.deletedAt))
+			mock.ExpectExec(`DELETE FROM company WHERE id = \$1`).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(`INSERT INTO company_history .+ RETURNING id`).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+			// Without a sink the event is only delivered to webhooks and
+			// streams, nothing would remove it from the outbox.
+			query := `INSERT INTO company_outbox`
+			if tc.noSink {
+				query = `WITH events AS \(SELECT u.id, .+ FROM unnest`
+			}
+			if tc.WantEvent {
+				mock.ExpectExec(query).
+					WithArgs(pq.Int64Array{9}, pq.Int64Array{1}, pq.Int64Array{4}, pq.StringArray{"CompanyDeleted"}, sqlmock.AnyArg(), 1, "", "").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+			mock.ExpectCommit()
+
+			require.NoError(t, repository.PurgeCompany(context.Background(), 1))
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// SchemaVersion is the newest migration embedded in the binary, the service
+// expects the database to be migrated at least to it.
+var SchemaVersion = func() int64 {
+	versions := migrationVersions()
+	return versions[len(versions)-1]
+}()
+
+// migrationVersions returns the versions of the embedded migrations in
+// ascending order.
+func migrationVersions() []int64 {
+	names, err := fs.Glob(migrationFiles, "migrations/*.up.sql")
+	if err != nil {
+		panic(err)
+	}
+
+	versions := make([]int64, 0, len(names))
+	for _, name := range names {
+		migration, err := source.Parse(name[len("migrations/"):])
+		if err != nil {
+			panic(fmt.Sprintf("migration %s: %v", name, err))
+		}
+		versions = append(versions, int64(migration.Version))
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	return versions
+}
+
+// CheckSchema verifies that the database is migrated at least to
+// SchemaVersion and that the last migration completed. A newer schema is
+// accepted, during a rolling deploy the new release migrates while the old one
+// still serves.
+func CheckSchema(ctx context.Context, db *sqlx.DB) error {
+	var version int64
+	var dirty bool
+
+	err := db.QueryRowxContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	switch {
+	case dirty:
+		return fmt.Errorf("schema version %d is dirty", version)
+	case version < SchemaVersion:
+		return fmt.Errorf("schema version %d is behind %d", version, SchemaVersion)
+	}
+
+	return nil
+}
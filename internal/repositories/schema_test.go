@@ -0,0 +1,84 @@
+package repositories_test
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"xm/internal/repositories"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSchema(t *testing.T) {
+	cases := map[string]struct {
+		Version int64
+		Dirty   bool
+		WantErr bool
+	}{
+		"current": {
+			Version: repositories.SchemaVersion,
+		},
+		"behind": {
+			Version: 20230131055146,
+			WantErr: true,
+		},
+		"ahead": {
+			Version: repositories.SchemaVersion + 1,
+		},
+		"dirty": {
+			Version: repositories.SchemaVersion,
+			Dirty:   true,
+			WantErr: true,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+				WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(tc.Version, tc.Dirty))
+
+			err = repositories.CheckSchema(context.Background(), sqlx.NewDb(db, "postgres"))
+			if tc.WantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestMigrationFiles(t *testing.T) {
+	entries, err := os.ReadDir("migrations")
+	require.NoError(t, err)
+
+	files := map[string]bool{}
+	for _, entry := range entries {
+		files[entry.Name()] = true
+	}
+
+	var newest int64
+	for name := range files {
+		if !strings.HasSuffix(name, ".up.sql") {
+			continue
+		}
+
+		assert.True(t, files[strings.TrimSuffix(name, ".up.sql")+".down.sql"], "%s has no down migration", name)
+
+		version, err := strconv.ParseInt(name[:strings.Index(name, "_")], 10, 64)
+		require.NoError(t, err)
+		if version > newest {
+			newest = version
+		}
+	}
+
+	assert.Equal(t, newest, repositories.SchemaVersion)
+}
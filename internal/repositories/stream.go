@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"xm/internal/repositories/entities"
+)
+
+// ChangesChannel is notified with the transaction ID of every committed
+// transaction that changed companies.
+const ChangesChannel = "company_changes"
+
+// ListChangeEvents returns the events of the changes a transaction made, in
+// the order they were made. The event ID is the ID of the history record,
+// which is also the ID the outbox and the webhooks publish the event under.
+func (r companyRepository) ListChangeEvents(ctx context.Context, xactId int64) ([]entities.CompanyEvent, error) {
+	ctx, cancel := withTimeout(ctx, r.readTimeout)
+	defer cancel()
+
+	rows := []historyRow{}
+	err := traced(ctx, "SELECT company_history changes", func(ctx context.Context) error {
+		return r.db.SelectContext(ctx, &rows, `SELECT `+historyColumns+` FROM company_history
+			WHERE xact_id = $1 ORDER BY id`, xactId)
+	})
+	if err != nil {
+		return nil, mapError(ctx, err)
+	}
+
+	events := make([]entities.CompanyEvent, 0, len(rows))
+	for _, row := range rows {
+		var before *entities.Company
+		if len(row.Before) > 0 {
+			before = &entities.Company{}
+			err = json.Unmarshal(row.Before, before)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		outbox, ok := newOutboxRow(row, before)
+		if !ok {
+			continue
+		}
+
+		event := entities.CompanyEvent{
+			Id:            row.Id,
+			Type:          outbox.EventType,
+			SchemaVersion: outbox.SchemaVersion,
+			CompanyId:     row.CompanyId,
+			Version:       row.Version,
+			Actor:         row.Actor,
+			RequestId:     row.RequestId,
+			OccurredAt:    row.CreatedAt,
+		}
+		err = json.Unmarshal(outbox.Company, &event.Company)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,105 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/handlers/dto"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var historyColumns = []string{"id", "company_id", "version", "action", "actor", "request_id", "before", "after", "changed_fields", "created_at"}
+
+func TestListChangeEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repository := repositories.NewCompanyRepository(sqlx.NewDb(db, "postgres"), config.Postgres{}, true)
+
+	createdAt := time.Date(2023, 2, 22, 9, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT .+ FROM company_history\s+WHERE xact_id = \$1 ORDER BY id`).
+		WithArgs(int64(812)).
+		WillReturnRows(sqlmock.NewRows(historyColumns).
+			AddRow(11, 1, 1, entities.ActionCreate, "sync", "req-1", nil, []byte(`{"Id":1,"Name":"Acme","Version":1}`), "{name}", createdAt).
+			AddRow(12, 2, 5, entities.ActionPurge, "sync", "req-1", []byte(`{"Id":2,"Name":"Beta","Version":4,"DeletedAt":"2023-02-20T10:00:00Z"}`), nil, "{deleted_at}", createdAt).
+			AddRow(13, 3, 3, entities.ActionPurge, "sync", "req-1", []byte(`{"Id":3,"Name":"Gamma","Version":2}`), nil, "{name}", createdAt))
+
+	events, err := repository.ListChangeEvents(context.Background(), 812)
+	require.NoError(t, err)
+
+	// Purging the soft deleted company was announced by its delete already.
+	require.Len(t, events, 2)
+	assert.Equal(t, entities.CompanyEvent{
+		Id:            11,
+		Type:          entities.EventCompanyCreated,
+		SchemaVersion: entities.EventSchemaVersion,
+		CompanyId:     1,
+		Version:       1,
+		Actor:         "sync",
+		RequestId:     "req-1",
+		OccurredAt:    createdAt,
+		Company:       entities.Company{Id: 1, Name: "Acme", Version: 1},
+	}, events[0])
+	assert.Equal(t, entities.EventCompanyDeleted, events[1].Type)
+	assert.Equal(t, "Gamma", events[1].Company.Name)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// captureArg matches any argument and keeps it.
+type captureArg struct {
+	value driver.Value
+}
+
+func (a *captureArg) Match(v driver.Value) bool {
+	a.value = v
+	return true
+}
+
+func TestChangeEventIdMatchesOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repository := repositories.NewCompanyRepository(sqlx.NewDb(db, "postgres"), config.Postgres{}, true)
+
+	createdAt := time.Date(2023, 2, 24, 9, 0, 0, 0, time.UTC)
+	after := []byte(`{"Id":1,"Name":"Acme","Version":1}`)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO company \(name, description, employees_amount, registered, type\)`).
+		WillReturnRows(sqlmock.NewRows(companyColumns).AddRow(1, "Acme", "", 10, true, "corporations", 1, nil))
+	mock.ExpectQuery(`INSERT INTO company_history .+ RETURNING id`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(31))
+	ids := &captureArg{}
+	mock.ExpectExec(`INSERT INTO company_outbox`).
+		WithArgs(ids, pq.Int64Array{1}, pq.Int64Array{1}, pq.StringArray{"CompanyCreated"}, sqlmock.AnyArg(), 1, "", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT .+ FROM company_history\s+WHERE xact_id = \$1 ORDER BY id`).
+		WithArgs(int64(900)).
+		WillReturnRows(sqlmock.NewRows(historyColumns).
+			AddRow(31, 1, 1, entities.ActionCreate, "", "", nil, after, "{name}", createdAt))
+
+	_, err = repository.CreateCompany(context.Background(), dto.Company{Name: "Acme", EmployeesAmount: 10, Registered: true, Type: "corporations"})
+	require.NoError(t, err)
+
+	events, err := repository.ListChangeEvents(context.Background(), 900)
+	require.NoError(t, err)
+
+	// Streams, the outbox and the webhooks fed from it report one change
+	// under one ID, so consumers of several channels can deduplicate.
+	require.Len(t, events, 1)
+	assert.Equal(t, "{31}", ids.value)
+	assert.Equal(t, int64(31), events[0].Id)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
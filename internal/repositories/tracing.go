@@ -0,0 +1,28 @@
+package repositories
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("xm/internal/repositories")
+
+// traced runs one SQL statement in a child span named after it, so a slow
+// repository call shows which round-trip took the time.
+func traced(ctx context.Context, statement string, fn func(ctx context.Context) error) error {
+	ctx, span := tracer.Start(ctx, statement, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation(statement)))
+	defer span.End()
+
+	err := fn(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
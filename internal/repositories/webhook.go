@@ -0,0 +1,358 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+	"xm/config"
+	"xm/internal/handlers/dto"
+	"xm/internal/repositories/entities"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const webhookColumns = `id, url, secret, event_types, owner, enabled, consecutive_failures, disabled_at, created_at`
+
+const deliveryColumns = `d.id, d.subscription_id, d.event, d.status, d.attempts, d.last_status_code, d.last_error,
+	d.next_attempt_at, d.created_at, d.finished_at`
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+type webhookRow struct {
+	Id                  int64          `db:"id"`
+	URL                 string         `db:"url"`
+	Secret              string         `db:"secret"`
+	EventTypes          pq.StringArray `db:"event_types"`
+	Owner               string         `db:"owner"`
+	Enabled             bool           `db:"enabled"`
+	ConsecutiveFailures int            `db:"consecutive_failures"`
+	DisabledAt          *time.Time     `db:"disabled_at"`
+	CreatedAt           time.Time      `db:"created_at"`
+}
+
+func (row webhookRow) entity() entities.Webhook {
+	return entities.Webhook{
+		Id:                  row.Id,
+		URL:                 row.URL,
+		Secret:              row.Secret,
+		EventTypes:          row.EventTypes,
+		Owner:               row.Owner,
+		Enabled:             row.Enabled,
+		ConsecutiveFailures: row.ConsecutiveFailures,
+		DisabledAt:          row.DisabledAt,
+		CreatedAt:           row.CreatedAt,
+	}
+}
+
+type deliveryRow struct {
+	Id             int64      `db:"id"`
+	SubscriptionId int64      `db:"subscription_id"`
+	Event          []byte     `db:"event"`
+	Status         string     `db:"status"`
+	Attempts       int        `db:"attempts"`
+	LastStatusCode int        `db:"last_status_code"`
+	LastError      string     `db:"last_error"`
+	NextAttemptAt  time.Time  `db:"next_attempt_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+	FinishedAt     *time.Time `db:"finished_at"`
+	URL            string     `db:"url"`
+	Secret         string     `db:"secret"`
+}
+
+func (row deliveryRow) entity() (entities.WebhookDelivery, error) {
+	delivery := entities.WebhookDelivery{
+		Id:             row.Id,
+		WebhookId:      row.SubscriptionId,
+		Status:         row.Status,
+		Attempts:       row.Attempts,
+		LastStatusCode: row.LastStatusCode,
+		LastError:      row.LastError,
+		NextAttemptAt:  row.NextAttemptAt,
+		CreatedAt:      row.CreatedAt,
+		FinishedAt:     row.FinishedAt,
+		URL:            row.URL,
+		Secret:         row.Secret,
+	}
+
+	err := json.Unmarshal(row.Event, &delivery.Event)
+
+	return delivery, err
+}
+
+// webhookRepository stores the webhook subscriptions and the deliveries the
+// outbox fans out to them.
+type webhookRepository struct {
+	db           *sqlx.DB
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+func NewWebhookRepository(db *sqlx.DB, cfg config.Postgres) webhookRepository {
+	return webhookRepository{
+		db:           db,
+		readTimeout:  cfg.ReadTimeout,
+		writeTimeout: cfg.WriteTimeout,
+	}
+}
+
+func (r webhookRepository) CreateWebhook(ctx context.Context, w dto.Webhook, owner string) (entities.Webhook, error) {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	row := webhookRow{}
+	err := traced(ctx, "INSERT webhook_subscription", func(ctx context.Context) error {
+		return r.db.GetContext(ctx, &row, `INSERT INTO webhook_subscription (url, secret, event_types, owner)
+			VALUES ($1, $2, $3, $4) RETURNING `+webhookColumns, w.URL, w.Secret, pq.StringArray(w.EventTypes), owner)
+	})
+	if err != nil {
+		return entities.Webhook{}, mapError(ctx, err)
+	}
+
+	return row.entity(), nil
+}
+
+// ListWebhooks returns the webhooks of owner, an empty owner lists all of them.
+func (r webhookRepository) ListWebhooks(ctx context.Context, owner string) ([]entities.Webhook, error) {
+	ctx, cancel := withTimeout(ctx, r.readTimeout)
+	defer cancel()
+
+	rows := []webhookRow{}
+	err := traced(ctx, "SELECT webhook_subscription", func(ctx context.Context) error {
+		return r.db.SelectContext(ctx, &rows, `SELECT `+webhookColumns+` FROM webhook_subscription
+			WHERE $1 = '' OR owner = $1 ORDER BY id`, owner)
+	})
+	if err != nil {
+		return nil, mapError(ctx, err)
+	}
+
+	webhooks := make([]entities.Webhook, 0, len(rows))
+	for _, row := range rows {
+		webhooks = append(webhooks, row.entity())
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhook returns the webhook if it belongs to owner, an empty owner
+// matches every webhook.
+func (r webhookRepository) GetWebhook(ctx context.Context, id int64, owner string) (entities.Webhook, error) {
+	ctx, cancel := withTimeout(ctx, r.readTimeout)
+	defer cancel()
+
+	row := webhookRow{}
+	err := traced(ctx, "SELECT webhook_subscription", func(ctx context.Context) error {
+		return r.db.GetContext(ctx, &row, `SELECT `+webhookColumns+` FROM webhook_subscription
+			WHERE id = $1 AND ($2 = '' OR owner = $2)`, id, owner)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return entities.Webhook{}, ErrWebhookNotFound
+	}
+	if err != nil {
+		return entities.Webhook{}, mapError(ctx, err)
+	}
+
+	return row.entity(), nil
+}
+
+// SetWebhookEnabled enables or disables the webhook of owner, an empty owner
+// matches every webhook. Enabling resets its consecutive failures.
+func (r webhookRepository) SetWebhookEnabled(ctx context.Context, id int64, owner string, enabled bool) (entities.Webhook, error) {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	row := webhookRow{}
+	err := traced(ctx, "UPDATE webhook_subscription enabled", func(ctx context.Context) error {
+		return r.db.GetContext(ctx, &row, `UPDATE webhook_subscription
+			SET enabled = $3,
+				consecutive_failures = CASE WHEN $3 THEN 0 ELSE consecutive_failures END,
+				disabled_at = CASE WHEN $3 THEN NULL WHEN enabled THEN now() ELSE disabled_at END
+			WHERE id = $1 AND ($2 = '' OR owner = $2)
+			RETURNING `+webhookColumns, id, owner, enabled)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return entities.Webhook{}, ErrWebhookNotFound
+	}
+	if err != nil {
+		return entities.Webhook{}, mapError(ctx, err)
+	}
+
+	return row.entity(), nil
+}
+
+// DeleteWebhook removes the webhook of owner with its deliveries, an empty
+// owner matches every webhook.
+func (r webhookRepository) DeleteWebhook(ctx context.Context, id int64, owner string) error {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	var deleted int64
+	err := traced(ctx, "DELETE webhook_subscription", func(ctx context.Context) error {
+		result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_subscription
+			WHERE id = $1 AND ($2 = '' OR owner = $2)`, id, owner)
+		if err != nil {
+			return err
+		}
+		deleted, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return mapError(ctx, err)
+	}
+	if deleted == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// ListDeliveries returns the latest deliveries of a webhook, newest first.
+func (r webhookRepository) ListDeliveries(ctx context.Context, webhookId int64, limit int) ([]entities.WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, r.readTimeout)
+	defer cancel()
+
+	rows := []deliveryRow{}
+	err := traced(ctx, "SELECT webhook_delivery", func(ctx context.Context) error {
+		return r.db.SelectContext(ctx, &rows, `SELECT `+deliveryColumns+` FROM webhook_delivery AS d
+			WHERE d.subscription_id = $1 ORDER BY d.id DESC LIMIT $2`, webhookId, limit)
+	})
+	if err != nil {
+		return nil, mapError(ctx, err)
+	}
+
+	return deliveries(rows)
+}
+
+// ClaimDeliveries leases up to limit pending deliveries of enabled webhooks
+// that are due, oldest first. Only the oldest pending delivery of a company
+// to a webhook is claimed, so every endpoint receives the events of a company
+// in order; a leased delivery without a recorded attempt becomes due again
+// when the lease ends.
+func (r webhookRepository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]entities.WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	rows := []deliveryRow{}
+	err := traced(ctx, "UPDATE webhook_delivery claim", func(ctx context.Context) error {
+		return r.db.SelectContext(ctx, &rows, `UPDATE webhook_delivery AS d
+			SET attempts = d.attempts + 1, next_attempt_at = now() + $2 * interval '1 second'
+			FROM webhook_subscription AS s
+			WHERE s.id = d.subscription_id AND d.id IN (
+				SELECT p.id FROM webhook_delivery AS p
+				JOIN webhook_subscription AS ps ON ps.id = p.subscription_id AND ps.enabled
+				WHERE p.status = 'pending' AND p.next_attempt_at <= now() AND NOT EXISTS (
+					SELECT 1 FROM webhook_delivery AS e WHERE e.subscription_id = p.subscription_id
+					AND e.company_id = p.company_id AND e.status = 'pending' AND e.id < p.id)
+				ORDER BY p.id LIMIT $1 FOR UPDATE OF p SKIP LOCKED)
+			RETURNING `+deliveryColumns+`, s.url, s.secret`, limit, lease.Seconds())
+	})
+	if err != nil {
+		return nil, mapError(ctx, err)
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Id < rows[j].Id })
+
+	return deliveries(rows)
+}
+
+// RecordAttempt stores the attempt and settles its delivery. A successful
+// attempt delivers it and resets the failures of the webhook; a failed one
+// makes it due again after retryIn, and once the webhook failed maxFailures
+// times in a row the webhook is disabled and its pending deliveries fail.
+// RecordAttempt reports whether the webhook was disabled.
+func (r webhookRepository) RecordAttempt(ctx context.Context, webhookId int64, attempt entities.WebhookAttempt, retryIn time.Duration, maxFailures int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	var disabled bool
+	err := inTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		err := traced(ctx, "INSERT webhook_attempt", func(ctx context.Context) error {
+			_, err := tx.ExecContext(ctx, `INSERT INTO webhook_attempt (delivery_id, status_code, error, duration_ms)
+				VALUES ($1, $2, $3, $4)`, attempt.DeliveryId, attempt.StatusCode, attempt.Error,
+				float64(attempt.Duration)/float64(time.Millisecond))
+			return err
+		})
+		if err != nil {
+			return mapError(ctx, err)
+		}
+
+		if attempt.Succeeded() {
+			err = traced(ctx, "UPDATE webhook_delivery delivered", func(ctx context.Context) error {
+				_, err := tx.ExecContext(ctx, `UPDATE webhook_delivery
+					SET status = $2, last_status_code = $3, last_error = '', finished_at = now()
+					WHERE id = $1`, attempt.DeliveryId, entities.DeliveryDelivered, attempt.StatusCode)
+				if err != nil {
+					return err
+				}
+				_, err = tx.ExecContext(ctx, `UPDATE webhook_subscription SET consecutive_failures = 0
+					WHERE id = $1 AND consecutive_failures > 0`, webhookId)
+				return err
+			})
+			return mapError(ctx, err)
+		}
+
+		err = traced(ctx, "UPDATE webhook_delivery retry", func(ctx context.Context) error {
+			_, err := tx.ExecContext(ctx, `UPDATE webhook_delivery
+				SET next_attempt_at = now() + $2 * interval '1 second', last_status_code = $3, last_error = $4
+				WHERE id = $1`, attempt.DeliveryId, retryIn.Seconds(), attempt.StatusCode, attempt.Error)
+			if err != nil {
+				return err
+			}
+
+			var enabled bool
+			err = tx.GetContext(ctx, &enabled, `UPDATE webhook_subscription
+				SET consecutive_failures = consecutive_failures + 1,
+					enabled = enabled AND ($2 <= 0 OR consecutive_failures + 1 < $2),
+					disabled_at = CASE WHEN enabled AND $2 > 0 AND consecutive_failures + 1 >= $2 THEN now() ELSE disabled_at END
+				WHERE id = $1 RETURNING enabled`, webhookId, maxFailures)
+			if err != nil || enabled {
+				return err
+			}
+
+			disabled = true
+			_, err = tx.ExecContext(ctx, `UPDATE webhook_delivery SET status = $2, finished_at = now()
+				WHERE subscription_id = $1 AND status = 'pending'`, webhookId, entities.DeliveryFailed)
+			return err
+		})
+
+		return mapError(ctx, err)
+	})
+
+	return disabled, err
+}
+
+// CleanupDeliveries removes the finished deliveries older than before with
+// their attempts.
+func (r webhookRepository) CleanupDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	var deleted int64
+	err := traced(ctx, "DELETE webhook_delivery", func(ctx context.Context) error {
+		result, err := r.db.ExecContext(ctx, `DELETE FROM webhook_delivery
+			WHERE status <> 'pending' AND finished_at < $1`, before)
+		if err != nil {
+			return err
+		}
+		deleted, err = result.RowsAffected()
+		return err
+	})
+
+	return deleted, mapError(ctx, err)
+}
+
+func deliveries(rows []deliveryRow) ([]entities.WebhookDelivery, error) {
+	deliveries := make([]entities.WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		delivery, err := row.entity()
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,109 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAttempt(t *testing.T) {
+	cases := map[string]struct {
+		attempt      entities.WebhookAttempt
+		enabled      bool
+		WantDisabled bool
+	}{
+		"delivered": {
+			attempt: entities.WebhookAttempt{DeliveryId: 5, StatusCode: 204, Duration: 20 * time.Millisecond},
+		},
+		"retried": {
+			attempt: entities.WebhookAttempt{DeliveryId: 5, StatusCode: 500, Error: "endpoint responded with 500", Duration: 20 * time.Millisecond},
+			enabled: true,
+		},
+		"webhook disabled": {
+			attempt:      entities.WebhookAttempt{DeliveryId: 5, Error: "connection refused", Duration: 20 * time.Millisecond},
+			WantDisabled: true,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			repository := repositories.NewWebhookRepository(sqlx.NewDb(db, "postgres"), config.Postgres{})
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`INSERT INTO webhook_attempt`).
+				WithArgs(int64(5), tc.attempt.StatusCode, tc.attempt.Error, 20.0).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			if tc.attempt.Succeeded() {
+				mock.ExpectExec(`UPDATE webhook_delivery\s+SET status = \$2`).
+					WithArgs(int64(5), entities.DeliveryDelivered, 204).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`UPDATE webhook_subscription SET consecutive_failures = 0`).
+					WithArgs(int64(2)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			} else {
+				mock.ExpectExec(`UPDATE webhook_delivery\s+SET next_attempt_at`).
+					WithArgs(int64(5), 60.0, tc.attempt.StatusCode, tc.attempt.Error).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`UPDATE webhook_subscription\s+SET consecutive_failures = consecutive_failures \+ 1`).
+					WithArgs(int64(2), 20).
+					WillReturnRows(sqlmock.NewRows([]string{"enabled"}).AddRow(tc.enabled))
+				if tc.WantDisabled {
+					mock.ExpectExec(`UPDATE webhook_delivery SET status = \$2, finished_at = now\(\)\s+WHERE subscription_id = \$1 AND status = 'pending'`).
+						WithArgs(int64(2), entities.DeliveryFailed).
+						WillReturnResult(sqlmock.NewResult(0, 3))
+				}
+			}
+			mock.ExpectCommit()
+
+			disabled, err := repository.RecordAttempt(context.Background(), 2, tc.attempt, time.Minute, 20)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.WantDisabled, disabled)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetWebhookNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repository := repositories.NewWebhookRepository(sqlx.NewDb(db, "postgres"), config.Postgres{})
+
+	mock.ExpectQuery(`SELECT .+ FROM webhook_subscription\s+WHERE id = \$1 AND \(\$2 = '' OR owner = \$2\)`).
+		WithArgs(int64(1), "user-2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err = repository.GetWebhook(context.Background(), 1, "user-2")
+	assert.ErrorIs(t, err, repositories.ErrWebhookNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetWebhookEnabledNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repository := repositories.NewWebhookRepository(sqlx.NewDb(db, "postgres"), config.Postgres{})
+
+	mock.ExpectQuery(`UPDATE webhook_subscription SET enabled = \$3`).
+		WithArgs(int64(1), "user-2", true).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err = repository.SetWebhookEnabled(context.Background(), 1, "user-2", true)
+	assert.ErrorIs(t, err, repositories.ErrWebhookNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,83 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"xm/internal/handlers"
+	"xm/internal/handlers/problem"
+	"xm/internal/logging"
+	"xm/internal/repositories"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusCodes translates the HTTP statuses the REST API answers repository
+// errors with.
+var statusCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusGone:                codes.NotFound,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusPreconditionFailed:  codes.FailedPrecondition,
+	http.StatusUnprocessableEntity: codes.InvalidArgument,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+}
+
+// repositoryStatus reports a repository error with the code matching the
+// status of the REST API and logs it at the same level.
+func repositoryStatus(ctx context.Context, logger zerolog.Logger, err error) error {
+	log := logging.FromContext(ctx, logger)
+
+	if errors.Is(err, repositories.ErrCanceled) {
+		log.Info().Timestamp().Msg(err.Error())
+		return status.Error(codes.Canceled, "request canceled")
+	}
+
+	httpStatus, _, detail := handlers.RepositoryError(err)
+	code, ok := statusCodes[httpStatus]
+	if !ok {
+		code = codes.Internal
+	}
+
+	if httpStatus >= http.StatusInternalServerError {
+		log.Error().Timestamp().Msg(err.Error())
+	} else {
+		log.Warn().Timestamp().Msg(err.Error())
+	}
+
+	return status.Error(code, detail)
+}
+
+// invalidArgument reports a request that failed validation, the failed rules
+// are attached as field violations.
+func invalidArgument(ctx context.Context, logger zerolog.Logger, detail string, err error) error {
+	logging.FromContext(ctx, logger).Warn().Timestamp().Msg(err.Error())
+
+	st := status.New(codes.InvalidArgument, detail)
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, fe := range problem.FieldErrors(err) {
+		description := fe.Rule
+		if fe.Param != "" {
+			description += "=" + fe.Param
+		}
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       fe.Field,
+			Description: description,
+		})
+	}
+	if len(violations) == 0 {
+		return st.Err()
+	}
+
+	withDetails, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
@@ -0,0 +1,187 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+	"xm/internal/auth"
+	"xm/internal/logging"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// metadataRequestID is the lower case X-Request-ID header, gRPC metadata keys
+// are lower case.
+const metadataRequestID = "x-request-id"
+
+// methodScopes is the scope every method requires, the same as its REST
+// route.
+var methodScopes = map[string]string{
+	"/company.v1.CompanyService/Get":      auth.ScopeRead,
+	"/company.v1.CompanyService/List":     auth.ScopeRead,
+	"/company.v1.CompanyService/BatchGet": auth.ScopeRead,
+	"/company.v1.CompanyService/Watch":    auth.ScopeRead,
+	"/company.v1.CompanyService/Create":   auth.ScopeWrite,
+	"/company.v1.CompanyService/Update":   auth.ScopeWrite,
+	"/company.v1.CompanyService/Delete":   auth.ScopeDelete,
+}
+
+type verifier interface {
+	Verify(token string) (auth.Principal, error)
+}
+
+// interceptor does for every call what the REST middleware chain does for a
+// request: it assigns the request ID, authenticates the bearer token of the
+// authorization metadata, checks the scope of the method and writes one
+// access log line.
+type interceptor struct {
+	verifier      verifier
+	anonymousRead bool
+	logger        zerolog.Logger
+}
+
+func newInterceptor(verifier verifier, anonymousRead bool, logger zerolog.Logger) interceptor {
+	return interceptor{
+		verifier:      verifier,
+		anonymousRead: anonymousRead,
+		logger:        logger,
+	}
+}
+
+func (i interceptor) Unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, done := i.start(ctx, info.FullMethod)
+
+	var resp interface{}
+	ctx, err := i.authorize(ctx, info.FullMethod)
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+	done(err)
+
+	return resp, err
+}
+
+func (i interceptor) Stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, done := i.start(ss.Context(), info.FullMethod)
+
+	ctx, err := i.authorize(ctx, info.FullMethod)
+	if err == nil {
+		err = handler(srv, serverStream{ServerStream: ss, ctx: ctx})
+	}
+	done(err)
+
+	return err
+}
+
+// start attaches the request ID and a logger carrying it to the context, done
+// writes the access log line.
+func (i interceptor) start(ctx context.Context, method string) (context.Context, func(err error)) {
+	start := time.Now()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var id string
+	if values := md.Get(metadataRequestID); len(values) > 0 {
+		id = values[0]
+	}
+	ctx, id = logging.WithRequestID(ctx, id)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(metadataRequestID, id))
+
+	ctx = i.logger.With().
+		Ctx(ctx).
+		Str("request_id", middleware.GetReqID(ctx)).
+		Logger().
+		WithContext(ctx)
+	requestLogger := zerolog.Ctx(ctx)
+
+	return ctx, func(err error) {
+		code := status.Code(err)
+
+		var event *zerolog.Event
+		switch code {
+		case codes.OK:
+			event = requestLogger.Info()
+		case codes.Internal, codes.Unavailable, codes.Unknown, codes.DataLoss, codes.Unimplemented, codes.DeadlineExceeded:
+			event = requestLogger.Error()
+		default:
+			event = requestLogger.Warn()
+		}
+
+		var remoteIP string
+		if p, ok := peer.FromContext(ctx); ok {
+			var err error
+			remoteIP, _, err = net.SplitHostPort(p.Addr.String())
+			if err != nil {
+				remoteIP = p.Addr.String()
+			}
+		}
+
+		event.Timestamp().
+			Str("method", method).
+			Str("code", code.String()).
+			Float64("duration_ms", float64(time.Since(start).Microseconds())/1000).
+			Str("remote_ip", remoteIP).
+			Msg("rpc")
+	}
+}
+
+func (i interceptor) authorize(ctx context.Context, method string) (context.Context, error) {
+	scope, ok := methodScopes[method]
+	if !ok {
+		return ctx, status.Error(codes.Unimplemented, "unknown method")
+	}
+
+	token := bearerToken(ctx)
+	if token == "" && i.anonymousRead && scope == auth.ScopeRead {
+		return ctx, nil
+	}
+
+	principal, err := i.verifier.Verify(token)
+	if err != nil {
+		logging.FromContext(ctx, i.logger).Warn().Timestamp().Msg(err.Error())
+		return ctx, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	logging.FromContext(ctx, i.logger).UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("subject", principal.Subject)
+	})
+
+	if !principal.HasScope(scope) {
+		logging.FromContext(ctx, i.logger).Warn().Timestamp().Msg("missing scope " + scope)
+		return ctx, status.Error(codes.PermissionDenied, "missing scope "+scope)
+	}
+
+	return auth.WithPrincipal(ctx, principal), nil
+}
+
+// bearerToken reads the token of the authorization metadata, which carries
+// "Bearer <token>" like the HTTP header.
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+
+	if len(values[0]) > 7 && strings.EqualFold(values[0][:7], "bearer ") {
+		return strings.TrimSpace(values[0][7:])
+	}
+
+	return ""
+}
+
+// serverStream replaces the context of a stream with the authorized one.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context {
+	return s.ctx
+}
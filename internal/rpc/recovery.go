@@ -0,0 +1,44 @@
+package rpc
+
+import (
+	"context"
+	"runtime/debug"
+	"xm/internal/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RecoverUnary turns a panic of a method into codes.Internal. Without it a
+// single panicking call would take the whole process down, net/http recovers
+// REST handlers the same way.
+func (i interceptor) RecoverUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = i.recovered(ctx, p)
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+func (i interceptor) RecoverStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = i.recovered(ss.Context(), p)
+		}
+	}()
+
+	return handler(srv, ss)
+}
+
+// recovered logs the panic with its stack.
+func (i interceptor) recovered(ctx context.Context, p interface{}) error {
+	logging.FromContext(ctx, i.logger).Error().Timestamp().
+		Interface("panic", p).
+		Str("stack", string(debug.Stack())).
+		Msg("panic")
+
+	return status.Error(codes.Internal, "internal error")
+}
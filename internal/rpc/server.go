@@ -0,0 +1,345 @@
+// Package rpc serves the CompanyService gRPC API next to the REST handlers.
+// It shares their repository, validation rules, authentication and error
+// mapping, so both APIs behave the same.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	companyv1 "xm/api/company/v1"
+	"xm/config"
+	"xm/internal/handlers/dto"
+	"xm/internal/logging"
+	"xm/internal/metrics"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+	"xm/internal/stream"
+	"xm/internal/tracing"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultListLimit = 20
+	maxBatchGetIds   = 100
+)
+
+// errEventsMissed ends a watch whose client has to reload its state, like the
+// reset event of the REST stream.
+var errEventsMissed = status.Error(codes.Aborted, "events may have been missed, reload the companies and watch again")
+
+type companyRepository interface {
+	GetCompany(ctx context.Context, id int) (entities.Company, error)
+	GetCompanies(ctx context.Context, ids []int) ([]entities.Company, error)
+	CreateCompany(ctx context.Context, company dto.Company) (entities.Company, error)
+	DeleteCompany(ctx context.Context, id int, version int) error
+	UpdateCompany(ctx context.Context, id int, version int, company dto.Company) (entities.Company, error)
+	ListCompanies(ctx context.Context, filter dto.CompanyFilter) ([]entities.Company, string, error)
+}
+
+type companyStream interface {
+	Subscribe(lastEventId int64, resume bool) (*stream.Subscription, []entities.CompanyEvent, bool)
+	Unsubscribe(s *stream.Subscription)
+}
+
+type companyServer struct {
+	companyv1.UnimplementedCompanyServiceServer
+	companyRepository companyRepository
+	stream            companyStream
+	requireIfMatch    bool
+	logger            zerolog.Logger
+}
+
+func NewCompanyServer(companyRepository companyRepository, stream companyStream, logger zerolog.Logger, cfg config.Configuration) companyServer {
+	return companyServer{
+		companyRepository: companyRepository,
+		stream:            stream,
+		requireIfMatch:    cfg.RequireIfMatch,
+		logger:            logger,
+	}
+}
+
+// NewServer returns a gRPC server with the company service registered behind
+// the same chain as the REST routes: tracing, metrics, the request ID, access
+// log and authentication interceptors, and panic recovery.
+func NewServer(companyServer companyv1.CompanyServiceServer, verifier verifier, logger zerolog.Logger, cfg config.Configuration) *grpc.Server {
+	interceptor := newInterceptor(verifier, cfg.Auth.AnonymousRead, logger)
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(tracing.UnaryInterceptor(), metrics.UnaryInterceptor, interceptor.Unary, interceptor.RecoverUnary),
+		grpc.ChainStreamInterceptor(tracing.StreamInterceptor(), metrics.StreamInterceptor, interceptor.Stream, interceptor.RecoverStream),
+	)
+	companyv1.RegisterCompanyServiceServer(server, companyServer)
+
+	return server
+}
+
+func (s companyServer) Get(ctx context.Context, req *companyv1.GetCompanyRequest) (*companyv1.Company, error) {
+	company, err := s.companyRepository.GetCompany(ctx, int(req.GetId()))
+	if err != nil {
+		return nil, repositoryStatus(ctx, s.logger, err)
+	}
+
+	return companyToProto(company), nil
+}
+
+func (s companyServer) List(ctx context.Context, req *companyv1.ListCompaniesRequest) (*companyv1.ListCompaniesResponse, error) {
+	filter := listFilter(req)
+
+	err := dto.Validator.Struct(filter)
+	if err != nil {
+		return nil, invalidArgument(ctx, s.logger, "invalid company list parameters", err)
+	}
+
+	companies, next, err := s.companyRepository.ListCompanies(ctx, filter)
+	if errors.Is(err, repositories.ErrInvalidCursor) {
+		return nil, invalidArgument(ctx, s.logger, "invalid company list parameters", err)
+	}
+	if err != nil {
+		return nil, repositoryStatus(ctx, s.logger, err)
+	}
+
+	resp := &companyv1.ListCompaniesResponse{NextCursor: next}
+	for _, company := range companies {
+		resp.Companies = append(resp.Companies, companyToProto(company))
+	}
+
+	return resp, nil
+}
+
+func (s companyServer) Create(ctx context.Context, req *companyv1.CreateCompanyRequest) (*companyv1.Company, error) {
+	body := companyFromProto(req.GetCompany())
+
+	err := dto.Validator.Struct(body)
+	if err != nil {
+		return nil, invalidArgument(ctx, s.logger, "invalid company", err)
+	}
+
+	company, err := s.companyRepository.CreateCompany(ctx, body)
+	if err != nil {
+		return nil, repositoryStatus(ctx, s.logger, err)
+	}
+
+	return companyToProto(company), nil
+}
+
+func (s companyServer) Update(ctx context.Context, req *companyv1.UpdateCompanyRequest) (*companyv1.Company, error) {
+	err := s.checkVersion(ctx, req.GetVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	body := companyFromProto(req.GetCompany())
+
+	err = dto.Validator.Struct(body)
+	if err != nil {
+		return nil, invalidArgument(ctx, s.logger, "invalid company", err)
+	}
+
+	company, err := s.companyRepository.UpdateCompany(ctx, int(req.GetId()), int(req.GetVersion()), body)
+	if err != nil {
+		return nil, repositoryStatus(ctx, s.logger, err)
+	}
+
+	return companyToProto(company), nil
+}
+
+func (s companyServer) Delete(ctx context.Context, req *companyv1.DeleteCompanyRequest) (*emptypb.Empty, error) {
+	err := s.checkVersion(ctx, req.GetVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.companyRepository.DeleteCompany(ctx, int(req.GetId()), int(req.GetVersion()))
+	if err != nil {
+		return nil, repositoryStatus(ctx, s.logger, err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// BatchGet reads the companies with one query and answers them in the
+// requested order.
+func (s companyServer) BatchGet(ctx context.Context, req *companyv1.BatchGetCompaniesRequest) (*companyv1.BatchGetCompaniesResponse, error) {
+	if len(req.GetIds()) > maxBatchGetIds {
+		logging.FromContext(ctx, s.logger).Warn().Timestamp().Int("ids", len(req.GetIds())).Msg("too many company IDs")
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d company IDs can be read at once", maxBatchGetIds)
+	}
+
+	ids := make([]int, 0, len(req.GetIds()))
+	for _, id := range req.GetIds() {
+		ids = append(ids, int(id))
+	}
+
+	companies, err := s.companyRepository.GetCompanies(ctx, ids)
+	if err != nil {
+		return nil, repositoryStatus(ctx, s.logger, err)
+	}
+
+	found := make(map[int]entities.Company, len(companies))
+	for _, company := range companies {
+		found[company.Id] = company
+	}
+
+	resp := &companyv1.BatchGetCompaniesResponse{}
+	for _, id := range req.GetIds() {
+		company, ok := found[int(id)]
+		if !ok {
+			resp.MissingIds = append(resp.MissingIds, id)
+			continue
+		}
+		resp.Companies = append(resp.Companies, companyToProto(company))
+	}
+
+	return resp, nil
+}
+
+// Watch streams company events like GET /v1/company/stream. Instead of a reset
+// event the call ends with ABORTED, and with UNAVAILABLE when the client fell
+// behind or the server shuts down; the client then watches again resuming
+// after the last event it received.
+func (s companyServer) Watch(req *companyv1.WatchCompaniesRequest, srv companyv1.CompanyService_WatchServer) error {
+	ctx := srv.Context()
+
+	filter := dto.StreamFilter{Types: req.GetTypes(), EventTypes: req.GetEventTypes()}
+	for _, id := range req.GetCompanyIds() {
+		filter.CompanyIds = append(filter.CompanyIds, int(id))
+	}
+
+	err := dto.Validator.Struct(filter)
+	if err != nil {
+		return invalidArgument(ctx, s.logger, "invalid stream parameters", err)
+	}
+
+	subscription, replay, found := s.stream.Subscribe(req.GetResumeAfter(), req.ResumeAfter != nil)
+	defer s.stream.Unsubscribe(subscription)
+
+	if !found {
+		return errEventsMissed
+	}
+
+	// The header tells the client that changes from now on reach it.
+	err = srv.SendHeader(nil)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Info().Timestamp().Msg(err.Error())
+		return err
+	}
+
+	send := func(event entities.CompanyEvent) error {
+		if !filter.Matches(event) {
+			return nil
+		}
+		err := srv.Send(eventToProto(event))
+		if err != nil {
+			logging.FromContext(ctx, s.logger).Info().Timestamp().Msg(err.Error())
+		}
+		return err
+	}
+
+	for _, event := range replay {
+		err = send(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case event, ok := <-subscription.Events:
+			if !ok {
+				if subscription.Reset() {
+					return errEventsMissed
+				}
+				return status.Error(codes.Unavailable, "stream ended, watch again resuming after the last event")
+			}
+			err = send(event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkVersion enforces REQUIRE_IF_MATCH, a write without the version it
+// expects is rejected like a request without If-Match.
+func (s companyServer) checkVersion(ctx context.Context, version int64) error {
+	if version == 0 && s.requireIfMatch {
+		logging.FromContext(ctx, s.logger).Warn().Timestamp().Msg("company version is required")
+		return status.Error(codes.FailedPrecondition, "version of the company is required")
+	}
+
+	return nil
+}
+
+func listFilter(req *companyv1.ListCompaniesRequest) dto.CompanyFilter {
+	filter := dto.CompanyFilter{
+		Type:       req.GetType(),
+		Registered: req.Registered,
+		NamePrefix: req.GetNamePrefix(),
+		Sort:       "id",
+		Limit:      defaultListLimit,
+		Cursor:     req.GetCursor(),
+	}
+
+	if req.EmployeesAmountMin != nil {
+		min := int(req.GetEmployeesAmountMin())
+		filter.EmployeesAmountMin = &min
+	}
+	if req.EmployeesAmountMax != nil {
+		max := int(req.GetEmployeesAmountMax())
+		filter.EmployeesAmountMax = &max
+	}
+	if v := req.GetSort(); v != "" {
+		filter.Desc = strings.HasPrefix(v, "-")
+		filter.Sort = strings.TrimPrefix(v, "-")
+	}
+	if req.GetLimit() != 0 {
+		filter.Limit = int(req.GetLimit())
+	}
+
+	return filter
+}
+
+func companyFromProto(c *companyv1.CompanyInput) dto.Company {
+	return dto.Company{
+		Name:            c.GetName(),
+		Description:     c.GetDescription(),
+		EmployeesAmount: int(c.GetEmployeesAmount()),
+		Registered:      c.GetRegistered(),
+		Type:            c.GetType(),
+	}
+}
+
+func companyToProto(c entities.Company) *companyv1.Company {
+	return &companyv1.Company{
+		Id:              int64(c.Id),
+		Name:            c.Name,
+		Description:     c.Description,
+		EmployeesAmount: int64(c.EmployeesAmount),
+		Registered:      c.Registered,
+		Type:            c.Type,
+		Version:         int64(c.Version),
+	}
+}
+
+func eventToProto(e entities.CompanyEvent) *companyv1.CompanyEvent {
+	return &companyv1.CompanyEvent{
+		Id:            e.Id,
+		Type:          e.Type,
+		SchemaVersion: int32(e.SchemaVersion),
+		CompanyId:     int64(e.CompanyId),
+		Version:       int64(e.Version),
+		Actor:         e.Actor,
+		RequestId:     e.RequestId,
+		OccurredAt:    timestamppb.New(e.OccurredAt),
+		Company:       companyToProto(e.Company),
+	}
+}
@@ -0,0 +1,179 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: server.go
+
+// Package rpc is a generated GoMock package.
+package rpc_test
+
+import (
+	context "context"
+	reflect "reflect"
+	dto "xm/internal/handlers/dto"
+	entities "xm/internal/repositories/entities"
+	stream "xm/internal/stream"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockcompanyRepository is a mock of companyRepository interface.
+type MockcompanyRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockcompanyRepositoryMockRecorder
+}
+
+// MockcompanyRepositoryMockRecorder is the mock recorder for MockcompanyRepository.
+type MockcompanyRepositoryMockRecorder struct {
+	mock *MockcompanyRepository
+}
+
+// NewMockcompanyRepository creates a new mock instance.
+func NewMockcompanyRepository(ctrl *gomock.Controller) *MockcompanyRepository {
+	mock := &MockcompanyRepository{ctrl: ctrl}
+	mock.recorder = &MockcompanyRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockcompanyRepository) EXPECT() *MockcompanyRepositoryMockRecorder {
+	return m.recorder
+}
+
+// CreateCompany mocks base method.
+func (m *MockcompanyRepository) CreateCompany(ctx context.Context, company dto.Company) (entities.Company, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateCompany", ctx, company)
+	ret0, _ := ret[0].(entities.Company)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateCompany indicates an expected call of CreateCompany.
+func (mr *MockcompanyRepositoryMockRecorder) CreateCompany(ctx, company interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCompany", reflect.TypeOf((*MockcompanyRepository)(nil).CreateCompany), ctx, company)
+}
+
+// DeleteCompany mocks base method.
+func (m *MockcompanyRepository) DeleteCompany(ctx context.Context, id, version int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCompany", ctx, id, version)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCompany indicates an expected call of DeleteCompany.
+func (mr *MockcompanyRepositoryMockRecorder) DeleteCompany(ctx, id, version interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCompany", reflect.TypeOf((*MockcompanyRepository)(nil).DeleteCompany), ctx, id, version)
+}
+
+// GetCompanies mocks base method.
+func (m *MockcompanyRepository) GetCompanies(ctx context.Context, ids []int) ([]entities.Company, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCompanies", ctx, ids)
+	ret0, _ := ret[0].([]entities.Company)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCompanies indicates an expected call of GetCompanies.
+func (mr *MockcompanyRepositoryMockRecorder) GetCompanies(ctx, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCompanies", reflect.TypeOf((*MockcompanyRepository)(nil).GetCompanies), ctx, ids)
+}
+
+// GetCompany mocks base method.
+func (m *MockcompanyRepository) GetCompany(ctx context.Context, id int) (entities.Company, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCompany", ctx, id)
+	ret0, _ := ret[0].(entities.Company)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCompany indicates an expected call of GetCompany.
+func (mr *MockcompanyRepositoryMockRecorder) GetCompany(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCompany", reflect.TypeOf((*MockcompanyRepository)(nil).GetCompany), ctx, id)
+}
+
+// ListCompanies mocks base method.
+func (m *MockcompanyRepository) ListCompanies(ctx context.Context, filter dto.CompanyFilter) ([]entities.Company, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCompanies", ctx, filter)
+	ret0, _ := ret[0].([]entities.Company)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListCompanies indicates an expected call of ListCompanies.
+func (mr *MockcompanyRepositoryMockRecorder) ListCompanies(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCompanies", reflect.TypeOf((*MockcompanyRepository)(nil).ListCompanies), ctx, filter)
+}
+
+// UpdateCompany mocks base method.
+func (m *MockcompanyRepository) UpdateCompany(ctx context.Context, id, version int, company dto.Company) (entities.Company, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateCompany", ctx, id, version, company)
+	ret0, _ := ret[0].(entities.Company)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateCompany indicates an expected call of UpdateCompany.
+func (mr *MockcompanyRepositoryMockRecorder) UpdateCompany(ctx, id, version, company interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCompany", reflect.TypeOf((*MockcompanyRepository)(nil).UpdateCompany), ctx, id, version, company)
+}
+
+// MockcompanyStream is a mock of companyStream interface.
+type MockcompanyStream struct {
+	ctrl     *gomock.Controller
+	recorder *MockcompanyStreamMockRecorder
+}
+
+// MockcompanyStreamMockRecorder is the mock recorder for MockcompanyStream.
+type MockcompanyStreamMockRecorder struct {
+	mock *MockcompanyStream
+}
+
+// NewMockcompanyStream creates a new mock instance.
+func NewMockcompanyStream(ctrl *gomock.Controller) *MockcompanyStream {
+	mock := &MockcompanyStream{ctrl: ctrl}
+	mock.recorder = &MockcompanyStreamMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockcompanyStream) EXPECT() *MockcompanyStreamMockRecorder {
+	return m.recorder
+}
+
+// Subscribe mocks base method.
+func (m *MockcompanyStream) Subscribe(lastEventId int64, resume bool) (*stream.Subscription, []entities.CompanyEvent, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", lastEventId, resume)
+	ret0, _ := ret[0].(*stream.Subscription)
+	ret1, _ := ret[1].([]entities.CompanyEvent)
+	ret2, _ := ret[2].(bool)
+	return ret0, ret1, ret2
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockcompanyStreamMockRecorder) Subscribe(lastEventId, resume interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockcompanyStream)(nil).Subscribe), lastEventId, resume)
+}
+
+// Unsubscribe mocks base method.
+func (m *MockcompanyStream) Unsubscribe(s *stream.Subscription) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Unsubscribe", s)
+}
+
+// Unsubscribe indicates an expected call of Unsubscribe.
+func (mr *MockcompanyStreamMockRecorder) Unsubscribe(s interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unsubscribe", reflect.TypeOf((*MockcompanyStream)(nil).Unsubscribe), s)
+}
@@ -0,0 +1,333 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	companyv1 "xm/api/company/v1"
+	"xm/config"
+	"xm/internal/auth"
+	"xm/internal/handlers/dto"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+	"xm/internal/rpc"
+	"xm/internal/stream"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// tokens verifies the tokens it knows.
+type tokens map[string]auth.Principal
+
+func (t tokens) Verify(token string) (auth.Principal, error) {
+	principal, ok := t[token]
+	if !ok {
+		return auth.Principal{}, auth.ErrInvalidToken
+	}
+
+	return principal, nil
+}
+
+var testTokens = tokens{
+	"reader": {Subject: "reader", Scopes: []string{auth.ScopeRead}},
+	"writer": {Subject: "writer", Scopes: []string{auth.ScopeRead, auth.ScopeWrite, auth.ScopeDelete}},
+}
+
+type companyStream interface {
+	Subscribe(lastEventId int64, resume bool) (*stream.Subscription, []entities.CompanyEvent, bool)
+	Unsubscribe(s *stream.Subscription)
+}
+
+func newClient(t *testing.T, repository *MockcompanyRepository, broker companyStream, cfg config.Configuration) companyv1.CompanyServiceClient {
+	var logger zerolog.Logger
+
+	listener := bufconn.Listen(1 << 20)
+	server := rpc.NewServer(rpc.NewCompanyServer(repository, broker, logger, cfg), testTokens, logger, cfg)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return companyv1.NewCompanyServiceClient(conn)
+}
+
+func withToken(token string) context.Context {
+	if token == "" {
+		return context.Background()
+	}
+
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestAuthorization(t *testing.T) {
+	cases := map[string]struct {
+		Token         string
+		AnonymousRead bool
+		Write         bool
+		WantCode      codes.Code
+	}{
+		"read":                   {Token: "reader", WantCode: codes.OK},
+		"missing token":          {WantCode: codes.Unauthenticated},
+		"invalid token":          {Token: "unknown", WantCode: codes.Unauthenticated},
+		"anonymous read":         {AnonymousRead: true, WantCode: codes.OK},
+		"anonymous write":        {AnonymousRead: true, Write: true, WantCode: codes.Unauthenticated},
+		"write without scope":    {Token: "reader", Write: true, WantCode: codes.PermissionDenied},
+		"write":                  {Token: "writer", Write: true, WantCode: codes.OK},
+		"invalid token for read": {Token: "unknown", AnonymousRead: true, WantCode: codes.Unauthenticated},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repository := NewMockcompanyRepository(ctrl)
+
+			cfg := config.Configuration{Auth: config.Auth{AnonymousRead: tc.AnonymousRead}}
+			client := newClient(t, repository, NewMockcompanyStream(ctrl), cfg)
+
+			var err error
+			if tc.Write {
+				repository.EXPECT().CreateCompany(gomock.Any(), gomock.Any()).
+					Return(entities.Company{Id: 1}, nil).
+					MaxTimes(1)
+				_, err = client.Create(withToken(tc.Token), &companyv1.CreateCompanyRequest{Company: &companyv1.CompanyInput{
+					Name: "Acme", EmployeesAmount: 10, Registered: true, Type: "corporations",
+				}})
+			} else {
+				repository.EXPECT().GetCompany(gomock.Any(), 1).
+					Return(entities.Company{Id: 1}, nil).
+					MaxTimes(1)
+				_, err = client.Get(withToken(tc.Token), &companyv1.GetCompanyRequest{Id: 1})
+			}
+
+			assert.Equal(t, tc.WantCode, status.Code(err))
+		})
+	}
+}
+
+func TestRepositoryErrors(t *testing.T) {
+	cases := map[string]struct {
+		Err      error
+		WantCode codes.Code
+	}{
+		"not found":        {Err: repositories.ErrCompanyNotFound, WantCode: codes.NotFound},
+		"deleted":          {Err: repositories.ErrCompanyDeleted, WantCode: codes.NotFound},
+		"duplicate name":   {Err: repositories.ErrDuplicateName, WantCode: codes.AlreadyExists},
+		"version mismatch": {Err: repositories.ErrVersionMismatch, WantCode: codes.FailedPrecondition},
+		"invalid type":     {Err: repositories.ErrInvalidCompanyType, WantCode: codes.InvalidArgument},
+		"unavailable":      {Err: repositories.ErrUnavailable, WantCode: codes.Unavailable},
+		"timeout":          {Err: repositories.ErrTimeout, WantCode: codes.Unavailable},
+		"internal":         {Err: errors.New("boom"), WantCode: codes.Internal},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repository := NewMockcompanyRepository(ctrl)
+			repository.EXPECT().UpdateCompany(gomock.Any(), 1, 3, gomock.Any()).Return(entities.Company{}, tc.Err)
+
+			client := newClient(t, repository, NewMockcompanyStream(ctrl), config.Configuration{})
+			_, err := client.Update(withToken("writer"), &companyv1.UpdateCompanyRequest{Id: 1, Version: 3, Company: &companyv1.CompanyInput{
+				Name: "Acme", EmployeesAmount: 10, Registered: true, Type: "corporations",
+			}})
+
+			assert.Equal(t, tc.WantCode, status.Code(err))
+		})
+	}
+}
+
+func TestPanicRecovered(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repository := NewMockcompanyRepository(ctrl)
+	gomock.InOrder(
+		repository.EXPECT().GetCompany(gomock.Any(), 1).Do(func(context.Context, int) { panic("boom") }),
+		repository.EXPECT().GetCompany(gomock.Any(), 1).Return(entities.Company{Id: 1, Name: "Acme"}, nil),
+	)
+
+	client := newClient(t, repository, NewMockcompanyStream(ctrl), config.Configuration{})
+
+	_, err := client.Get(withToken("reader"), &companyv1.GetCompanyRequest{Id: 1})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	// The server is still serving.
+	company, err := client.Get(withToken("reader"), &companyv1.GetCompanyRequest{Id: 1})
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", company.GetName())
+}
+
+func TestValidation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repository := NewMockcompanyRepository(ctrl)
+	client := newClient(t, repository, NewMockcompanyStream(ctrl), config.Configuration{})
+
+	_, err := client.Create(withToken("writer"), &companyv1.CreateCompanyRequest{Company: &companyv1.CompanyInput{
+		Name: "A name that is far too long", EmployeesAmount: 10, Registered: true, Type: "corporations",
+	}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	st, _ := status.FromError(err)
+	require.Len(t, st.Details(), 1)
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	require.True(t, ok)
+	require.Len(t, badRequest.FieldViolations, 1)
+	assert.Equal(t, "name", badRequest.FieldViolations[0].Field)
+	assert.Equal(t, "max=15", badRequest.FieldViolations[0].Description)
+
+	_, err = client.List(withToken("reader"), &companyv1.ListCompaniesRequest{Sort: "-rating"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestList(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repository := NewMockcompanyRepository(ctrl)
+	registered := true
+	min := 5
+	repository.EXPECT().ListCompanies(gomock.Any(), dto.CompanyFilter{
+		Registered:         &registered,
+		EmployeesAmountMin: &min,
+		Sort:               "name",
+		Desc:               true,
+		Limit:              20,
+	}).Return([]entities.Company{{Id: 2, Name: "Beta"}}, "next", nil)
+
+	client := newClient(t, repository, NewMockcompanyStream(ctrl), config.Configuration{})
+	resp, err := client.List(withToken("reader"), &companyv1.ListCompaniesRequest{
+		Registered:         &registered,
+		EmployeesAmountMin: &[]int64{5}[0],
+		Sort:               "-name",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, resp.Companies, 1)
+	assert.Equal(t, "Beta", resp.Companies[0].Name)
+	assert.Equal(t, "next", resp.NextCursor)
+}
+
+func TestRequireVersion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repository := NewMockcompanyRepository(ctrl)
+	client := newClient(t, repository, NewMockcompanyStream(ctrl), config.Configuration{RequireIfMatch: true})
+
+	_, err := client.Delete(withToken("writer"), &companyv1.DeleteCompanyRequest{Id: 1})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.Update(withToken("writer"), &companyv1.UpdateCompanyRequest{Id: 1, Company: &companyv1.CompanyInput{
+		Name: "Acme", EmployeesAmount: 10, Registered: true, Type: "corporations",
+	}})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestBatchGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repository := NewMockcompanyRepository(ctrl)
+	repository.EXPECT().GetCompanies(gomock.Any(), []int{3, 7, 1}).
+		Return([]entities.Company{{Id: 1, Name: "Acme"}, {Id: 3, Name: "Beta"}}, nil)
+
+	client := newClient(t, repository, NewMockcompanyStream(ctrl), config.Configuration{})
+	resp, err := client.BatchGet(withToken("reader"), &companyv1.BatchGetCompaniesRequest{Ids: []int64{3, 7, 1}})
+	require.NoError(t, err)
+
+	require.Len(t, resp.Companies, 2)
+	assert.Equal(t, "Beta", resp.Companies[0].Name)
+	assert.Equal(t, "Acme", resp.Companies[1].Name)
+	assert.Equal(t, []int64{7}, resp.MissingIds)
+
+	_, err = client.BatchGet(withToken("reader"), &companyv1.BatchGetCompaniesRequest{Ids: make([]int64, 101)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestWatch(t *testing.T) {
+	cases := map[string]struct {
+		Request  *companyv1.WatchCompaniesRequest
+		WantIds  []int64
+		WantCode codes.Code
+	}{
+		"live": {
+			Request: &companyv1.WatchCompaniesRequest{},
+			WantIds: []int64{4, 5},
+		},
+		"resume filtered": {
+			Request: &companyv1.WatchCompaniesRequest{
+				CompanyIds:  []int64{1, 2},
+				EventTypes:  []string{entities.EventCompanyCreated, entities.EventCompanyDeleted},
+				ResumeAfter: &[]int64{1}[0],
+			},
+			WantIds: []int64{2, 5},
+		},
+		"resume from evicted event": {
+			Request:  &companyv1.WatchCompaniesRequest{ResumeAfter: &[]int64{100}[0]},
+			WantCode: codes.Aborted,
+		},
+		"invalid event type": {
+			Request:  &companyv1.WatchCompaniesRequest{EventTypes: []string{"CompanyRenamed"}},
+			WantCode: codes.InvalidArgument,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repository := NewMockcompanyRepository(ctrl)
+
+			broker := stream.NewBroker(10, 10)
+			broker.Publish([]entities.CompanyEvent{
+				{Id: 1, CompanyId: 1, Type: entities.EventCompanyCreated},
+				{Id: 2, CompanyId: 2, Type: entities.EventCompanyCreated},
+				{Id: 3, CompanyId: 1, Type: entities.EventCompanyUpdated},
+			})
+
+			client := newClient(t, repository, broker, config.Configuration{})
+
+			ctx, cancel := context.WithCancel(withToken("reader"))
+			defer cancel()
+
+			watch, err := client.Watch(ctx, tc.Request)
+			require.NoError(t, err)
+
+			if tc.WantCode != codes.OK {
+				_, err = watch.Recv()
+				assert.Equal(t, tc.WantCode, status.Code(err))
+				return
+			}
+
+			// The header is sent once the call is subscribed.
+			_, err = watch.Header()
+			require.NoError(t, err)
+
+			broker.Publish([]entities.CompanyEvent{
+				{Id: 4, CompanyId: 3, Type: entities.EventCompanyCreated},
+				{Id: 5, CompanyId: 1, Type: entities.EventCompanyDeleted},
+			})
+
+			var ids []int64
+			for len(ids) < len(tc.WantIds) {
+				event, err := watch.Recv()
+				require.NoError(t, err)
+				ids = append(ids, event.Id)
+			}
+			assert.Equal(t, tc.WantIds, ids)
+
+			broker.Reset()
+			_, err = watch.Recv()
+			assert.Equal(t, codes.Aborted, status.Code(err))
+		})
+	}
+}
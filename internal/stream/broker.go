@@ -0,0 +1,137 @@
+// Package stream fans out committed company changes to the server-sent event
+// streams of this instance. Every instance listens for the changes itself, so
+// any of them can serve a stream.
+package stream
+
+import (
+	"sync"
+	"xm/internal/repositories/entities"
+)
+
+// Subscription receives the events published after it subscribed. Events is
+// closed when the subscriber fell behind or the broker was reset; with Reset
+// the events in between may be lost and the client has to reload its state.
+type Subscription struct {
+	Events <-chan entities.CompanyEvent
+	events chan entities.CompanyEvent
+	reset  bool
+}
+
+// Reset reports whether the subscription ended because the broker was
+// reset. It may only be called once Events is closed.
+func (s *Subscription) Reset() bool {
+	return s.reset
+}
+
+// broker keeps the latest events for resumption and hands every new event to
+// the subscriptions.
+type broker struct {
+	mu            sync.Mutex
+	replay        []entities.CompanyEvent
+	replaySize    int
+	bufferSize    int
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+}
+
+func NewBroker(replaySize int, bufferSize int) *broker {
+	return &broker{
+		replaySize:    replaySize,
+		bufferSize:    bufferSize,
+		subscriptions: map[*Subscription]struct{}{},
+	}
+}
+
+// Subscribe starts a subscription. With resume the events published after
+// lastEventId are returned for replay, found is false when that event is no
+// longer or was never in the replay buffer.
+func (b *broker) Subscribe(lastEventId int64, resume bool) (s *Subscription, replay []entities.CompanyEvent, found bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	events := make(chan entities.CompanyEvent, b.bufferSize)
+	s = &Subscription{Events: events, events: events}
+	b.subscriptions[s] = struct{}{}
+	if b.closed {
+		b.drop(s, false)
+	}
+
+	if !resume {
+		return s, nil, true
+	}
+
+	// The buffer is in commit order, which IDs do not follow across
+	// concurrent transactions.
+	for i, event := range b.replay {
+		if event.Id == lastEventId {
+			return s, append([]entities.CompanyEvent(nil), b.replay[i+1:]...), true
+		}
+	}
+
+	return s, nil, false
+}
+
+// Unsubscribe ends a subscription, it is safe to call more than once.
+func (b *broker) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.drop(s, false)
+}
+
+// Publish buffers the events for replay and sends them to every
+// subscription. A subscription whose buffer is full is dropped, its client
+// resumes with the last event it received.
+func (b *broker) Publish(events []entities.CompanyEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, event := range events {
+		b.replay = append(b.replay, event)
+		if len(b.replay) > b.replaySize {
+			b.replay = b.replay[len(b.replay)-b.replaySize:]
+		}
+
+		for s := range b.subscriptions {
+			select {
+			case s.events <- event:
+			default:
+				b.drop(s, false)
+			}
+		}
+	}
+}
+
+// Reset forgets the replay buffer and ends every subscription, for when
+// changes may have been missed.
+func (b *broker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.replay = nil
+	for s := range b.subscriptions {
+		b.drop(s, true)
+	}
+}
+
+// Close ends every subscription without a reset when the server shuts down,
+// the clients resume on another instance.
+func (b *broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for s := range b.subscriptions {
+		b.drop(s, false)
+	}
+}
+
+func (b *broker) drop(s *Subscription, reset bool) {
+	if _, ok := b.subscriptions[s]; !ok {
+		return
+	}
+
+	delete(b.subscriptions, s)
+	s.reset = reset
+	close(s.events)
+}
@@ -0,0 +1,83 @@
+package stream_test
+
+import (
+	"testing"
+	"xm/internal/repositories/entities"
+	"xm/internal/stream"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func events(ids ...int64) []entities.CompanyEvent {
+	var events []entities.CompanyEvent
+	for _, id := range ids {
+		events = append(events, entities.CompanyEvent{Id: id})
+	}
+	return events
+}
+
+func TestSubscribe(t *testing.T) {
+	cases := map[string]struct {
+		LastEventId int64
+		Resume      bool
+		WantReplay  []entities.CompanyEvent
+		WantFound   bool
+	}{
+		"live only":           {WantFound: true},
+		"resume":              {LastEventId: 4, Resume: true, WantReplay: events(3, 5), WantFound: true},
+		"resume at the end":   {LastEventId: 5, Resume: true, WantFound: true},
+		"evicted event":       {LastEventId: 1, Resume: true},
+		"never buffered":      {LastEventId: 9, Resume: true},
+		"resume out of order": {LastEventId: 3, Resume: true, WantReplay: events(5), WantFound: true},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			broker := stream.NewBroker(4, 8)
+			// IDs follow commit order only within a transaction.
+			broker.Publish(events(1, 2, 4))
+			broker.Publish(events(3, 5))
+
+			s, replay, found := broker.Subscribe(tc.LastEventId, tc.Resume)
+			defer broker.Unsubscribe(s)
+
+			assert.Equal(t, tc.WantReplay, replay)
+			assert.Equal(t, tc.WantFound, found)
+		})
+	}
+}
+
+func TestPublish(t *testing.T) {
+	broker := stream.NewBroker(10, 2)
+
+	fast, _, _ := broker.Subscribe(0, false)
+	slow, _, _ := broker.Subscribe(0, false)
+
+	broker.Publish(events(1, 2))
+	assert.Equal(t, entities.CompanyEvent{Id: 1}, <-fast.Events)
+	assert.Equal(t, entities.CompanyEvent{Id: 2}, <-fast.Events)
+
+	// The slow subscription did not read and is dropped, it resumes from the
+	// replay buffer.
+	broker.Publish(events(3))
+	assert.Equal(t, entities.CompanyEvent{Id: 3}, <-fast.Events)
+
+	var received []int64
+	for event := range slow.Events {
+		received = append(received, event.Id)
+	}
+	assert.Equal(t, []int64{1, 2}, received)
+	assert.False(t, slow.Reset())
+
+	broker.Reset()
+	_, ok := <-fast.Events
+	assert.False(t, ok)
+	assert.True(t, fast.Reset())
+
+	// Unsubscribing a dropped subscription is a no-op.
+	broker.Unsubscribe(fast)
+	broker.Unsubscribe(slow)
+
+	_, _, found := broker.Subscribe(3, true)
+	assert.False(t, found)
+}
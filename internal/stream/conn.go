@@ -0,0 +1,28 @@
+package stream
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+type connKey struct{}
+
+// ConnContext is the http.Server ConnContext hook that lets streams reach
+// their connection.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// ExtendWriteDeadline moves the write deadline of the request connection,
+// which HTTP_SERVER_TIMEOUT sets once per request, timeout past now. A
+// stream calls it before every write so it outlives the server timeout while
+// a stuck client is still cut off.
+func ExtendWriteDeadline(ctx context.Context, timeout time.Duration) error {
+	c, ok := ctx.Value(connKey{}).(net.Conn)
+	if !ok {
+		return nil
+	}
+
+	return c.SetWriteDeadline(time.Now().Add(timeout))
+}
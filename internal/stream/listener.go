@@ -0,0 +1,108 @@
+package stream
+
+import (
+	"context"
+	"strconv"
+	"time"
+	"xm/config"
+	"xm/internal/repositories"
+	"xm/internal/repositories/entities"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// pingInterval is how often an idle listener connection is checked, a dead
+// connection would otherwise go unnoticed until the next notification.
+const pingInterval = 90 * time.Second
+
+type changesRepository interface {
+	ListChangeEvents(ctx context.Context, xactId int64) ([]entities.CompanyEvent, error)
+}
+
+type publisher interface {
+	Publish(events []entities.CompanyEvent)
+	Reset()
+}
+
+// listener LISTENs on the changes channel and publishes the events of every
+// notified transaction. Postgres notifies in commit order, so every instance
+// sees the changes in the same order.
+type listener struct {
+	dsn          string
+	repository   changesRepository
+	publisher    publisher
+	minReconnect time.Duration
+	maxReconnect time.Duration
+	logger       zerolog.Logger
+}
+
+func NewListener(dsn string, repository changesRepository, publisher publisher, cfg config.Stream, logger zerolog.Logger) listener {
+	return listener{
+		dsn:          dsn,
+		repository:   repository,
+		publisher:    publisher,
+		minReconnect: cfg.MinReconnect,
+		maxReconnect: cfg.MaxReconnect,
+		logger:       logger,
+	}
+}
+
+// Run listens until ctx is cancelled. After the connection was lost the
+// broker is reset, the notifications in between are gone.
+func (l listener) Run(ctx context.Context) {
+	pqListener := pq.NewListener(l.dsn, l.minReconnect, l.maxReconnect, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			l.logger.Warn().Timestamp().Msg(err.Error())
+		}
+	})
+	defer pqListener.Close()
+
+	// Without a connection the channel is listened on once it is up.
+	err := pqListener.Listen(repositories.ChangesChannel)
+	if err != nil {
+		l.logger.Warn().Timestamp().Msg(err.Error())
+	}
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-pqListener.Notify:
+			l.handle(ctx, notification)
+		case <-ticker.C:
+			go func() {
+				_ = pqListener.Ping()
+			}()
+		}
+	}
+}
+
+func (l listener) handle(ctx context.Context, notification *pq.Notification) {
+	// A nil notification follows a reconnect.
+	if notification == nil {
+		l.logger.Warn().Timestamp().Msg("change listener reconnected, streams are reset")
+		l.publisher.Reset()
+		return
+	}
+
+	xactId, err := strconv.ParseInt(notification.Extra, 10, 64)
+	if err != nil {
+		l.logger.Error().Timestamp().Msg(err.Error())
+		return
+	}
+
+	events, err := l.repository.ListChangeEvents(ctx, xactId)
+	if err != nil {
+		if ctx.Err() == nil {
+			l.logger.Error().Timestamp().Int64("xact_id", xactId).Msg(err.Error())
+			l.publisher.Reset()
+		}
+		return
+	}
+
+	l.publisher.Publish(events)
+}
@@ -0,0 +1,204 @@
+package tracing
+
+import (
+	"context"
+	"time"
+	"xm/internal/handlers/dto"
+	"xm/internal/repositories/entities"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type companyRepository interface {
+	GetCompany(ctx context.Context, id int) (entities.Company, error)
+	GetCompanies(ctx context.Context, ids []int) ([]entities.Company, error)
+	CreateCompany(ctx context.Context, company dto.Company) (entities.Company, error)
+	DeleteCompany(ctx context.Context, id int, version int) error
+	UpdateCompany(ctx context.Context, id int, version int, company dto.Company) (entities.Company, error)
+	ListCompanies(ctx context.Context, filter dto.CompanyFilter) ([]entities.Company, string, error)
+	PatchCompany(ctx context.Context, id int, version int, patch dto.CompanyPatch) (entities.Company, error)
+	RestoreCompany(ctx context.Context, id int) (entities.Company, error)
+	PurgeCompany(ctx context.Context, id int) error
+	BatchCompanies(ctx context.Context, operations []dto.BatchOperation, atomic bool) ([]entities.BatchResult, error)
+	ImportCompanies(ctx context.Context, rows []dto.CompanyImport, dryRun bool) ([]entities.BatchResult, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]entities.CompanyEvent, error)
+	AckEvent(ctx context.Context, id int64) error
+	RetryEvent(ctx context.Context, id int64, delay time.Duration, cause string) error
+	ListChangeEvents(ctx context.Context, xactId int64) ([]entities.CompanyEvent, error)
+	ListCompanyHistory(ctx context.Context, id int, limit int, cursor string) ([]entities.CompanyHistory, string, error)
+	GetCompanyHistory(ctx context.Context, id int, version int) (entities.CompanyHistory, error)
+}
+
+var tracer = otel.Tracer("xm/internal/tracing")
+
+// tracedRepository starts a span for every repository method, the statements
+// it runs become its children.
+type tracedRepository struct {
+	repository companyRepository
+}
+
+func NewCompanyRepository(repository companyRepository) tracedRepository {
+	return tracedRepository{repository: repository}
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (r tracedRepository) GetCompany(ctx context.Context, id int) (entities.Company, error) {
+	ctx, span := tracer.Start(ctx, "repositories.GetCompany")
+	company, err := r.repository.GetCompany(ctx, id)
+	end(span, err)
+
+	return company, err
+}
+
+func (r tracedRepository) GetCompanies(ctx context.Context, ids []int) ([]entities.Company, error) {
+	ctx, span := tracer.Start(ctx, "repositories.GetCompanies", trace.WithAttributes(attribute.Int("company.ids", len(ids))))
+	companies, err := r.repository.GetCompanies(ctx, ids)
+	end(span, err)
+
+	return companies, err
+}
+
+func (r tracedRepository) CreateCompany(ctx context.Context, company dto.Company) (entities.Company, error) {
+	ctx, span := tracer.Start(ctx, "repositories.CreateCompany")
+	created, err := r.repository.CreateCompany(ctx, company)
+	end(span, err)
+
+	return created, err
+}
+
+func (r tracedRepository) DeleteCompany(ctx context.Context, id int, version int) error {
+	ctx, span := tracer.Start(ctx, "repositories.DeleteCompany")
+	err := r.repository.DeleteCompany(ctx, id, version)
+	end(span, err)
+
+	return err
+}
+
+func (r tracedRepository) UpdateCompany(ctx context.Context, id int, version int, company dto.Company) (entities.Company, error) {
+	ctx, span := tracer.Start(ctx, "repositories.UpdateCompany")
+	updated, err := r.repository.UpdateCompany(ctx, id, version, company)
+	end(span, err)
+
+	return updated, err
+}
+
+func (r tracedRepository) ListCompanies(ctx context.Context, filter dto.CompanyFilter) ([]entities.Company, string, error) {
+	ctx, span := tracer.Start(ctx, "repositories.ListCompanies")
+	companies, cursor, err := r.repository.ListCompanies(ctx, filter)
+	end(span, err)
+
+	return companies, cursor, err
+}
+
+func (r tracedRepository) PatchCompany(ctx context.Context, id int, version int, patch dto.CompanyPatch) (entities.Company, error) {
+	ctx, span := tracer.Start(ctx, "repositories.PatchCompany")
+	patched, err := r.repository.PatchCompany(ctx, id, version, patch)
+	end(span, err)
+
+	return patched, err
+}
+
+func (r tracedRepository) RestoreCompany(ctx context.Context, id int) (entities.Company, error) {
+	ctx, span := tracer.Start(ctx, "repositories.RestoreCompany")
+	restored, err := r.repository.RestoreCompany(ctx, id)
+	end(span, err)
+
+	return restored, err
+}
+
+func (r tracedRepository) PurgeCompany(ctx context.Context, id int) error {
+	ctx, span := tracer.Start(ctx, "repositories.PurgeCompany")
+	err := r.repository.PurgeCompany(ctx, id)
+	end(span, err)
+
+	return err
+}
+
+func (r tracedRepository) BatchCompanies(ctx context.Context, operations []dto.BatchOperation, atomic bool) ([]entities.BatchResult, error) {
+	ctx, span := tracer.Start(ctx, "repositories.BatchCompanies", trace.WithAttributes(
+		attribute.Int("batch.operations", len(operations)),
+		attribute.Bool("batch.atomic", atomic)))
+	results, err := r.repository.BatchCompanies(ctx, operations, atomic)
+	end(span, err)
+
+	return results, err
+}
+
+func (r tracedRepository) ImportCompanies(ctx context.Context, rows []dto.CompanyImport, dryRun bool) ([]entities.BatchResult, error) {
+	ctx, span := tracer.Start(ctx, "repositories.ImportCompanies", trace.WithAttributes(
+		attribute.Int("import.rows", len(rows)),
+		attribute.Bool("import.dry_run", dryRun)))
+	results, err := r.repository.ImportCompanies(ctx, rows, dryRun)
+	end(span, err)
+
+	return results, err
+}
+
+func (r tracedRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracer.Start(ctx, "repositories.PurgeDeleted")
+	purged, err := r.repository.PurgeDeleted(ctx, before)
+	end(span, err)
+
+	return purged, err
+}
+
+func (r tracedRepository) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]entities.CompanyEvent, error) {
+	ctx, span := tracer.Start(ctx, "repositories.ClaimEvents")
+	events, err := r.repository.ClaimEvents(ctx, limit, lease)
+	span.SetAttributes(attribute.Int("outbox.events", len(events)))
+	end(span, err)
+
+	return events, err
+}
+
+func (r tracedRepository) AckEvent(ctx context.Context, id int64) error {
+	ctx, span := tracer.Start(ctx, "repositories.AckEvent", trace.WithAttributes(attribute.Int64("outbox.event_id", id)))
+	err := r.repository.AckEvent(ctx, id)
+	end(span, err)
+
+	return err
+}
+
+func (r tracedRepository) RetryEvent(ctx context.Context, id int64, delay time.Duration, cause string) error {
+	ctx, span := tracer.Start(ctx, "repositories.RetryEvent", trace.WithAttributes(attribute.Int64("outbox.event_id", id)))
+	err := r.repository.RetryEvent(ctx, id, delay, cause)
+	end(span, err)
+
+	return err
+}
+
+func (r tracedRepository) ListChangeEvents(ctx context.Context, xactId int64) ([]entities.CompanyEvent, error) {
+	ctx, span := tracer.Start(ctx, "repositories.ListChangeEvents", trace.WithAttributes(attribute.Int64("db.xact_id", xactId)))
+	events, err := r.repository.ListChangeEvents(ctx, xactId)
+	span.SetAttributes(attribute.Int("stream.events", len(events)))
+	end(span, err)
+
+	return events, err
+}
+
+func (r tracedRepository) ListCompanyHistory(ctx context.Context, id int, limit int, cursor string) ([]entities.CompanyHistory, string, error) {
+	ctx, span := tracer.Start(ctx, "repositories.ListCompanyHistory")
+	history, next, err := r.repository.ListCompanyHistory(ctx, id, limit, cursor)
+	end(span, err)
+
+	return history, next, err
+}
+
+func (r tracedRepository) GetCompanyHistory(ctx context.Context, id int, version int) (entities.CompanyHistory, error) {
+	ctx, span := tracer.Start(ctx, "repositories.GetCompanyHistory")
+	change, err := r.repository.GetCompanyHistory(ctx, id, version)
+	end(span, err)
+
+	return change, err
+}
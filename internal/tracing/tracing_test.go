@@ -0,0 +1,144 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"xm/config"
+	"xm/internal/repositories"
+	"xm/internal/tracing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// The global provider can only be installed once for tracers that were
+// created before it, so every test shares it and only looks at the spans it
+// ended itself.
+var recorder = tracetest.NewSpanRecorder()
+
+func TestMain(m *testing.M) {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	os.Exit(m.Run())
+}
+
+// record returns the spans ended from now on.
+func record() func() []sdktrace.ReadOnlySpan {
+	seen := len(recorder.Ended())
+
+	return func() []sdktrace.ReadOnlySpan {
+		return recorder.Ended()[seen:]
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	ended := record()
+
+	router := chi.NewRouter()
+	router.Use(tracing.Middleware)
+	router.Get("/v1/company/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/company/1", nil)
+	r.Header.Set("traceparent", traceparent)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /v1/company/{id}", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	ended := record()
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceparent))
+	info := &grpc.UnaryServerInfo{FullMethod: "/company.v1.CompanyService/Get"}
+	_, err := tracing.UnaryInterceptor()(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+
+	spans := ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "company.v1.CompanyService/Get", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+}
+
+func TestTransport(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "outgoing")
+	defer span.End()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	client := http.Client{Transport: tracing.Transport(http.DefaultTransport)}
+	response, err := client.Do(r)
+	require.NoError(t, err)
+	_ = response.Body.Close()
+
+	assert.Contains(t, received, span.SpanContext().TraceID().String())
+}
+
+func TestCompanyRepository(t *testing.T) {
+	ended := record()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT .+ FROM company WHERE id = \$1`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	repository := tracing.NewCompanyRepository(repositories.NewCompanyRepository(sqlx.NewDb(db, "postgres"), config.Postgres{}, true))
+
+	_, err = repository.GetCompany(context.Background(), 1)
+	require.ErrorIs(t, err, repositories.ErrCompanyNotFound)
+
+	spans := ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "SELECT company", spans[0].Name())
+	assert.Equal(t, "repositories.GetCompany", spans[1].Name())
+	assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
+
+func TestLogHook(t *testing.T) {
+	var out bytes.Buffer
+	logger := zerolog.New(&out).Hook(tracing.LogHook{})
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	logger.Info().Ctx(ctx).Msg("traced")
+	logger.Info().Msg("untraced")
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	assert.Contains(t, string(lines[0]), `"trace_id":"`+span.SpanContext().TraceID().String()+`"`)
+	assert.Contains(t, string(lines[0]), `"span_id":"`+span.SpanContext().SpanID().String()+`"`)
+	assert.NotContains(t, string(lines[1]), "trace_id")
+}
@@ -0,0 +1,100 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+var ErrForbiddenAddress = errors.New("webhook address is loopback, link-local, private or unspecified")
+
+// AddressPolicy keeps webhook deliveries away from the service's own network,
+// anyone allowed to subscribe could otherwise make the service POST to
+// internal endpoints. Loopback, link-local, private, multicast and
+// unspecified addresses are refused unless they are in one of the allowed
+// networks.
+type AddressPolicy struct {
+	allowed []*net.IPNet
+}
+
+// NewAddressPolicy parses the comma separated CIDRs of WEBHOOK_ALLOWED_NETWORKS.
+func NewAddressPolicy(allowedNetworks string) (AddressPolicy, error) {
+	var p AddressPolicy
+	for _, cidr := range strings.Split(allowedNetworks, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return AddressPolicy{}, fmt.Errorf("WEBHOOK_ALLOWED_NETWORKS: %w", err)
+		}
+		p.allowed = append(p.allowed, network)
+	}
+
+	return p, nil
+}
+
+// Allowed reports whether deliveries may be sent to ip.
+func (p AddressPolicy) Allowed(ip net.IP) bool {
+	for _, network := range p.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// CheckURL rejects a webhook URL whose host is or resolves to a forbidden
+// address. A host that does not resolve is accepted, Control still checks
+// every connection when the address is known.
+func (p AddressPolicy) CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !p.Allowed(ip) {
+			return ErrForbiddenAddress
+		}
+		return nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, address := range addresses {
+		if !p.Allowed(address.IP) {
+			return ErrForbiddenAddress
+		}
+	}
+
+	return nil
+}
+
+// Control is a net.Dialer Control function refusing connections to forbidden
+// addresses. It runs after DNS resolution, so a host that resolves to another
+// address than at subscription time is refused as well.
+func (p AddressPolicy) Control(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !p.Allowed(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package webhooks_test
+
+import (
+	"context"
+	"testing"
+	"xm/internal/webhooks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressPolicy(t *testing.T) {
+	cases := map[string]struct {
+		Allowed string
+		URL     string
+		WantErr error
+	}{
+		"public":               {URL: "https://93.184.216.34/hooks"},
+		"loopback":             {URL: "http://127.0.0.1:8080/hooks", WantErr: webhooks.ErrForbiddenAddress},
+		"ipv6 loopback":        {URL: "http://[::1]/hooks", WantErr: webhooks.ErrForbiddenAddress},
+		"cloud metadata":       {URL: "http://169.254.169.254/latest/meta-data", WantErr: webhooks.ErrForbiddenAddress},
+		"private":              {URL: "https://192.168.1.10/hooks", WantErr: webhooks.ErrForbiddenAddress},
+		"unspecified":          {URL: "http://0.0.0.0/hooks", WantErr: webhooks.ErrForbiddenAddress},
+		"localhost":            {URL: "http://localhost/hooks", WantErr: webhooks.ErrForbiddenAddress},
+		"allowed network":      {Allowed: "10.1.0.0/16", URL: "https://10.1.2.3/hooks"},
+		"outside allowed":      {Allowed: "10.1.0.0/16", URL: "https://10.2.0.1/hooks", WantErr: webhooks.ErrForbiddenAddress},
+		"unresolvable is left": {URL: "https://webhook.invalid/hooks"},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			policy, err := webhooks.NewAddressPolicy(tc.Allowed)
+			require.NoError(t, err)
+
+			err = policy.CheckURL(context.Background(), tc.URL)
+			assert.ErrorIs(t, err, tc.WantErr)
+		})
+	}
+}
+
+func TestAddressPolicyControl(t *testing.T) {
+	policy, err := webhooks.NewAddressPolicy("")
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, policy.Control("tcp4", "127.0.0.1:443", nil), webhooks.ErrForbiddenAddress)
+	assert.ErrorIs(t, policy.Control("tcp6", "[fe80::1]:443", nil), webhooks.ErrForbiddenAddress)
+	assert.NoError(t, policy.Control("tcp4", "93.184.216.34:443", nil))
+}
+
+func TestNewAddressPolicyInvalid(t *testing.T) {
+	_, err := webhooks.NewAddressPolicy("10.0.0.0/8, not-a-network")
+	assert.Error(t, err)
+}
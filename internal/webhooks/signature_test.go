@@ -0,0 +1,53 @@
+package webhooks_test
+
+import (
+	"testing"
+	"time"
+	"xm/internal/webhooks"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1676900000, 0)
+	body := []byte(`{"id":1}`)
+	signature := webhooks.Sign("0123456789abcdef", now, body)
+
+	cases := map[string]struct {
+		Secret    string
+		Header    string
+		Body      []byte
+		Tolerance time.Duration
+		Now       time.Time
+		WantErr   error
+	}{
+		"valid": {
+			Secret: "0123456789abcdef", Header: signature, Body: body, Tolerance: 5 * time.Minute, Now: now.Add(time.Minute),
+		},
+		"valid among rotated signatures": {
+			Secret: "0123456789abcdef", Header: "t=1676900000,v1=00ff," + signature[len("t=1676900000,"):], Body: body, Now: now,
+		},
+		"wrong secret": {
+			Secret: "fedcba9876543210", Header: signature, Body: body, Now: now, WantErr: webhooks.ErrInvalidSignature,
+		},
+		"tampered body": {
+			Secret: "0123456789abcdef", Header: signature, Body: []byte(`{"id":2}`), Now: now, WantErr: webhooks.ErrInvalidSignature,
+		},
+		"tampered timestamp": {
+			Secret: "0123456789abcdef", Header: "t=1676900001" + signature[len("t=1676900000"):], Body: body, Now: now, WantErr: webhooks.ErrInvalidSignature,
+		},
+		"malformed": {
+			Secret: "0123456789abcdef", Header: "v1=zz", Body: body, Now: now, WantErr: webhooks.ErrInvalidSignature,
+		},
+		"expired": {
+			Secret: "0123456789abcdef", Header: signature, Body: body, Tolerance: 5 * time.Minute, Now: now.Add(time.Hour), WantErr: webhooks.ErrSignatureExpired,
+		},
+	}
+
+	for testName, tc := range cases {
+		t.Run(testName, func(t *testing.T) {
+			err := webhooks.Verify(tc.Secret, tc.Header, tc.Body, tc.Tolerance, tc.Now)
+			assert.ErrorIs(t, err, tc.WantErr)
+		})
+	}
+}
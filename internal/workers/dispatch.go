@@ -0,0 +1,128 @@
+package workers
+
+import (
+	"context"
+	"time"
+	"xm/config"
+	"xm/internal/repositories/entities"
+
+	"github.com/rs/zerolog"
+)
+
+type outboxRepository interface {
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]entities.CompanyEvent, error)
+	AckEvent(ctx context.Context, id int64) error
+	RetryEvent(ctx context.Context, id int64, delay time.Duration, cause string) error
+}
+
+type eventSink interface {
+	Publish(ctx context.Context, event entities.CompanyEvent) error
+}
+
+// dispatcher publishes the company events of the outbox at least once. An
+// event is removed only after the sink accepted it, a failed event is retried
+// with exponential backoff and holds back the later events of its company.
+type dispatcher struct {
+	repository     outboxRepository
+	sink           eventSink
+	interval       time.Duration
+	batchSize      int
+	lease          time.Duration
+	retryMin       time.Duration
+	retryMax       time.Duration
+	publishTimeout time.Duration
+	logger         zerolog.Logger
+}
+
+func NewDispatcher(repository outboxRepository, sink eventSink, cfg config.Outbox, logger zerolog.Logger) dispatcher {
+	return dispatcher{
+		repository:     repository,
+		sink:           sink,
+		interval:       cfg.Interval,
+		batchSize:      cfg.BatchSize,
+		lease:          cfg.Lease,
+		retryMin:       cfg.RetryMin,
+		retryMax:       cfg.RetryMax,
+		publishTimeout: cfg.PublishTimeout,
+		logger:         logger,
+	}
+}
+
+// Run dispatches until the outbox has nothing due, then waits for the next
+// interval, until ctx is cancelled.
+func (d dispatcher) Run(ctx context.Context) {
+	if d.interval <= 0 || d.batchSize <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		// Every round claims only the oldest event of each company, the next
+		// one becomes due as soon as it is acknowledged.
+		for d.dispatch(ctx) > 0 {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d dispatcher) dispatch(ctx context.Context) int {
+	events, err := d.repository.ClaimEvents(ctx, d.batchSize, d.lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.logger.Error().Timestamp().Msg(err.Error())
+		}
+		return 0
+	}
+
+	for _, event := range events {
+		d.publish(ctx, event)
+	}
+
+	return len(events)
+}
+
+func (d dispatcher) publish(ctx context.Context, event entities.CompanyEvent) {
+	publishCtx, cancel := context.WithTimeout(ctx, d.publishTimeout)
+	err := d.sink.Publish(publishCtx, event)
+	cancel()
+
+	if err != nil {
+		delay := backoff(event.Attempts, d.retryMin, d.retryMax)
+		d.logger.Warn().Timestamp().Int64("event_id", event.Id).Int("company_id", event.CompanyId).
+			Int("attempts", event.Attempts).Dur("retry_in", delay).Msg(err.Error())
+
+		// Without the retry the event is published again once its lease ends.
+		err = d.repository.RetryEvent(ctx, event.Id, delay, err.Error())
+		if err != nil {
+			d.logger.Error().Timestamp().Msg(err.Error())
+		}
+		return
+	}
+
+	// Without the acknowledgement the event is published again once its lease
+	// ends, consumers tell redeliveries apart by the event ID.
+	err = d.repository.AckEvent(ctx, event.Id)
+	if err != nil {
+		d.logger.Error().Timestamp().Msg(err.Error())
+	}
+}
+
+// backoff doubles the retry delay with every attempt, from min up to max.
+func backoff(attempts int, min time.Duration, max time.Duration) time.Duration {
+	delay := min
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	return delay
+}
@@ -0,0 +1,139 @@
+package workers_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/repositories/entities"
+	"xm/internal/workers"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+// outboxRepository hands out the oldest pending event of every company like
+// the postgres outbox, retried events stay pending.
+type outboxRepository struct {
+	mu      sync.Mutex
+	pending []entities.CompanyEvent
+	retries map[int64]time.Duration
+}
+
+func (r *outboxRepository) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]entities.CompanyEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var claimed []entities.CompanyEvent
+	seen := map[int]bool{}
+	for i, event := range r.pending {
+		if seen[event.CompanyId] {
+			continue
+		}
+		seen[event.CompanyId] = true
+		if _, ok := r.retries[event.Id]; ok || len(claimed) == limit {
+			continue
+		}
+		r.pending[i].Attempts++
+		claimed = append(claimed, r.pending[i])
+	}
+
+	return claimed, nil
+}
+
+func (r *outboxRepository) AckEvent(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, event := range r.pending {
+		if event.Id == id {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *outboxRepository) RetryEvent(ctx context.Context, id int64, delay time.Duration, cause string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.retries[id] = delay
+	return nil
+}
+
+type eventSink struct {
+	mu        sync.Mutex
+	published []int64
+	fail      map[int64]bool
+}
+
+func (s *eventSink) Publish(ctx context.Context, event entities.CompanyEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail[event.Id] {
+		return errors.New("broker unavailable")
+	}
+	s.published = append(s.published, event.Id)
+	return nil
+}
+
+func (s *eventSink) calls() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]int64(nil), s.published...)
+}
+
+func TestDispatcher(t *testing.T) {
+	var logger zerolog.Logger
+
+	repository := &outboxRepository{
+		pending: []entities.CompanyEvent{
+			{Id: 1, CompanyId: 10},
+			{Id: 2, CompanyId: 20, Attempts: 2},
+			{Id: 3, CompanyId: 10},
+			{Id: 4, CompanyId: 30},
+			{Id: 5, CompanyId: 20},
+			{Id: 6, CompanyId: 10},
+		},
+		retries: map[int64]time.Duration{},
+	}
+	sink := &eventSink{fail: map[int64]bool{2: true}}
+
+	cfg := config.Outbox{Interval: time.Hour, BatchSize: 2, Lease: time.Minute, RetryMin: time.Second, RetryMax: 3 * time.Second, PublishTimeout: time.Second}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		workers.NewDispatcher(repository, sink, cfg, logger).Run(ctx)
+		close(done)
+	}()
+
+	// The failed event holds back company 20, the others drain in order
+	// without waiting for the interval.
+	assert.Eventually(t, func() bool { return len(sink.calls()) == 4 }, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	published := sink.calls()
+	assert.ElementsMatch(t, []int64{1, 3, 4, 6}, published)
+	assert.Less(t, indexOf(published, 1), indexOf(published, 3))
+	assert.Less(t, indexOf(published, 3), indexOf(published, 6))
+
+	assert.Equal(t, map[int64]time.Duration{2: 3 * time.Second}, repository.retries)
+	assert.Len(t, repository.pending, 2)
+}
+
+func indexOf(ids []int64, id int64) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,78 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type purgeRepository interface {
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+}
+
+type expiredKeys interface {
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+// purger permanently removes companies that stayed soft deleted longer than
+// the retention period and idempotency keys past their expiry. A zero
+// retention keeps deleted companies.
+type purger struct {
+	repository      purgeRepository
+	idempotencyKeys expiredKeys
+	retention       time.Duration
+	interval        time.Duration
+	logger          zerolog.Logger
+}
+
+func NewPurger(repository purgeRepository, idempotencyKeys expiredKeys, retention time.Duration, interval time.Duration, logger zerolog.Logger) purger {
+	return purger{
+		repository:      repository,
+		idempotencyKeys: idempotencyKeys,
+		retention:       retention,
+		interval:        interval,
+		logger:          logger,
+	}
+}
+
+// Run purges once and then on every interval until ctx is cancelled.
+func (p purger) Run(ctx context.Context) {
+	if p.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p purger) purge(ctx context.Context) {
+	if p.retention > 0 {
+		purged, err := p.repository.PurgeDeleted(ctx, time.Now().Add(-p.retention))
+		if err != nil {
+			p.logger.Error().Timestamp().Msg(err.Error())
+		} else if purged > 0 {
+			p.logger.Info().Timestamp().Int64("purged", purged).Msg("soft deleted companies purged")
+		}
+	}
+
+	purged, err := p.idempotencyKeys.PurgeExpired(ctx)
+	if err != nil {
+		p.logger.Error().Timestamp().Msg(err.Error())
+		return
+	}
+
+	if purged > 0 {
+		p.logger.Info().Timestamp().Int64("purged", purged).Msg("expired idempotency keys purged")
+	}
+}
@@ -0,0 +1,102 @@
+package workers_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"xm/internal/workers"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type purgeRepository struct {
+	mu      sync.Mutex
+	before  []time.Time
+	expired int
+}
+
+func (r *purgeRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.before = append(r.before, before)
+	return 1, nil
+}
+
+func (r *purgeRepository) PurgeExpired(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expired++
+	return 1, nil
+}
+
+func (r *purgeRepository) expiredCalls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.expired
+}
+
+func (r *purgeRepository) calls() []time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]time.Time(nil), r.before...)
+}
+
+func TestPurger(t *testing.T) {
+	var logger zerolog.Logger
+
+	repository := &purgeRepository{}
+	retention := time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		workers.NewPurger(repository, repository, retention, 10*time.Millisecond, logger).Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return len(repository.calls()) >= 2 }, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	before := repository.calls()[0]
+	assert.WithinDuration(t, time.Now().Add(-retention), before, time.Second)
+	assert.GreaterOrEqual(t, repository.expiredCalls(), 2)
+}
+
+func TestPurgerDisabled(t *testing.T) {
+	var logger zerolog.Logger
+
+	repository := &purgeRepository{}
+
+	workers.NewPurger(repository, repository, time.Hour, 0, logger).Run(context.Background())
+
+	assert.Empty(t, repository.calls())
+	assert.Zero(t, repository.expiredCalls())
+}
+
+func TestPurgerRetentionDisabled(t *testing.T) {
+	var logger zerolog.Logger
+
+	repository := &purgeRepository{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		workers.NewPurger(repository, repository, 0, 10*time.Millisecond, logger).Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return repository.expiredCalls() >= 1 }, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Empty(t, repository.calls())
+}
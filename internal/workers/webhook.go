@@ -0,0 +1,212 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"xm/config"
+	"xm/internal/repositories/entities"
+	"xm/internal/tracing"
+	"xm/internal/webhooks"
+
+	"github.com/rs/zerolog"
+)
+
+// cleanupInterval is how often finished deliveries past WEBHOOK_RETENTION are
+// removed.
+const cleanupInterval = time.Hour
+
+// maxResponseBody caps the part of a webhook response that is read, the body
+// itself is discarded.
+const maxResponseBody = 64 << 10
+
+type webhookRepository interface {
+	ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]entities.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, webhookId int64, attempt entities.WebhookAttempt, retryIn time.Duration, maxFailures int) (bool, error)
+	CleanupDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+// deliverer POSTs the webhook deliveries to their endpoints, signed with the
+// secret of the webhook. A delivery is retried with exponential backoff until
+// the endpoint answers with 2xx, every attempt is recorded.
+type deliverer struct {
+	repository  webhookRepository
+	client      *http.Client
+	interval    time.Duration
+	batchSize   int
+	lease       time.Duration
+	retryMin    time.Duration
+	retryMax    time.Duration
+	maxFailures int
+	retention   time.Duration
+	logger      zerolog.Logger
+}
+
+// NewDeliverer sends the deliveries only to addresses the policy allows,
+// checked on every connection after DNS resolution.
+func NewDeliverer(repository webhookRepository, addresses webhooks.AddressPolicy, cfg config.Webhooks, logger zerolog.Logger) deliverer {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: addresses.Control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Through a proxy the dialer would only see the proxy's address.
+	transport.Proxy = nil
+
+	return deliverer{
+		repository: repository,
+		client: &http.Client{
+			Transport: tracing.Transport(transport),
+			Timeout:   cfg.Timeout,
+			// A redirect is a failed delivery, the endpoint has to be updated.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		interval:    cfg.Interval,
+		batchSize:   cfg.BatchSize,
+		lease:       cfg.Lease,
+		retryMin:    cfg.RetryMin,
+		retryMax:    cfg.RetryMax,
+		maxFailures: cfg.MaxFailures,
+		retention:   cfg.Retention,
+		logger:      logger,
+	}
+}
+
+// Run delivers until nothing is due, then waits for the next interval, until
+// ctx is cancelled.
+func (d deliverer) Run(ctx context.Context) {
+	if d.interval <= 0 || d.batchSize <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	var cleaned time.Time
+	for {
+		for d.deliver(ctx) > 0 {
+		}
+
+		if d.retention > 0 && time.Since(cleaned) >= cleanupInterval {
+			d.cleanup(ctx)
+			cleaned = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver sends a claimed batch concurrently, the endpoints do not wait for
+// each other.
+func (d deliverer) deliver(ctx context.Context) int {
+	deliveries, err := d.repository.ClaimDeliveries(ctx, d.batchSize, d.lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.logger.Error().Timestamp().Msg(err.Error())
+		}
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func(delivery entities.WebhookDelivery) {
+			defer wg.Done()
+			d.attempt(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+
+	return len(deliveries)
+}
+
+func (d deliverer) attempt(ctx context.Context, delivery entities.WebhookDelivery) {
+	attempt := d.post(ctx, delivery)
+	if ctx.Err() != nil {
+		// Shutting down, the delivery is sent again once its lease ends.
+		return
+	}
+
+	var retryIn time.Duration
+	if !attempt.Succeeded() {
+		retryIn = backoff(delivery.Attempts, d.retryMin, d.retryMax)
+		d.logger.Warn().Timestamp().Int64("delivery_id", delivery.Id).Int64("webhook_id", delivery.WebhookId).
+			Int("attempts", delivery.Attempts).Int("status", attempt.StatusCode).Dur("retry_in", retryIn).Msg(attempt.Error)
+	}
+
+	disabled, err := d.repository.RecordAttempt(ctx, delivery.WebhookId, attempt, retryIn, d.maxFailures)
+	if err != nil {
+		d.logger.Error().Timestamp().Msg(err.Error())
+		return
+	}
+
+	if disabled {
+		d.logger.Warn().Timestamp().Int64("webhook_id", delivery.WebhookId).
+			Msg(fmt.Sprintf("webhook disabled after %d consecutive failures", d.maxFailures))
+	}
+}
+
+// post sends the event of the delivery once. The signature covers the
+// timestamp, so a receiver can reject replays of an old delivery.
+func (d deliverer) post(ctx context.Context, delivery entities.WebhookDelivery) entities.WebhookAttempt {
+	attempt := entities.WebhookAttempt{DeliveryId: delivery.Id}
+
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	start := time.Now()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(webhooks.SignatureHeader, webhooks.Sign(delivery.Secret, start, body))
+	request.Header.Set(webhooks.DeliveryHeader, strconv.FormatInt(delivery.Id, 10))
+	request.Header.Set(webhooks.EventHeader, delivery.Event.Type)
+
+	response, err := d.client.Do(request)
+	attempt.Duration = time.Since(start)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseBody))
+
+	attempt.StatusCode = response.StatusCode
+	if !attempt.Succeeded() {
+		attempt.Error = fmt.Sprintf("endpoint responded with %s", response.Status)
+	}
+
+	return attempt
+}
+
+func (d deliverer) cleanup(ctx context.Context) {
+	removed, err := d.repository.CleanupDeliveries(ctx, time.Now().Add(-d.retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			d.logger.Error().Timestamp().Msg(err.Error())
+		}
+		return
+	}
+
+	if removed > 0 {
+		d.logger.Info().Timestamp().Int64("removed", removed).Msg("finished webhook deliveries removed")
+	}
+}
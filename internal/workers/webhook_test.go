@@ -0,0 +1,264 @@
+package workers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"xm/config"
+	"xm/internal/repositories/entities"
+	"xm/internal/webhooks"
+	"xm/internal/workers"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookRepository keeps the pending deliveries like the postgres
+// repository, failed ones become due again after their retry delay.
+type webhookRepository struct {
+	mu         sync.Mutex
+	pending    []entities.WebhookDelivery
+	attempts   []entities.WebhookAttempt
+	failures   map[int64]int
+	disabled   map[int64]bool
+	retryDelay []time.Duration
+}
+
+func (r *webhookRepository) ClaimDeliveries(ctx context.Context, limit int, lease time.Duration) ([]entities.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var claimed []entities.WebhookDelivery
+	for i, delivery := range r.pending {
+		if len(claimed) == limit || delivery.NextAttemptAt.After(time.Now()) {
+			continue
+		}
+		r.pending[i].Attempts++
+		r.pending[i].NextAttemptAt = time.Now().Add(lease)
+		claimed = append(claimed, r.pending[i])
+	}
+
+	return claimed, nil
+}
+
+func (r *webhookRepository) RecordAttempt(ctx context.Context, webhookId int64, attempt entities.WebhookAttempt, retryIn time.Duration, maxFailures int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts = append(r.attempts, attempt)
+
+	if attempt.Succeeded() {
+		r.failures[webhookId] = 0
+		r.remove(func(d entities.WebhookDelivery) bool { return d.Id == attempt.DeliveryId })
+		return false, nil
+	}
+
+	r.retryDelay = append(r.retryDelay, retryIn)
+	for i := range r.pending {
+		if r.pending[i].Id == attempt.DeliveryId {
+			r.pending[i].NextAttemptAt = time.Now().Add(retryIn)
+		}
+	}
+
+	r.failures[webhookId]++
+	if r.failures[webhookId] < maxFailures {
+		return false, nil
+	}
+
+	r.disabled[webhookId] = true
+	r.remove(func(d entities.WebhookDelivery) bool { return d.WebhookId == webhookId })
+	return true, nil
+}
+
+func (r *webhookRepository) CleanupDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *webhookRepository) remove(match func(entities.WebhookDelivery) bool) {
+	pending := r.pending[:0]
+	for _, delivery := range r.pending {
+		if !match(delivery) {
+			pending = append(pending, delivery)
+		}
+	}
+	r.pending = pending
+}
+
+func (r *webhookRepository) state() (int, map[int64]bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	disabled := map[int64]bool{}
+	for id, v := range r.disabled {
+		disabled[id] = v
+	}
+
+	return len(r.pending), disabled
+}
+
+// receiver is a webhook endpoint that checks the signature and fails the
+// first requests.
+type receiver struct {
+	mu       sync.Mutex
+	secret   string
+	failures int
+	requests int
+	received []entities.CompanyEvent
+	headers  []http.Header
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if webhooks.Verify(rc.secret, r.Header.Get(webhooks.SignatureHeader), body, time.Minute, time.Now()) != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	rc.requests++
+	if rc.requests <= rc.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var event entities.CompanyEvent
+	_ = json.Unmarshal(body, &event)
+	rc.received = append(rc.received, event)
+	rc.headers = append(rc.headers, r.Header.Clone())
+}
+
+func (rc *receiver) events() ([]entities.CompanyEvent, []http.Header) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return append([]entities.CompanyEvent(nil), rc.received...), append([]http.Header(nil), rc.headers...)
+}
+
+func TestDeliverer(t *testing.T) {
+	var logger zerolog.Logger
+
+	flaky := &receiver{secret: "flaky-secret-0123", failures: 2}
+	flakyServer := httptest.NewServer(flaky)
+	defer flakyServer.Close()
+
+	// The broken endpoint verifies with another secret and rejects everything.
+	broken := &receiver{secret: "another-secret-01"}
+	brokenServer := httptest.NewServer(broken)
+	defer brokenServer.Close()
+
+	redirectServer := httptest.NewServer(http.RedirectHandler(flakyServer.URL, http.StatusFound))
+	defer redirectServer.Close()
+
+	event := entities.CompanyEvent{Id: 7, Type: entities.EventCompanyUpdated, SchemaVersion: 1, CompanyId: 10, Version: 2,
+		Company: entities.Company{Id: 10, Name: "xm", Version: 2}}
+
+	repository := &webhookRepository{
+		pending: []entities.WebhookDelivery{
+			{Id: 1, WebhookId: 1, Event: event, URL: flakyServer.URL, Secret: flaky.secret},
+			{Id: 2, WebhookId: 2, Event: event, URL: brokenServer.URL, Secret: "flaky-secret-0123"},
+			{Id: 3, WebhookId: 3, Event: event, URL: redirectServer.URL, Secret: "flaky-secret-0123"},
+		},
+		failures: map[int64]int{},
+		disabled: map[int64]bool{},
+	}
+
+	cfg := config.Webhooks{Interval: 5 * time.Millisecond, BatchSize: 10, Timeout: time.Second, Lease: time.Minute,
+		RetryMin: time.Millisecond, RetryMax: 2 * time.Millisecond, MaxFailures: 3}
+
+	// The test endpoints listen on loopback, which the policy refuses by
+	// default.
+	addresses, err := webhooks.NewAddressPolicy("127.0.0.0/8, ::1/128")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		workers.NewDeliverer(repository, addresses, cfg, logger).Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		pending, _ := repository.state()
+		return pending == 0
+	}, 2*time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	// The flaky endpoint got the event after two retries, its failures were
+	// reset before it reached WEBHOOK_MAX_FAILURES.
+	received, headers := flaky.events()
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, event, received[0])
+		assert.Equal(t, "1", headers[0].Get(webhooks.DeliveryHeader))
+		assert.Equal(t, entities.EventCompanyUpdated, headers[0].Get(webhooks.EventHeader))
+		assert.Equal(t, "application/json", headers[0].Get("Content-Type"))
+	}
+
+	_, disabled := repository.state()
+	assert.Equal(t, map[int64]bool{2: true, 3: true}, disabled)
+	assert.Empty(t, broken.received)
+
+	statuses := map[int64][]int{}
+	for _, attempt := range repository.attempts {
+		statuses[attempt.DeliveryId] = append(statuses[attempt.DeliveryId], attempt.StatusCode)
+	}
+	assert.Equal(t, map[int64][]int{
+		1: {http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+		2: {http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized},
+		3: {http.StatusFound, http.StatusFound, http.StatusFound},
+	}, statuses)
+
+	for _, delay := range repository.retryDelay {
+		assert.Contains(t, []time.Duration{time.Millisecond, 2 * time.Millisecond}, delay)
+	}
+}
+
+func TestDelivererInternalAddress(t *testing.T) {
+	var logger zerolog.Logger
+
+	internal := &receiver{secret: "internal-secret-0"}
+	server := httptest.NewServer(internal)
+	defer server.Close()
+
+	event := entities.CompanyEvent{Id: 7, Type: entities.EventCompanyCreated, SchemaVersion: 1, CompanyId: 10, Version: 1}
+	repository := &webhookRepository{
+		pending:  []entities.WebhookDelivery{{Id: 1, WebhookId: 1, Event: event, URL: server.URL, Secret: internal.secret}},
+		failures: map[int64]int{},
+		disabled: map[int64]bool{},
+	}
+
+	cfg := config.Webhooks{Interval: 5 * time.Millisecond, BatchSize: 10, Timeout: time.Second, Lease: time.Minute,
+		RetryMin: time.Millisecond, RetryMax: time.Millisecond, MaxFailures: 1}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		workers.NewDeliverer(repository, webhooks.AddressPolicy{}, cfg, logger).Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		pending, _ := repository.state()
+		return pending == 0
+	}, 2*time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	// The connection is refused before anything is sent.
+	assert.Empty(t, internal.received)
+	assert.Zero(t, internal.requests)
+	if assert.Len(t, repository.attempts, 1) {
+		assert.Zero(t, repository.attempts[0].StatusCode)
+		assert.Contains(t, repository.attempts[0].Error, webhooks.ErrForbiddenAddress.Error())
+	}
+}